@@ -16,11 +16,13 @@ CREATE TYPE "user_status" AS ENUM (
 CREATE TABLE IF NOT EXISTS "users" (
     "id" BIGINT PRIMARY KEY DEFAULT nextval('uid_seq'),  -- UID
     "name" VARCHAR(64) NOT NULL UNIQUE,                  -- 用户名
+    "name_key" VARCHAR(64) NOT NULL UNIQUE,              -- 用户名折叠形式（大小写、形近字符），防止仿冒
     "status" "user_status" NOT NULL DEFAULT 'ACTIVE',    -- 状态
     "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),       -- 创建时间
     "updated_at" TIMESTAMP NOT NULL DEFAULT NOW(),       -- 更新时间
     "last_login" TIMESTAMP NOT NULL DEFAULT NOW(),       -- 最后登录时间
-    "opaque_record" BYTEA NOT NULL                       -- OPAQUE注册记录
+    "opaque_record" BYTEA NOT NULL,                      -- OPAQUE注册记录
+    "opaque_key_version" INTEGER NOT NULL DEFAULT 1      -- 注册记录绑定的 OPAQUE 密钥集版本
 );
 
 -- 登录日志表
@@ -28,6 +30,7 @@ CREATE TABLE IF NOT EXISTS "auth_login_log" (
     "id"        BIGSERIAL PRIMARY KEY,  -- 记录ID
     "uid"       BIGINT REFERENCES "users"("id") ON DELETE SET NULL, -- UID
     "username"  TEXT NOT NULL,          -- 用户名
+    "action"    TEXT NOT NULL,          -- 操作：register-init, register-finalize, login-init, login-finalize, mfa-verify, refresh 等
     "success"   BOOLEAN NOT NULL,       -- 状态
     "reason"    TEXT COMPRESSION zstd,  -- 失败原因
     "ip"        INET,                   -- 登录IP
@@ -35,7 +38,55 @@ CREATE TABLE IF NOT EXISTS "auth_login_log" (
     "created_at" TIMESTAMP NOT NULL DEFAULT NOW()
 );
 
+-- 处罚表（封禁、暂停），users.status 为当前生效的处罚
+CREATE TABLE IF NOT EXISTS "user_sanctions" (
+    "id"         BIGSERIAL PRIMARY KEY,  -- 记录ID
+    "uid"        BIGINT NOT NULL REFERENCES "users"("id") ON DELETE CASCADE, -- UID
+    "kind"       "user_status" NOT NULL, -- SUSPENDED 或 BANNED
+    "reason"     TEXT NOT NULL,          -- 处罚原因
+    "expires_at" TIMESTAMP,              -- 到期时间，NULL 为永久
+    "created_by" TEXT NOT NULL,          -- 操作者
+    "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+    "lifted_by"  TEXT,                   -- 解除者
+    "lifted_at"  TIMESTAMP,              -- 解除时间，NULL 为未解除
+    CHECK ("kind" IN ('SUSPENDED', 'BANNED'))
+);
+
+-- 恢复码表（注册时生成，忘记密码时凭恢复码重新注册 OPAQUE 记录）
+CREATE TABLE IF NOT EXISTS "user_recovery_codes" (
+    "id"         BIGSERIAL PRIMARY KEY,  -- 记录ID
+    "uid"        BIGINT NOT NULL REFERENCES "users"("id") ON DELETE CASCADE, -- UID
+    "code_hash"  BYTEA NOT NULL,         -- 恢复码的 SHA-256
+    "used_at"    TIMESTAMP,              -- 使用时间，NULL 为未使用
+    "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE ("uid", "code_hash")
+);
+
+-- TOTP 两步验证
+CREATE TABLE IF NOT EXISTS "user_totp" (
+    "uid"        BIGINT PRIMARY KEY REFERENCES "users"("id") ON DELETE CASCADE, -- UID
+    "secret"     BYTEA NOT NULL,                  -- TOTP 密钥
+    "enabled"    BOOLEAN NOT NULL DEFAULT FALSE,  -- 是否已确认启用
+    "last_step"  BIGINT NOT NULL DEFAULT 0,       -- 最后一次使用的时间步，防止验证码重放
+    "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+    "enabled_at" TIMESTAMP
+);
+
+-- 两步验证备用码（无法使用验证器时代替 TOTP 验证码）
+CREATE TABLE IF NOT EXISTS "user_totp_backup_codes" (
+    "id"         BIGSERIAL PRIMARY KEY,  -- 记录ID
+    "uid"        BIGINT NOT NULL REFERENCES "users"("id") ON DELETE CASCADE, -- UID
+    "code_hash"  BYTEA NOT NULL,         -- 备用码的 SHA-256
+    "used_at"    TIMESTAMP,              -- 使用时间，NULL 为未使用
+    UNIQUE ("uid", "code_hash")
+);
+
 CREATE INDEX IF NOT EXISTS "idx_users_name" ON "users"("name");
-CREATE INDEX IF NOT EXISTS "idx_login_log_uid" ON "auth_login_log"("uid");
+CREATE INDEX IF NOT EXISTS "idx_login_log_uid" ON "auth_login_log"("uid", "created_at" DESC);
+CREATE INDEX IF NOT EXISTS "idx_login_log_username" ON "auth_login_log"("username", "created_at" DESC);
+CREATE INDEX IF NOT EXISTS "idx_login_log_ip" ON "auth_login_log"("ip", "created_at" DESC);
+CREATE INDEX IF NOT EXISTS "idx_login_log_created_at" ON "auth_login_log"("created_at");
+CREATE INDEX IF NOT EXISTS "idx_sanctions_uid" ON "user_sanctions"("uid", "created_at" DESC);
+CREATE INDEX IF NOT EXISTS "idx_sanctions_active" ON "user_sanctions"("uid") WHERE "lifted_at" IS NULL;
 
 ALTER SEQUENCE "uid_seq" OWNED BY "users"."id";
\ No newline at end of file
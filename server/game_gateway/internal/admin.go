@@ -0,0 +1,387 @@
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/game_gateway/internal/dao"
+	"github.com/zrurf/quiver/server/game_gateway/internal/proto/net_proto"
+)
+
+const adminRequestTimeout = 5 * time.Second
+
+var (
+	errSessionNotFound = errors.New("session not found")
+	errRoomNotFound    = errors.New("room not found")
+)
+
+// AdminSession 管理接口返回的会话信息
+type AdminSession struct {
+	SessionID  uint64  `json:"session_id"`
+	UID        int64   `json:"uid"`
+	IP         string  `json:"ip"`
+	State      string  `json:"state"`
+	RoomID     uint64  `json:"room_id,omitempty"`
+	GameServer string  `json:"game_server,omitempty"`
+	Version    uint16  `json:"version"`
+	RTT        float64 `json:"rtt_ms"`     // 心跳测得的平滑 RTT
+	Jitter     float64 `json:"jitter_ms"`  // RTT 抖动
+	KCPRTT     int32   `json:"kcp_rtt_ms"` // KCP 平滑 RTT
+	LastActive int64   `json:"last_active"`
+	TwoFactor  bool    `json:"two_factor"` // 账号已启用两步验证
+}
+
+// AdminRoom 管理接口返回的房间信息（网关本地缓存）
+type AdminRoom struct {
+	RoomID      uint64  `json:"room_id"`
+	GameServer  string  `json:"game_server"`
+	PlayerCount int32   `json:"player_count"`
+	AvgRating   float64 `json:"avg_rating"`
+	ExpireAt    int64   `json:"expire_at"`
+}
+
+// AdminGameServer 管理接口返回的游戏服务器信息：本网关的链路状态与注册表中的负载
+type AdminGameServer struct {
+	Addr        string              `json:"addr"`
+	Connected   bool                `json:"connected"`
+	QueueLength int                 `json:"queue_length"`
+	Dropped     uint64              `json:"dropped_frames"`
+	Healthy     bool                `json:"healthy"`
+	Accepting   bool                `json:"accepting"`
+	Registry    *dao.GameServerInfo `json:"registry,omitempty"`
+}
+
+// BroadcastRequest 系统消息广播请求，RoomID 为 0 时发送给所有已认证的客户端
+// Kind 为 net_proto.NoticeKind 的名称（Info、Maintenance、ServerShutdown 等），默认 Info；Deadline 为毫秒时间戳
+type BroadcastRequest struct {
+	Message  string `json:"message"`
+	RoomID   uint64 `json:"room_id,omitempty"`
+	Kind     string `json:"kind,omitempty"`
+	Deadline int64  `json:"deadline,omitempty"`
+}
+
+// KickRequest 踢下线请求（可选），Message 为展示给玩家的提示
+type KickRequest struct {
+	Message string `json:"message,omitempty"`
+}
+
+// StartAdminServer 启动管理接口（监听 server.internal-listen）
+// 所有请求需携带 Authorization: Bearer <admin.token>；未配置 token 时不启动
+func StartAdminServer(cfg *Config, g *Gateway) {
+	if cfg.Admin.Token == "" {
+		log.Warn().Msg("admin token not set, admin API disabled")
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/sessions", g.adminListSessions)
+	mux.HandleFunc("POST /admin/sessions/{id}/kick", g.adminKickSession)
+	mux.HandleFunc("GET /admin/rooms", g.adminListRooms)
+	mux.HandleFunc("POST /admin/rooms/{id}/close", g.adminCloseRoom)
+	mux.HandleFunc("GET /admin/gameservers", g.adminListGameServers)
+	mux.HandleFunc("POST /admin/gameservers/{addr}/drain", g.adminDrainGameServer)
+	mux.HandleFunc("POST /admin/broadcast", g.adminBroadcast)
+
+	addr := fmt.Sprintf(":%d", cfg.Server.InternalListen)
+	log.Info().Msgf("Admin API listening on %s", addr)
+	if err := http.ListenAndServe(addr, adminAuth(cfg.Admin.Token, mux)); err != nil {
+		log.Error().Err(err).Msg("admin server failed")
+	}
+}
+
+// adminAuth 校验 Bearer token
+func adminAuth(token string, next http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			writeAdminError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		log.Info().Str("method", r.Method).Str("path", r.URL.Path).Str("remote", r.RemoteAddr).Msg("admin request")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	writeAdminJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (g *Gateway) adminListSessions(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, g.Sessions())
+}
+
+func (g *Gateway) adminKickSession(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	var req KickRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if err := g.KickSession(id, req.Message); err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (g *Gateway) adminListRooms(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, g.Rooms())
+}
+
+func (g *Gateway) adminCloseRoom(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), adminRequestTimeout)
+	defer cancel()
+	players, err := g.CloseRoom(ctx, id)
+	if errors.Is(err, errRoomNotFound) {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]any{"ok": true, "players": players})
+}
+
+func (g *Gateway) adminListGameServers(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, g.GameServers())
+}
+
+func (g *Gateway) adminDrainGameServer(w http.ResponseWriter, r *http.Request) {
+	addr := r.PathValue("addr")
+	ctx, cancel := context.WithTimeout(r.Context(), adminRequestTimeout)
+	defer cancel()
+	if err := g.DrainGameServer(ctx, addr); err != nil {
+		writeAdminError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (g *Gateway) adminBroadcast(w http.ResponseWriter, r *http.Request) {
+	var req BroadcastRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		writeAdminError(w, http.StatusBadRequest, errors.New("empty message"))
+		return
+	}
+	n := Notice{Kind: net_proto.NoticeKindInfo, Reason: net_proto.NoticeReasonAdmin, Message: req.Message}
+	if req.Kind != "" {
+		kind, ok := net_proto.EnumValuesNoticeKind[req.Kind]
+		if !ok {
+			writeAdminError(w, http.StatusBadRequest, fmt.Errorf("unknown kind %q", req.Kind))
+			return
+		}
+		n.Kind = kind
+	}
+	if req.Deadline > 0 {
+		n.Deadline = time.UnixMilli(req.Deadline)
+	}
+	sent := g.Broadcast(n, req.RoomID)
+	writeAdminJSON(w, http.StatusOK, map[string]any{"ok": true, "sent": sent})
+}
+
+// Sessions 返回当前所有客户端会话
+func (g *Gateway) Sessions() []AdminSession {
+	g.mu.RLock()
+	clients := make([]*ClientSession, 0, len(g.clients))
+	for _, c := range g.clients {
+		clients = append(clients, c)
+	}
+	g.mu.RUnlock()
+
+	sessions := make([]AdminSession, 0, len(clients))
+	for _, c := range clients {
+		c.mu.RLock()
+		sessions = append(sessions, AdminSession{
+			SessionID:  c.sessionID,
+			UID:        c.uid,
+			IP:         c.remoteAddr,
+			State:      sessionStateNames[c.state],
+			RoomID:     c.roomID,
+			GameServer: c.gameServerAddr,
+			Version:    c.version,
+			RTT:        float64(c.rtt.srtt.Microseconds()) / 1000,
+			Jitter:     float64(c.rtt.rttvar.Microseconds()) / 1000,
+			KCPRTT:     c.conn.GetSRTT(),
+			LastActive: c.lastHeartbeat.UnixMilli(),
+			TwoFactor:  c.twoFactor,
+		})
+		c.mu.RUnlock()
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].SessionID < sessions[j].SessionID })
+	return sessions
+}
+
+// Rooms 返回网关缓存的房间
+func (g *Gateway) Rooms() []AdminRoom {
+	g.mu.RLock()
+	rooms := make([]AdminRoom, 0, len(g.rooms))
+	for _, room := range g.rooms {
+		rooms = append(rooms, AdminRoom{
+			RoomID:      room.RoomID,
+			GameServer:  room.GameServer,
+			PlayerCount: room.PlayerCount,
+			AvgRating:   room.AvgRating,
+			ExpireAt:    room.ExpireAt.UnixMilli(),
+		})
+	}
+	g.mu.RUnlock()
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].RoomID < rooms[j].RoomID })
+	return rooms
+}
+
+// GameServers 返回本网关已建立链路的游戏服务器，以及注册表中的其他服务器
+func (g *Gateway) GameServers() []AdminGameServer {
+	registered := g.registry.Servers()
+
+	g.mu.RLock()
+	links := make([]*GameServerLink, 0, len(g.gameLinks))
+	for _, link := range g.gameLinks {
+		links = append(links, link)
+	}
+	g.mu.RUnlock()
+
+	result := make([]AdminGameServer, 0, len(links)+len(registered))
+	seen := make(map[string]struct{}, len(links))
+	for _, link := range links {
+		gs := AdminGameServer{
+			Addr:        link.addr,
+			Connected:   link.Connected(),
+			QueueLength: link.QueueLen(),
+			Dropped:     link.Dropped(),
+			Healthy:     g.registry.Healthy(link.addr),
+			Accepting:   g.registry.Accepting(link.addr),
+		}
+		if info, ok := registered[link.addr]; ok {
+			gs.Registry = &info
+		}
+		result = append(result, gs)
+		seen[link.addr] = struct{}{}
+	}
+	for addr, info := range registered {
+		if _, ok := seen[addr]; ok {
+			continue
+		}
+		result = append(result, AdminGameServer{
+			Addr:      addr,
+			Healthy:   g.registry.Healthy(addr),
+			Accepting: g.registry.Accepting(addr),
+			Registry:  &info,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Addr < result[j].Addr })
+	return result
+}
+
+// KickSession 通知客户端后断开指定会话，读循环退出后清理会话
+func (g *Gateway) KickSession(sessionID uint64, message string) error {
+	g.mu.RLock()
+	client, ok := g.clients[sessionID]
+	g.mu.RUnlock()
+	if !ok {
+		return errSessionNotFound
+	}
+	log.Info().Uint64("session", sessionID).Int64("uid", client.uid).Msg("session kicked by admin")
+	g.disconnectWithNotice(client, Notice{Kind: net_proto.NoticeKindKicked, Reason: net_proto.NoticeReasonAdmin, Message: message})
+	return nil
+}
+
+// CloseRoom 关闭房间：通知房间内玩家、将其退回大厅状态，删除房间记录并通知游戏服务器销毁房间
+// 返回受影响的玩家数
+func (g *Gateway) CloseRoom(ctx context.Context, roomID uint64) (int, error) {
+	g.mu.Lock()
+	room, cached := g.rooms[roomID]
+	delete(g.rooms, roomID)
+	clients := make([]*ClientSession, 0)
+	for _, c := range g.clients {
+		c.mu.RLock()
+		if c.roomID == roomID {
+			clients = append(clients, c)
+		}
+		c.mu.RUnlock()
+	}
+	g.mu.Unlock()
+
+	gsAddr := ""
+	if cached {
+		gsAddr = room.GameServer
+	} else if len(clients) == 0 {
+		return 0, errRoomNotFound
+	}
+
+	for _, c := range clients {
+		c.mu.Lock()
+		if gsAddr == "" {
+			gsAddr = c.gameServerAddr
+		}
+		c.roomID = 0
+		c.gameServerAddr = ""
+		c.state = SessionStateAuthed
+		c.mu.Unlock()
+		if err := g.sendNotice(c, Notice{Kind: net_proto.NoticeKindRoomClosing, Reason: net_proto.NoticeReasonRoomClosed}); err != nil {
+			log.Debug().Err(err).Uint64("session", c.sessionID).Msg("send notice failed")
+		}
+	}
+
+	if err := g.roomDao.DeleteRoom(ctx, roomID); err != nil {
+		return len(clients), err
+	}
+	if g.natsDao != nil {
+		if err := g.natsDao.PublishRoomDestroyed(ctx, roomID, gsAddr); err != nil {
+			return len(clients), err
+		}
+	}
+	log.Info().Uint64("room", roomID).Str("gs", gsAddr).Int("players", len(clients)).Msg("room closed by admin")
+	return len(clients), nil
+}
+
+// DrainGameServer 让游戏服务器进入排空模式
+// 本网关立即停止向其放置新房间，其他网关在收到服务器的排空通知后同样停止
+func (g *Gateway) DrainGameServer(ctx context.Context, addr string) error {
+	if g.natsDao == nil {
+		return errors.New("nats not connected")
+	}
+	g.registry.MarkDraining(addr)
+	if err := g.natsDao.RequestDrain(ctx, addr, adminRequestTimeout); err != nil {
+		return err
+	}
+	log.Info().Str("gs", addr).Msg("game server drain requested by admin")
+	return nil
+}
+
+// Broadcast 向所有已认证的客户端（或指定房间内的玩家）发送系统通知，返回发送成功的数量
+func (g *Gateway) Broadcast(n Notice, roomID uint64) int {
+	sent := g.notifyClients(n, func(c *ClientSession) bool {
+		return roomID == 0 || c.roomID == roomID
+	})
+	log.Info().Uint64("room", roomID).Str("kind", n.Kind.String()).Int("sent", sent).Msg("system notice broadcast")
+	return sent
+}
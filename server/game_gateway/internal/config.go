@@ -6,20 +6,46 @@ import (
 
 type Config struct {
 	Server struct {
-		Listen          string        `mapstructure:"listen"`
-		KCPPort         int           `mapstructure:"kcp-port"`
-		InternalListen  int           `mapstructure:"internal-listen"`
-		IdleRoomTimeout time.Duration `mapstructure:"idle-room-timeout"`
-		RateLimit       int           `mapstructure:"rate-limit"`
+		Listen            string        `mapstructure:"listen"`
+		GatewayID         string        `mapstructure:"gateway-id"`
+		KCPPort           int           `mapstructure:"kcp-port"`
+		InternalListen    int           `mapstructure:"internal-listen"`
+		IdleRoomTimeout   time.Duration `mapstructure:"idle-room-timeout"`
+		RateLimit         int           `mapstructure:"rate-limit"`
+		HeartbeatInterval time.Duration `mapstructure:"heartbeat-interval"`
+		HeartbeatTimeout  time.Duration `mapstructure:"heartbeat-timeout"`
 	} `mapstructure:"server"`
+	Session struct {
+		DuplicateLogin string `mapstructure:"duplicate-login"`
+	} `mapstructure:"session"`
+	Admin struct {
+		Token string `mapstructure:"token"`
+	} `mapstructure:"admin"`
 	Logger struct {
 		Level string `mapstructure:"level"`
 	} `mapstructure:"logger"`
+	Tracing struct {
+		Enabled     bool    `mapstructure:"enabled"`
+		Endpoint    string  `mapstructure:"endpoint"`
+		Insecure    bool    `mapstructure:"insecure"`
+		SampleRatio float64 `mapstructure:"sample-ratio"`
+	} `mapstructure:"tracing"`
 	UserServer struct {
 		URL string `mapstructure:"url"`
 	} `mapstructure:"user-server"`
+	Token struct {
+		LocalVerify    bool          `mapstructure:"local-verify"`
+		KeysURL        string        `mapstructure:"keys-url"`
+		KeysRefresh    time.Duration `mapstructure:"keys-refresh"`
+		RevocationSync time.Duration `mapstructure:"revocation-sync"`
+		RequiredScope  string        `mapstructure:"required-scope"`
+	} `mapstructure:"token"`
 	GameServers []string `mapstructure:"game-servers"`
-	Database    struct {
+	Registry    struct {
+		RefreshInterval time.Duration `mapstructure:"refresh-interval"`
+		StaleAfter      time.Duration `mapstructure:"stale-after"`
+	} `mapstructure:"registry"`
+	Database struct {
 		Host     string `mapstructure:"host"`
 		Port     string `mapstructure:"port"`
 		User     string `mapstructure:"user"`
@@ -36,4 +62,28 @@ type Config struct {
 	Play struct {
 		MaxPlayersPerRoom int `mapstructure:"max-players-per-room"`
 	} `mapstructure:"play"`
+	Transport struct {
+		QueueSize  int    `mapstructure:"queue-size"`
+		BatchBytes int    `mapstructure:"batch-bytes"`
+		DropPolicy string `mapstructure:"drop-policy"`
+	} `mapstructure:"transport"`
+	Protocol struct {
+		MinVersion int    `mapstructure:"min-version"`
+		MaxVersion int    `mapstructure:"max-version"`
+		UpdateURL  string `mapstructure:"update-url"`
+	} `mapstructure:"protocol"`
+}
+
+// Redacted 返回隐去管理接口令牌与数据库密码的副本，用于打印配置
+func (c Config) Redacted() Config {
+	c.Admin.Token = redactSecret(c.Admin.Token)
+	c.Database.Password = redactSecret(c.Database.Password)
+	return c
+}
+
+func redactSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "******"
 }
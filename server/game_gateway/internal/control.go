@@ -0,0 +1,39 @@
+package internal
+
+import "github.com/rs/zerolog/log"
+
+// 内部控制帧
+// 房间ID为0的帧不是游戏数据：数据首字节为控制码，其后为控制码对应的内容
+const (
+	ctrlGatewayHello  byte = 1 // 网关 -> 游戏服务器：声明网关ID（连接建立后的第一帧）
+	ctrlKeepalive     byte = 2 // 网关 -> 游戏服务器：空闲保活
+	ctrlNotice        byte = 3 // 游戏服务器 -> 网关：向玩家下发系统通知（JSON，见 noticeFrame）
+	ctrlPlayerLeave   byte = 4 // 网关 -> 游戏服务器：玩家离开房间（8字节房间ID + 8字节UID）
+	ctrlPlayerLatency byte = 5 // 网关 -> 游戏服务器：玩家延迟（8字节房间ID + 8字节UID + 4字节RTT + 4字节抖动，单位微秒）
+)
+
+// encodeControlFrame 构造控制帧
+func encodeControlFrame(op byte, body []byte) []byte {
+	data := make([]byte, 1+len(body))
+	data[0] = op
+	copy(data[1:], body)
+	return encodeForwardFrame(0, 0, data)
+}
+
+// isControlFrame 判断下行帧是否为控制帧
+func isControlFrame(roomID uint64) bool {
+	return roomID == 0
+}
+
+// handleControlDownlink 处理游戏服务器发来的控制帧
+func (g *Gateway) handleControlDownlink(gsAddr string, payload []byte) {
+	if len(payload) == 0 {
+		return
+	}
+	switch payload[0] {
+	case ctrlNotice:
+		g.handleNoticeFrame(gsAddr, payload[1:])
+	default:
+		log.Warn().Str("gs", gsAddr).Uint8("op", payload[0]).Msg("unknown control frame")
+	}
+}
@@ -0,0 +1,124 @@
+package dao
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EventVersion 当前事件格式版本
+// 新增字段不改变版本；字段含义或结构不兼容变化时递增，消费方丢弃无法识别的版本
+const EventVersion = 1
+
+// 事件类型（同时作为主题后缀，完整主题为 "<mq.subject>.<类型>"）
+const (
+	EventRoomCreated    = "room.created"
+	EventRoomDestroyed  = "room.destroyed"
+	EventRoomMigrate    = "room.migrate"
+	EventServerDraining = "gameserver.draining"
+	EventSessionKick    = "session.kick"
+)
+
+// Event 事件信封，结构见 schema/mq/events.schema.json
+type Event struct {
+	Version int             `json:"v"`
+	Type    string          `json:"type"`
+	Source  string          `json:"source"` // 发布方实例ID
+	Time    int64           `json:"ts"`     // 毫秒时间戳
+	Data    json.RawMessage `json:"data"`
+}
+
+type RoomCreatedEvent struct {
+	RoomID     uint64  `json:"room_id"`
+	Addr       string  `json:"addr"`
+	InitRating float64 `json:"init_rating"`
+}
+
+type RoomDestroyedEvent struct {
+	RoomID uint64 `json:"room_id"`
+	Addr   string `json:"addr,omitempty"`
+}
+
+type RoomMigrateEvent struct {
+	RoomID uint64 `json:"room_id"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+type ServerDrainingEvent struct {
+	Addr string `json:"addr"`
+}
+
+// SessionKickEvent 要求网关断开账号的会话（网关处理重复登录、用户服务器吊销令牌时发布）
+// Gateway 为空时所有网关处理；SessionID 为 0 时断开该账号在目标网关上的所有会话
+// Family 非空时只断开该令牌族（签名令牌中的 sid）的会话，刷新轮换前认证的会话同样断开
+// TokenHash 为令牌族当前访问令牌的 SHA-256 十六进制，认证时未能取得令牌族的会话据此匹配
+// RevokedTokens 为本次吊销的签名访问令牌哈希，所有网关立即加入本地吊销列表
+// Reason 为 net_proto.NoticeReason 的枚举名称，作为断线通知的原因
+type SessionKickEvent struct {
+	UID           int64    `json:"uid"`
+	Gateway       string   `json:"gateway,omitempty"`
+	SessionID     uint64   `json:"session_id,omitempty"`
+	Family        string   `json:"family,omitempty"`
+	TokenHash     string   `json:"token_hash,omitempty"`
+	RevokedTokens []string `json:"revoked_tokens,omitempty"`
+	Reason        string   `json:"reason"`
+	Message       string   `json:"message,omitempty"` // 断线通知文本，可为空
+}
+
+// CreateRoomRequest 网关请求游戏服务器创建房间（request/reply）
+type CreateRoomRequest struct {
+	RoomID     uint64  `json:"room_id"`
+	InitRating float64 `json:"init_rating"`
+}
+
+type CreateRoomReply struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// DrainRequest 请求游戏服务器进入排空模式（request/reply，由管理接口发起）
+type DrainRequest struct {
+	Addr string `json:"addr"`
+}
+
+type DrainReply struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// encodeEvent 构造事件信封
+func encodeEvent(eventType, source string, data any) ([]byte, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Event{
+		Version: EventVersion,
+		Type:    eventType,
+		Source:  source,
+		Time:    time.Now().UnixMilli(),
+		Data:    body,
+	})
+}
+
+// decodeEvent 解析事件信封并将数据解码到 out
+func decodeEvent(raw []byte, out any) (*Event, error) {
+	var ev Event
+	if err := json.Unmarshal(raw, &ev); err != nil {
+		return nil, err
+	}
+	if ev.Version != EventVersion {
+		return nil, fmt.Errorf("unsupported event version %d", ev.Version)
+	}
+	if err := json.Unmarshal(ev.Data, out); err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+// subjectToken 将地址等任意字符串转换为可用作主题片段的形式（NATS 主题以 . 分隔）
+func subjectToken(s string) string {
+	return strings.NewReplacer(".", "_", ":", "_", "*", "_", ">", "_", " ", "_").Replace(s)
+}
@@ -1,34 +1,249 @@
 package dao
 
 import (
-	"fmt"
-	"strconv"
+	"context"
+	"errors"
+	"strings"
+	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/game_gateway/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// 房间生命周期事件保存在 JetStream 流中，游戏服务器重启后可从上次位置继续消费
+const roomStreamMaxAge = 24 * time.Hour
+
 type NatsClient struct {
-	conn *nats.Conn
+	conn   *nats.Conn
+	js     jetstream.JetStream
+	prefix string // 主题前缀（mq.subject）
+	source string // 本实例ID
 }
 
-func NewNATSClient(addr string) (*NatsClient, error) {
+// NewNATSClient 连接 NATS 并确保房间事件流存在
+func NewNATSClient(addr, prefix, source string) (*NatsClient, error) {
 	nc, err := nats.Connect(addr)
 	if err != nil {
 		return nil, err
 	}
-	log.Info().Str("addr", addr).Msg("connected to NATS")
-	return &NatsClient{conn: nc}, nil
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	c := &NatsClient{conn: nc, js: js, prefix: prefix, source: source}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     RoomStreamName(prefix),
+		Subjects: []string{prefix + ".room.>"},
+		MaxAge:   roomStreamMaxAge,
+		Storage:  jetstream.FileStorage,
+	}); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	log.Info().Str("addr", addr).Str("prefix", prefix).Msg("connected to NATS")
+	return c, nil
+}
+
+// RoomStreamName 房间事件流名称
+func RoomStreamName(prefix string) string {
+	return strings.ToUpper(subjectToken(prefix)) + "_ROOMS"
+}
+
+// Subject 返回带前缀的完整主题
+func (c *NatsClient) Subject(eventType string) string {
+	return c.prefix + "." + eventType
+}
+
+// createRoomSubject 游戏服务器接收建房请求的主题
+func (c *NatsClient) createRoomSubject(gameServerAddr string) string {
+	return c.prefix + ".gameserver." + subjectToken(gameServerAddr) + ".room.create"
+}
+
+// drainSubject 游戏服务器接收排空指令的主题
+func (c *NatsClient) drainSubject(gameServerAddr string) string {
+	return c.prefix + ".gameserver." + subjectToken(gameServerAddr) + ".drain"
+}
+
+// startSpan 为一次消息收发创建 span，消息头携带追踪上下文
+func startSpan(ctx context.Context, op, subject string, kind trace.SpanKind) (context.Context, trace.Span) {
+	return tracing.Start(ctx, op+" "+subject, trace.WithSpanKind(kind), trace.WithAttributes(
+		attribute.String("messaging.system", "nats"),
+		attribute.String("messaging.destination.name", subject),
+	))
+}
+
+// publishDurable 发布事件到 JetStream 并等待持久化确认
+func (c *NatsClient) publishDurable(ctx context.Context, eventType string, data any) (err error) {
+	subject := c.Subject(eventType)
+	ctx, span := startSpan(ctx, "publish", subject, trace.SpanKindProducer)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	payload, err := encodeEvent(eventType, c.source, data)
+	if err != nil {
+		return err
+	}
+	msg := &nats.Msg{Subject: subject, Data: payload}
+	tracing.Inject(ctx, msg)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	_, err = c.js.PublishMsg(ctx, msg)
+	return err
+}
+
+// publish 发布非持久事件，没有订阅者在线时直接丢弃
+func (c *NatsClient) publish(ctx context.Context, eventType string, data any) (err error) {
+	subject := c.Subject(eventType)
+	ctx, span := startSpan(ctx, "publish", subject, trace.SpanKindProducer)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	payload, err := encodeEvent(eventType, c.source, data)
+	if err != nil {
+		return err
+	}
+	msg := &nats.Msg{Subject: subject, Data: payload}
+	tracing.Inject(ctx, msg)
+	return c.conn.PublishMsg(msg)
+}
+
+func (c *NatsClient) PublishRoomCreated(ctx context.Context, roomID uint64, gameServerAddr string, initRating float64) error {
+	return c.publishDurable(ctx, EventRoomCreated, RoomCreatedEvent{RoomID: roomID, Addr: gameServerAddr, InitRating: initRating})
+}
+
+func (c *NatsClient) PublishRoomDestroyed(ctx context.Context, roomID uint64, gameServerAddr string) error {
+	return c.publishDurable(ctx, EventRoomDestroyed, RoomDestroyedEvent{RoomID: roomID, Addr: gameServerAddr})
+}
+
+// RequestCreateRoom 请求游戏服务器创建房间，收到确认后返回
+func (c *NatsClient) RequestCreateRoom(ctx context.Context, gameServerAddr string, roomID uint64, initRating float64, timeout time.Duration) (err error) {
+	subject := c.createRoomSubject(gameServerAddr)
+	ctx, span := startSpan(ctx, "request", subject, trace.SpanKindClient)
+	span.SetAttributes(attribute.Int64("room.id", int64(roomID)), attribute.String("gs.addr", gameServerAddr))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	payload, err := encodeEvent("room.create", c.source, CreateRoomRequest{RoomID: roomID, InitRating: initRating})
+	if err != nil {
+		return err
+	}
+	req := &nats.Msg{Subject: subject, Data: payload}
+	tracing.Inject(ctx, req)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	msg, err := c.conn.RequestMsgWithContext(ctx, req)
+	if err != nil {
+		return err
+	}
+	var reply CreateRoomReply
+	if _, err := decodeEvent(msg.Data, &reply); err != nil {
+		return err
+	}
+	if !reply.OK {
+		return errors.New(reply.Error)
+	}
+	return nil
+}
+
+// RequestDrain 请求游戏服务器进入排空模式，服务器确认开始排空后返回（不等待排空结束）
+func (c *NatsClient) RequestDrain(ctx context.Context, gameServerAddr string, timeout time.Duration) (err error) {
+	subject := c.drainSubject(gameServerAddr)
+	ctx, span := startSpan(ctx, "request", subject, trace.SpanKindClient)
+	span.SetAttributes(attribute.String("gs.addr", gameServerAddr))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	payload, err := encodeEvent("gameserver.drain", c.source, DrainRequest{Addr: gameServerAddr})
+	if err != nil {
+		return err
+	}
+	req := &nats.Msg{Subject: subject, Data: payload}
+	tracing.Inject(ctx, req)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	msg, err := c.conn.RequestMsgWithContext(ctx, req)
+	if err != nil {
+		return err
+	}
+	var reply DrainReply
+	if _, err := decodeEvent(msg.Data, &reply); err != nil {
+		return err
+	}
+	if !reply.OK {
+		return errors.New(reply.Error)
+	}
+	return nil
+}
+
+// SubscribeServerDraining 订阅游戏服务器排空通知
+func (c *NatsClient) SubscribeServerDraining(handler func(ctx context.Context, addr string)) error {
+	_, err := c.conn.Subscribe(c.Subject(EventServerDraining), func(msg *nats.Msg) {
+		ctx, span := startSpan(tracing.Extract(context.Background(), msg.Header), "receive", msg.Subject, trace.SpanKindConsumer)
+		defer span.End()
+		var ev ServerDrainingEvent
+		if _, err := decodeEvent(msg.Data, &ev); err != nil {
+			log.Error().Err(err).Str("subject", msg.Subject).Msg("invalid event")
+			tracing.RecordError(span, err)
+			return
+		}
+		handler(ctx, ev.Addr)
+	})
+	return err
+}
+
+// SubscribeRoomMigrate 订阅房间迁移通知
+// 网关重启后不持有任何会话，无需补收历史事件，因此使用普通订阅
+func (c *NatsClient) SubscribeRoomMigrate(handler func(ctx context.Context, roomID uint64, from, to string)) error {
+	_, err := c.conn.Subscribe(c.Subject(EventRoomMigrate), func(msg *nats.Msg) {
+		ctx, span := startSpan(tracing.Extract(context.Background(), msg.Header), "receive", msg.Subject, trace.SpanKindConsumer)
+		defer span.End()
+		var ev RoomMigrateEvent
+		if _, err := decodeEvent(msg.Data, &ev); err != nil {
+			log.Error().Err(err).Str("subject", msg.Subject).Msg("invalid event")
+			tracing.RecordError(span, err)
+			return
+		}
+		handler(ctx, ev.RoomID, ev.From, ev.To)
+	})
+	return err
 }
 
-func (c *NatsClient) PublishRoomCreated(roomID uint64, gameServerAddr string, initRating float64) error {
-	data := []byte(fmt.Sprintf("%d:%s:%f", roomID, gameServerAddr, initRating))
-	return c.conn.Publish("room.created", data)
+// PublishSessionKick 通知网关断开账号的会话
+func (c *NatsClient) PublishSessionKick(ctx context.Context, ev SessionKickEvent) error {
+	return c.publish(ctx, EventSessionKick, ev)
 }
 
-func (c *NatsClient) PublishRoomDestroyed(roomID uint64) error {
-	data := []byte(strconv.FormatUint(roomID, 10))
-	return c.conn.Publish("room.destroyed", data)
+// SubscribeSessionKick 订阅会话断开通知
+// 会话只存在于网关内存中，网关重启后无需补收历史事件，因此使用普通订阅
+func (c *NatsClient) SubscribeSessionKick(handler func(ctx context.Context, ev SessionKickEvent)) error {
+	_, err := c.conn.Subscribe(c.Subject(EventSessionKick), func(msg *nats.Msg) {
+		ctx, span := startSpan(tracing.Extract(context.Background(), msg.Header), "receive", msg.Subject, trace.SpanKindConsumer)
+		defer span.End()
+		var ev SessionKickEvent
+		if _, err := decodeEvent(msg.Data, &ev); err != nil {
+			log.Error().Err(err).Str("subject", msg.Subject).Msg("invalid event")
+			tracing.RecordError(span, err)
+			return
+		}
+		handler(ctx, ev)
+	})
+	return err
 }
 
 func (c *NatsClient) Close() {
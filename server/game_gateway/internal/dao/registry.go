@@ -0,0 +1,72 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	gameServerPrefix = "gameserver:"
+	gameServerSet    = "gameservers"
+)
+
+// GameServerInfo 游戏服务器注册信息（由游戏服务器定期写入）
+type GameServerInfo struct {
+	Addr        string `json:"addr"`
+	MaxRooms    int    `json:"max_rooms"`
+	Rooms       int    `json:"rooms"`
+	Players     int    `json:"players"`
+	TickOverrun int64  `json:"tick_overrun"`
+	Draining    bool   `json:"draining"`
+	StartedAt   int64  `json:"started_at"`
+	UpdatedAt   int64  `json:"updated_at"`
+}
+
+type RegistryRepository struct {
+	imdb *redis.Client
+}
+
+func NewRegistryRepository(imdb *redis.Client) *RegistryRepository {
+	return &RegistryRepository{imdb: imdb}
+}
+
+// ListGameServers 返回所有仍在心跳有效期内的游戏服务器
+// 注册信息已过期的地址会从集合中移除
+func (r *RegistryRepository) ListGameServers(ctx context.Context) ([]GameServerInfo, error) {
+	addrs, err := r.imdb.SMembers(ctx, gameServerSet).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, len(addrs))
+	for i, addr := range addrs {
+		keys[i] = gameServerPrefix + addr
+	}
+	values, err := r.imdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	servers := make([]GameServerInfo, 0, len(addrs))
+	var expired []interface{}
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			expired = append(expired, addrs[i])
+			continue
+		}
+		var info GameServerInfo
+		if err := json.Unmarshal([]byte(s), &info); err != nil {
+			continue
+		}
+		servers = append(servers, info)
+	}
+	if len(expired) > 0 {
+		r.imdb.SRem(ctx, gameServerSet, expired...)
+	}
+	return servers, nil
+}
@@ -3,6 +3,7 @@ package dao
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -42,6 +43,43 @@ func (r *RoomRepository) SaveRoom(ctx context.Context, roomID uint64, addr strin
 	return r.imdb.Set(ctx, roomKey(roomID), jsonData, 0).Err()
 }
 
+// DeleteRoom 删除房间记录，房间不再参与匹配
+func (r *RoomRepository) DeleteRoom(ctx context.Context, roomID uint64) error {
+	return r.imdb.Del(ctx, roomKey(roomID)).Err()
+}
+
+// AdjustPlayerCount 调整房间记录中的玩家数（加入为正、离开为负，结果不小于0）
+// 房间记录同时被游戏服务器更新，使用 WATCH 事务避免覆盖对方写入的字段
+func (r *RoomRepository) AdjustPlayerCount(ctx context.Context, roomID uint64, delta int) error {
+	key := roomKey(roomID)
+	return r.imdb.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return nil // 房间已被删除
+		}
+		if err != nil {
+			return err
+		}
+		room := make(map[string]interface{})
+		if err := json.Unmarshal(data, &room); err != nil {
+			return err
+		}
+		cnt, _ := room["player_cnt"].(float64)
+		cnt += float64(delta)
+		if cnt < 0 {
+			cnt = 0
+		}
+		room["player_cnt"] = int(cnt)
+		room["updated_at"] = time.Now().Unix()
+		jsonData, _ := json.Marshal(room)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, jsonData, 0)
+			return nil
+		})
+		return err
+	}, key)
+}
+
 func (r *RoomRepository) GetPlayerRating(ctx context.Context, uid int64) (float64, float64, error) {
 	var rating float64
 	var rd float64
@@ -2,18 +2,40 @@ package dao
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 const (
-	AccessPrefix = "session:"
+	AccessPrefix       = "session:"
+	AccessFamilyPrefix = "session_family:" // 访问令牌 -> 令牌族ID，由用户服务在签发令牌时维护
+	OnlinePrefix       = "online:"         // 在线会话记录 online:<uid>，保证一个账号同时只有一个会话
+	// 两步验证标记 user_2fa:<uid>，由用户服务在启用/关闭两步验证时维护
+	TwoFactorPrefix = "user_2fa:"
+	// 已吊销但未过期的签名访问令牌（有序集合，成员为令牌哈希，分数为过期时间毫秒），由用户服务在吊销令牌时维护
+	RevocationKey = "token_revocations"
 )
 
 type SessionRepository struct {
 	imdb *redis.Client
 }
 
+// OnlineSession 账号当前在线会话所在的网关与会话ID
+type OnlineSession struct {
+	Gateway   string `json:"gateway"`
+	SessionID uint64 `json:"session_id"`
+	Since     int64  `json:"since"` // 认证时间（毫秒时间戳）
+}
+
+// Same 是否为同一会话
+func (s *OnlineSession) Same(o *OnlineSession) bool {
+	return s.Gateway == o.Gateway && s.SessionID == o.SessionID
+}
+
 func NewSessionRepository(imdb *redis.Client) *SessionRepository {
 	return &SessionRepository{
 		imdb: imdb,
@@ -25,8 +47,101 @@ func (r *SessionRepository) GetUidByAccessToken(ctx context.Context, token strin
 	return r.imdb.Get(ctx, AccessPrefix+token).Int64()
 }
 
+// GetAccessFamily 通过访问令牌获取令牌族ID
+func (r *SessionRepository) GetAccessFamily(ctx context.Context, token string) (string, error) {
+	return r.imdb.Get(ctx, AccessFamilyPrefix+token).Result()
+}
+
 // HasAccessToken 检查访问令牌是否存在
 func (r *SessionRepository) HasAccessToken(ctx context.Context, token string) (bool, error) {
 	res, err := r.imdb.Exists(ctx, AccessPrefix+token).Result()
 	return res != 0, err
 }
+
+// TwoFactorEnabled 账号是否已启用两步验证
+func (r *SessionRepository) TwoFactorEnabled(ctx context.Context, uid int64) (bool, error) {
+	res, err := r.imdb.Exists(ctx, TwoFactorPrefix+strconv.FormatInt(uid, 10)).Result()
+	return res != 0, err
+}
+
+// ListRevocations 返回尚未过期的已吊销签名访问令牌哈希
+func (r *SessionRepository) ListRevocations(ctx context.Context) ([]string, error) {
+	return r.imdb.ZRangeByScore(ctx, RevocationKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+}
+
+func onlineKey(uid int64) string {
+	return OnlinePrefix + strconv.FormatInt(uid, 10)
+}
+
+// ClaimOnline 登记账号的在线会话，返回此前登记的其他会话（没有则为 nil）
+// replace 为 false 时，已有其他会话在线则不覆盖，claimed 返回 false
+func (r *SessionRepository) ClaimOnline(ctx context.Context, uid int64, s OnlineSession, ttl time.Duration, replace bool) (prev *OnlineSession, claimed bool, err error) {
+	key := onlineKey(uid)
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, false, err
+	}
+	err = r.imdb.Watch(ctx, func(tx *redis.Tx) error {
+		prev, claimed = nil, false
+		raw, err := tx.Get(ctx, key).Bytes()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if err == nil {
+			var cur OnlineSession
+			if json.Unmarshal(raw, &cur) == nil && !cur.Same(&s) {
+				prev = &cur
+			}
+		}
+		if prev != nil && !replace {
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, ttl)
+			return nil
+		})
+		claimed = err == nil
+		return err
+	}, key)
+	return prev, claimed, err
+}
+
+// RefreshOnline 延长一批账号在线记录的有效期
+func (r *SessionRepository) RefreshOnline(ctx context.Context, uids []int64, ttl time.Duration) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	_, err := r.imdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, uid := range uids {
+			pipe.Expire(ctx, onlineKey(uid), ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// ReleaseOnline 删除账号的在线记录，记录已被其他会话替换时不做处理
+func (r *SessionRepository) ReleaseOnline(ctx context.Context, uid int64, s OnlineSession) error {
+	key := onlineKey(uid)
+	return r.imdb.Watch(ctx, func(tx *redis.Tx) error {
+		raw, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var cur OnlineSession
+		if json.Unmarshal(raw, &cur) == nil && !cur.Same(&s) {
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			return nil
+		})
+		return err
+	}, key)
+}
@@ -5,8 +5,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
-	"net"
+	"os"
 	"sync"
 	"time"
 
@@ -15,10 +14,21 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/xtaci/kcp-go/v5"
 	"github.com/zrurf/quiver/server/game_gateway/internal/dao"
+	"github.com/zrurf/quiver/server/game_gateway/internal/monitor"
 	"github.com/zrurf/quiver/server/game_gateway/internal/proto/net_proto" // 由 net.fbs.txt 生成
+	"github.com/zrurf/quiver/server/game_gateway/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
 )
 
+// 建房请求参数
+const (
+	createRoomAttempts = 3
+	createRoomTimeout  = 2 * time.Second
+)
+
 // 会话状态
 const (
 	SessionStateUnauthed = iota // 未认证
@@ -29,30 +39,38 @@ const (
 // ClientSession 代表一个客户端连接
 type ClientSession struct {
 	conn           *kcp.UDPSession
-	sessionID      uint64 // 网关生成的会话ID
-	uid            int64  // 用户ID（认证后有效）
-	state          int    // 会话状态
-	roomID         uint64 // 当前所在房间ID（0表示未加入）
-	gameServerAddr string // 当前房间对应的游戏服务器地址
-	remoteAddr     string // 客户端地址（用于限流日志）
-	lastHeartbeat  time.Time
+	sessionID      uint64       // 网关生成的会话ID
+	uid            int64        // 用户ID（认证后有效）
+	state          int          // 会话状态
+	roomID         uint64       // 当前所在房间ID（0表示未加入）
+	gameServerAddr string       // 当前房间对应的游戏服务器地址
+	remoteAddr     string       // 客户端地址（用于限流日志）
+	version        uint16       // 协商后的协议版本（0表示尚未确定）
+	tokenHash      string       // 认证所用访问令牌的哈希（未能取得令牌族时据此断开）
+	family         string       // 认证所用访问令牌的令牌族ID（令牌族被吊销时据此断开，刷新轮换后不变）
+	twoFactor      bool         // 账号是否已启用两步验证（敏感操作据此判断）
+	lastHeartbeat  time.Time    // 最后一次收到消息的时间
+	rtt            rttEstimator // 心跳测得的 RTT 与抖动
 	mu             sync.RWMutex
 }
 
 // Gateway 网关主结构
 type Gateway struct {
+	id            string // 网关实例ID（多网关部署时区分来源）
 	config        *Config
 	roomDao       *dao.RoomRepository
 	sessionDao    *dao.SessionRepository
 	natsDao       *dao.NatsClient
+	registry      *ServerRegistry           // 游戏服务器注册表
+	tokens        *TokenVerifier            // 签名访问令牌校验，未启用时为 nil
 	clients       map[uint64]*ClientSession // sessionID -> session
 	clientsByUID  map[int64]*ClientSession  // uid -> session
 	rooms         map[uint64]*RoomSession   // roomID -> room 信息（缓存）
 	rateLimiter   *IPRateLimiter
 	zstdDecoder   *zstd.Decoder
 	zstdEncoder   *zstd.Encoder
-	nextSessionID uint64                           // 原子递增生成sessionID
-	gameConns     map[string]*GameServerConnection // 游戏服务器连接池（地址->连接）
+	nextSessionID uint64                     // 原子递增生成sessionID
+	gameLinks     map[string]*GameServerLink // 游戏服务器链路（地址->链路）
 	mu            sync.RWMutex
 	ctx           context.Context
 	cancel        context.CancelFunc
@@ -67,71 +85,32 @@ type RoomSession struct {
 	ExpireAt    time.Time // 空闲超时时间
 }
 
-// GameServerConnection 到游戏服务器的连接
-type GameServerConnection struct {
-	conn net.Conn
-	mu   sync.Mutex
-}
-
 // NewGateway 创建网关实例
-func NewGateway(cfg *Config, sessionDao *dao.SessionRepository, roomDao *dao.RoomRepository, nataDao *dao.NatsClient) *Gateway {
+func NewGateway(cfg *Config, sessionDao *dao.SessionRepository, roomDao *dao.RoomRepository, registryDao *dao.RegistryRepository, nataDao *dao.NatsClient) *Gateway {
 	ctx, cancel := context.WithCancel(context.Background())
+	var tokens *TokenVerifier
+	if cfg.Token.LocalVerify {
+		tokens = NewTokenVerifier(sessionDao, cfg)
+	}
 	return &Gateway{
+		id:            GatewayID(cfg),
 		config:        cfg,
 		roomDao:       roomDao,
 		sessionDao:    sessionDao,
 		natsDao:       nataDao,
+		registry:      NewServerRegistry(registryDao, cfg),
+		tokens:        tokens,
 		clients:       make(map[uint64]*ClientSession),
 		clientsByUID:  make(map[int64]*ClientSession),
 		rooms:         make(map[uint64]*RoomSession),
 		rateLimiter:   NewIPRateLimiter(rate.Limit(cfg.Server.RateLimit), cfg.Server.RateLimit),
-		gameConns:     make(map[string]*GameServerConnection),
+		gameLinks:     make(map[string]*GameServerLink),
 		nextSessionID: 1,
 		ctx:           ctx,
 		cancel:        cancel,
 	}
 }
 
-// Start 启动网关
-func (g *Gateway) Start() {
-	addr := fmt.Sprintf(":%d", g.config.Server.KCPPort)
-	listener, err := kcp.ListenWithOptions(addr, nil, 0, 0)
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to listen KCP")
-	}
-	defer listener.Close()
-
-	log.Info().Msgf("KCP gateway listening on %s", addr)
-
-	// 启动空闲房间清理协程
-	go g.cleanIdleRooms()
-
-	for {
-		conn, err := listener.AcceptKCP()
-		if err != nil {
-			log.Error().Err(err).Msg("accept KCP connection error")
-			continue
-		}
-		// 设置KCP参数（低延迟模式）
-		conn.SetWriteDelay(false)
-		conn.SetNoDelay(1, 20, 2, 1)
-
-		// 获取客户端IP
-		remoteAddr := conn.RemoteAddr().String()
-		ip, _, _ := net.SplitHostPort(remoteAddr)
-
-		// 限流
-		if !g.rateLimiter.Allow(ip) {
-			log.Warn().Str("ip", ip).Msg("rate limit exceeded, closing connection")
-			conn.Close()
-			continue
-		}
-
-		// 处理新连接
-		go g.handleClient(conn, ip)
-	}
-}
-
 // handleClient 处理单个客户端连接
 func (g *Gateway) handleClient(conn *kcp.UDPSession, ip string) {
 	sessionID := g.generateSessionID()
@@ -146,26 +125,36 @@ func (g *Gateway) handleClient(conn *kcp.UDPSession, ip string) {
 	g.mu.Lock()
 	g.clients[sessionID] = client
 	g.mu.Unlock()
+	monitor.IncConnections()
 
 	log.Info().Uint64("session", sessionID).Str("ip", ip).Msg("new client connected")
 
 	// 启动读循环
 	defer func() {
+		// 断线视为离开房间，游戏服务器据此保存并移除玩家
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		g.leaveRoom(ctx, client)
 		g.mu.Lock()
 		delete(g.clients, sessionID)
-		if client.uid != 0 {
+		// 重复登录时新会话已替换索引，不能删除
+		if client.uid != 0 && g.clientsByUID[client.uid] == client {
 			delete(g.clientsByUID, client.uid)
 		}
 		g.mu.Unlock()
+		if client.uid != 0 {
+			g.releaseSession(ctx, client.uid, sessionID)
+		}
 		conn.Close()
+		monitor.DecConnections()
 		log.Info().Uint64("session", sessionID).Msg("client disconnected")
 	}()
 
 	// 读循环：处理消息
 	buf := make([]byte, 65536) // 最大消息长度
 	for {
-		// 设置心跳超时检查
-		conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+		// 读超时作为兜底，正常情况下由 heartbeatLoop 断开超时会话
+		conn.SetReadDeadline(time.Now().Add(g.heartbeatTimeout() + g.heartbeatInterval()))
 
 		n, err := conn.Read(buf)
 		if err != nil {
@@ -178,6 +167,7 @@ func (g *Gateway) handleClient(conn *kcp.UDPSession, ip string) {
 		// 处理消息（长度头 + FlatBuffers数据）
 		if err := g.processMessage(client, buf[:n]); err != nil {
 			log.Error().Err(err).Uint64("session", sessionID).Msg("process message error")
+			g.noticeProtocolError(client, err)
 			break
 		}
 
@@ -192,7 +182,8 @@ func (g *Gateway) handleClient(conn *kcp.UDPSession, ip string) {
 // 包格式：4字节长度（小端）+ FlatBuffers数据
 func (g *Gateway) processMessage(client *ClientSession, data []byte) error {
 	if !g.rateLimiter.Allow(client.remoteAddr) {
-		return errors.New("rate limit exceeded")
+		monitor.IncRateLimitDrop("packet")
+		return errRateLimited
 	}
 	if len(data) < 4 {
 		return errors.New("packet too short")
@@ -213,6 +204,16 @@ func (g *Gateway) processMessage(client *ClientSession, data []byte) error {
 		return errors.New("missing packet header")
 	}
 
+	monitor.ObservePacket(monitor.DirectionIn, msg.BodyType().String(), len(data))
+
+	// 校验魔数与协议版本
+	if err := g.checkHeader(client, header, msg.BodyType()); err != nil {
+		if errors.Is(err, errUnsupportedClient) {
+			g.rejectLegacyClient(client)
+		}
+		return err
+	}
+
 	// 获取 union 体的 table
 	var tab flatbuffers.Table
 	if !msg.Body(&tab) {
@@ -221,6 +222,11 @@ func (g *Gateway) processMessage(client *ClientSession, data []byte) error {
 
 	// 根据消息类型分发
 	switch msg.BodyType() {
+	case net_proto.AnyMessageHello:
+		req := net_proto.Hello{}
+		req.Init(tab.Bytes, tab.Pos)
+		return g.handleHello(client, header, &req)
+
 	case net_proto.AnyMessageAuthRequest:
 		req := net_proto.AuthRequest{}
 		req.Init(tab.Bytes, tab.Pos)
@@ -231,6 +237,14 @@ func (g *Gateway) processMessage(client *ClientSession, data []byte) error {
 		req.Init(tab.Bytes, tab.Pos)
 		return g.handleJoinRoom(client, header, &req)
 
+	case net_proto.AnyMessageLeaveRoom:
+		return g.handleLeaveRoom(client, header)
+
+	case net_proto.AnyMessageSwitchRoom:
+		req := net_proto.SwitchRoom{}
+		req.Init(tab.Bytes, tab.Pos)
+		return g.handleSwitchRoom(client, header, &req)
+
 	case net_proto.AnyMessageGameData:
 		req := net_proto.GameData{}
 		req.Init(tab.Bytes, tab.Pos)
@@ -249,24 +263,53 @@ func (g *Gateway) processMessage(client *ClientSession, data []byte) error {
 
 // handleAuth 处理认证请求
 func (g *Gateway) handleAuth(client *ClientSession, header *net_proto.PacketHeader, req *net_proto.AuthRequest) error {
+	ctx, span := tracing.Start(g.ctx, "gateway.handleAuth", trace.WithAttributes(
+		attribute.Int64("session.id", int64(client.sessionID)),
+	))
+	defer span.End()
+
+	// 已认证的会话不能再次认证，否则旧的 clientsByUID 索引与房间成员关系不会被清理
+	client.mu.RLock()
+	state := client.state
+	client.mu.RUnlock()
+	if state != SessionStateUnauthed {
+		monitor.ObserveAuth(false)
+		span.SetStatus(codes.Error, "already authenticated")
+		return g.sendAuthResponse(client, false, "already authenticated")
+	}
+
 	token := req.Token()
 	if token == nil {
+		monitor.ObserveAuth(false)
+		span.SetStatus(codes.Error, "missing token")
 		return g.sendAuthResponse(client, false, "missing token")
 	}
 
-	// 从内存数据库验证token并获取uid
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	uid, err := g.sessionDao.GetUidByAccessToken(ctx, string(token))
+	uid, family, twoFactor, err := g.verifyToken(ctx, token)
 	if err != nil {
-		log.Error().Err(err).Str("token", string(token)).Msg("token verification failed")
+		log.Error().Err(err).Str("token_hash", hashToken(token)).Msg("token verification failed")
+		monitor.ObserveAuth(false)
+		tracing.RecordError(span, err)
 		return g.sendAuthResponse(client, false, "invalid token")
 	}
+	span.SetAttributes(attribute.Int64("user.id", uid))
+
+	// 同一账号只允许一个会话在线
+	if err := g.claimSession(ctx, client, uid); err != nil {
+		monitor.ObserveAuth(false)
+		span.SetStatus(codes.Error, err.Error())
+		return g.sendAuthResponse(client, false, "already logged in elsewhere")
+	}
 
 	// 更新会话
 	client.mu.Lock()
 	client.uid = uid
+	client.tokenHash = hashToken(token)
+	client.family = family
+	client.twoFactor = twoFactor
 	client.state = SessionStateAuthed
 	client.mu.Unlock()
 
@@ -275,11 +318,44 @@ func (g *Gateway) handleAuth(client *ClientSession, header *net_proto.PacketHead
 	g.mu.Unlock()
 
 	log.Info().Int64("uid", uid).Uint64("session", client.sessionID).Msg("user authenticated")
+	monitor.ObserveAuth(true)
 
 	// 发送成功响应
 	return g.sendAuthResponse(client, true, "")
 }
 
+// verifyToken 验证访问令牌，返回 uid、令牌族ID与账号是否启用了两步验证
+// 签名令牌在本地校验，不访问内存数据库；随机令牌及没有对应公钥的签名令牌从内存数据库查询
+func (g *Gateway) verifyToken(ctx context.Context, token []byte) (int64, string, bool, error) {
+	if g.tokens != nil && IsSignedToken(token) {
+		claims, err := g.tokens.Verify(ctx, token)
+		if err == nil {
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String("token.format", "signed"))
+			return claims.UID, claims.SessionID, claims.MFA, nil
+		}
+		if !errors.Is(err, errTokenUnknownKey) {
+			return 0, "", false, err
+		}
+		log.Warn().Msg("no key for signed token, falling back to IMDB lookup")
+	}
+
+	uid, err := g.sessionDao.GetUidByAccessToken(ctx, string(token))
+	if err != nil {
+		return 0, "", false, err
+	}
+	// 令牌族读取失败时吊销只能按访问令牌哈希匹配
+	family, err := g.sessionDao.GetAccessFamily(ctx, string(token))
+	if err != nil {
+		log.Warn().Err(err).Int64("uid", uid).Msg("failed to get token family")
+	}
+	// 两步验证标记，读取失败时按未启用处理
+	twoFactor, err := g.sessionDao.TwoFactorEnabled(ctx, uid)
+	if err != nil {
+		log.Warn().Err(err).Int64("uid", uid).Msg("failed to get two-factor flag")
+	}
+	return uid, family, twoFactor, nil
+}
+
 // sendAuthResponse 发送认证响应
 func (g *Gateway) sendAuthResponse(client *ClientSession, success bool, errMsg string) error {
 	builder := flatbuffers.NewBuilder(256)
@@ -299,73 +375,115 @@ func (g *Gateway) sendAuthResponse(client *ClientSession, success bool, errMsg s
 
 // handleJoinRoom 处理加入房间请求
 func (g *Gateway) handleJoinRoom(client *ClientSession, header *net_proto.PacketHeader, req *net_proto.JoinRoom) error {
+	start := time.Now()
+	joined := false
+	defer func() { monitor.ObserveJoin(start, joined) }()
+
 	// 检查认证状态
 	client.mu.RLock()
 	uid := client.uid
 	state := client.state
 	client.mu.RUnlock()
 
+	ctx, span := tracing.Start(g.ctx, "gateway.handleJoinRoom", trace.WithAttributes(
+		attribute.Int64("user.id", uid),
+		attribute.String("join.mode", req.Mode().String()),
+	))
+	defer func() {
+		if !joined {
+			span.SetStatus(codes.Error, "join failed")
+		}
+		span.End()
+	}()
+
 	if state < SessionStateAuthed {
 		return g.sendJoinRoomResponse(client, false, 0, "", "not authenticated")
 	}
+	if state == SessionStateInRoom {
+		// 已在房间内需先离开，或使用 SwitchRoom
+		return g.sendJoinRoomResponse(client, false, 0, "", "already in room")
+	}
 
-	// 获取玩家rating（用于匹配）
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
+	targetRoomID, gameServerAddr, errMsg := g.matchRoom(ctx, uid, req.Mode(), req.TargetRoomId())
+	if errMsg != "" {
+		return g.sendJoinRoomResponse(client, false, 0, "", errMsg)
+	}
+	g.enterRoom(ctx, client, targetRoomID, gameServerAddr)
+
+	span.SetAttributes(attribute.Int64("room.id", int64(targetRoomID)), attribute.String("gs.addr", gameServerAddr))
+	log.Info().Int64("uid", uid).Uint64("room", targetRoomID).Str("gs", gameServerAddr).Msg("joined room")
+
+	// 发送响应
+	joined = true
+	return g.sendJoinRoomResponse(client, true, targetRoomID, gameServerAddr, "")
+}
+
+// matchRoom 按加入模式为玩家选定房间，失败时返回错误描述
+func (g *Gateway) matchRoom(ctx context.Context, uid int64, mode net_proto.GameMode, target uint64) (uint64, string, string) {
+	span := trace.SpanFromContext(ctx)
+
+	// 获取玩家rating（用于匹配）
 	rating, rd, err := g.roomDao.GetPlayerRating(ctx, uid)
 	if err != nil {
 		log.Error().Err(err).Int64("uid", uid).Msg("get player rating failed")
-		return g.sendJoinRoomResponse(client, false, 0, "", "internal error")
+		tracing.RecordError(span, err)
+		return 0, "", "internal error"
 	}
 
 	// 根据模式和rating匹配房间
-	mode := req.Mode()
 	var targetRoomID uint64
 	var gameServerAddr string
 
 	switch mode {
 	case net_proto.GameModeQuickMatch:
 		// 根据rating寻找合适的房间
-		targetRoomID, gameServerAddr = g.findRoomByRating(rating, rd)
+		targetRoomID, gameServerAddr = g.findRoomByRating(ctx, rating, rd)
 		if targetRoomID == 0 {
 			// 没有合适房间，创建新房间
-			targetRoomID, gameServerAddr = g.createRoomOnGameServer(rating)
+			targetRoomID, gameServerAddr = g.createRoomOnGameServer(ctx, rating)
+		}
+		if targetRoomID == 0 {
+			return 0, "", "no game server available"
 		}
 	case net_proto.GameModeSpecificRoom:
 		// 指定房间
-		targetRoomID = req.TargetRoomId()
+		targetRoomID = target
 		gameServerAddr = g.getGameServerForRoom(targetRoomID)
 		if gameServerAddr == "" {
-			return g.sendJoinRoomResponse(client, false, 0, "", "room not found")
+			return 0, "", "room not found"
 		}
 	default:
-		return g.sendJoinRoomResponse(client, false, 0, "", "invalid mode")
+		return 0, "", "invalid mode"
 	}
+	return targetRoomID, gameServerAddr, ""
+}
 
-	// 更新客户端状态
+// enterRoom 将会话置为房间内状态并增加房间人数
+func (g *Gateway) enterRoom(ctx context.Context, client *ClientSession, roomID uint64, gsAddr string) {
 	client.mu.Lock()
-	client.roomID = targetRoomID
-	client.gameServerAddr = gameServerAddr
+	client.roomID = roomID
+	client.gameServerAddr = gsAddr
 	client.state = SessionStateInRoom
 	client.mu.Unlock()
 
 	// 更新房间缓存人数
 	g.mu.Lock()
-	if room, ok := g.rooms[targetRoomID]; ok {
+	if room, ok := g.rooms[roomID]; ok {
 		room.PlayerCount++
 	}
 	g.mu.Unlock()
 
-	log.Info().Int64("uid", uid).Uint64("room", targetRoomID).Str("gs", gameServerAddr).Msg("joined room")
-
-	// 发送响应
-	return g.sendJoinRoomResponse(client, true, targetRoomID, gameServerAddr, "")
+	if err := g.roomDao.AdjustPlayerCount(ctx, roomID, 1); err != nil {
+		log.Warn().Err(err).Uint64("room", roomID).Msg("update room player count failed")
+	}
 }
 
 // findRoomByRating 根据评分寻找合适的房间
-func (g *Gateway) findRoomByRating(rating, rd float64) (uint64, string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (g *Gateway) findRoomByRating(ctx context.Context, rating, rd float64) (uint64, string) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 	rooms, err := g.roomDao.GetActiveRooms(ctx)
 	if err != nil {
@@ -379,6 +497,10 @@ func (g *Gateway) findRoomByRating(rating, rd float64) (uint64, string) {
 		if room.PlayerCount >= g.config.Play.MaxPlayersPerRoom {
 			continue
 		}
+		// 跳过所在服务器已下线、心跳超时或正在排空的房间
+		if !g.registry.Accepting(room.Addr) {
+			continue
+		}
 		// 根据评分差和 RD 计算匹配度
 		diff := abs(room.AvgRating - rating)
 		// 考虑 RD 因素
@@ -395,27 +517,50 @@ func (g *Gateway) findRoomByRating(rating, rd float64) (uint64, string) {
 }
 
 // createRoomOnGameServer 在某个游戏服务器上创建新房间
+// 通过 NATS request/reply 请求游戏服务器建房，收到确认后才登记房间；失败时换一台服务器重试
 // 返回新房间ID和游戏服务器地址
-func (g *Gateway) createRoomOnGameServer(initRating float64) (uint64, string) {
-	servers := g.config.GameServers
-	if len(servers) == 0 {
+func (g *Gateway) createRoomOnGameServer(ctx context.Context, initRating float64) (uint64, string) {
+	ctx, span := tracing.Start(ctx, "gateway.createRoom")
+	defer span.End()
+
+	roomID := uint64(time.Now().UnixNano())
+	var gsAddr string
+	var tried []string
+	for attempt := 0; attempt < createRoomAttempts; attempt++ {
+		addr := g.registry.PickServer(tried...)
+		if addr == "" {
+			break
+		}
+		if g.natsDao == nil {
+			gsAddr = addr
+			break
+		}
+		if err := g.natsDao.RequestCreateRoom(ctx, addr, roomID, initRating, createRoomTimeout); err != nil {
+			log.Warn().Err(err).Str("gs", addr).Uint64("room", roomID).Msg("create room request failed")
+			tried = append(tried, addr)
+			continue
+		}
+		gsAddr = addr
+		break
+	}
+	if gsAddr == "" {
 		log.Error().Msg("no game servers available")
+		span.SetStatus(codes.Error, "no game servers available")
 		return 0, ""
 	}
-	gsAddr := servers[0]
-	roomID := uint64(time.Now().UnixNano())
+	span.SetAttributes(attribute.Int64("room.id", int64(roomID)), attribute.String("gs.addr", gsAddr), attribute.Int("attempts", len(tried)+1))
 
 	// 保存到 Garnet
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	saveCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	err := g.roomDao.SaveRoom(ctx, roomID, gsAddr, initRating, 0)
+	err := g.roomDao.SaveRoom(saveCtx, roomID, gsAddr, initRating, 0)
 	if err != nil {
 		log.Error().Err(err).Msg("save room to imdb failed")
 	}
 
-	// 发送 NATS 通知
+	// 发布房间创建事件
 	if g.natsDao != nil {
-		if err := g.natsDao.PublishRoomCreated(roomID, gsAddr, initRating); err != nil {
+		if err := g.natsDao.PublishRoomCreated(ctx, roomID, gsAddr, initRating); err != nil {
 			log.Error().Err(err).Msg("publish room.created failed")
 		}
 	}
@@ -484,140 +629,90 @@ func (g *Gateway) handleGameData(client *ClientSession, header *net_proto.Packet
 		return nil
 	}
 
-	// 转发到对应的游戏服务器
-	go g.forwardGameData(gsAddr, roomID, uid, dataBytes)
+	// 同步入队转发：同一客户端的包由其读协程依次入队，保证到达游戏服务器的顺序
+	g.forwardGameData(gsAddr, roomID, uid, dataBytes)
 
 	return nil
 }
 
 // forwardGameData 将客户端游戏数据转发给游戏服务器
-// 转发格式：8字节房间ID + 8字节UID + 数据
 func (g *Gateway) forwardGameData(gsAddr string, roomID uint64, uid int64, data []byte) {
-	// 获取或创建到游戏服务器的连接
-	conn, err := g.getGameServerConn(gsAddr)
-	if err != nil {
-		log.Error().Err(err).Str("gs", gsAddr).Msg("failed to connect game server")
+	if !g.registry.Healthy(gsAddr) {
+		monitor.IncForwardError(gsAddr, "unhealthy")
+		log.Debug().Str("gs", gsAddr).Uint64("room", roomID).Int64("uid", uid).Msg("game server unhealthy, frame dropped")
 		return
 	}
-
-	// 构造转发包
-	buf := make([]byte, 16+len(data))
-	binary.BigEndian.PutUint64(buf[0:8], roomID)
-	binary.BigEndian.PutUint64(buf[8:16], uint64(uid))
-	copy(buf[16:], data)
-
-	// 发送数据
-	conn.mu.Lock()
-	defer conn.mu.Unlock()
-	_, err = conn.conn.Write(buf)
-	if err != nil {
-		log.Error().Err(err).Str("gs", gsAddr).Msg("forward data error")
-		// 从池中移除连接
-		g.removeGameServerConn(gsAddr)
+	link := g.getGameServerLink(gsAddr)
+	if !link.Send(encodeForwardFrame(roomID, uid, data)) {
+		monitor.IncForwardError(gsAddr, "queue_full")
+		log.Debug().Str("gs", gsAddr).Uint64("room", roomID).Int64("uid", uid).Msg("forward queue full, frame dropped")
 	}
 }
 
-// getGameServerConn 获取到游戏服务器的TCP连接
-func (g *Gateway) getGameServerConn(addr string) (*GameServerConnection, error) {
-	g.mu.Lock()
-	defer g.mu.Unlock()
-
-	if conn, ok := g.gameConns[addr]; ok {
-		return conn, nil
-	}
-
-	c, err := net.DialTimeout("tcp", addr, 5*time.Second)
-	if err != nil {
-		return nil, err
+// getGameServerLink 获取到游戏服务器的链路，不存在则创建（连接在后台建立）
+func (g *Gateway) getGameServerLink(addr string) *GameServerLink {
+	g.mu.RLock()
+	link, ok := g.gameLinks[addr]
+	g.mu.RUnlock()
+	if ok {
+		return link
 	}
-	gsConn := &GameServerConnection{conn: c}
-	g.gameConns[addr] = gsConn
-
-	// 启动下行数据接收协程
-	go g.handleGameServerDownlink(addr, c)
 
-	return gsConn, nil
-}
-
-func (g *Gateway) removeGameServerConn(addr string) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
-	if conn, ok := g.gameConns[addr]; ok {
-		conn.conn.Close()
-		delete(g.gameConns, addr)
+	if link, ok = g.gameLinks[addr]; ok {
+		return link
 	}
+	link = newGameServerLink(g.ctx, addr, g.config, encodeControlFrame(ctrlGatewayHello, []byte(g.id)), g.dispatchDownlink)
+	g.gameLinks[addr] = link
+	return link
 }
 
-// handleGameServerDownlink 处理从游戏服务器发来的下行数据
-func (g *Gateway) handleGameServerDownlink(gsAddr string, conn net.Conn) {
-	defer func() {
-		g.removeGameServerConn(gsAddr)
-		conn.Close()
-	}()
-
-	buf := make([]byte, 4096)
-	for {
-		// 读取4字节长度头
-		if _, err := io.ReadFull(conn, buf[:4]); err != nil {
-			log.Error().Err(err).Str("gs", gsAddr).Msg("read downlink length error")
-			return
-		}
-		msgLen := binary.LittleEndian.Uint32(buf[:4])
-		if msgLen > 65536 {
-			log.Error().Uint32("len", msgLen).Msg("downlink packet too large")
-			return
-		}
-		// 确保缓冲区足够
-		if cap(buf) < int(msgLen) {
-			buf = make([]byte, msgLen)
-		} else {
-			buf = buf[:msgLen]
-		}
-		if _, err := io.ReadFull(conn, buf); err != nil {
-			log.Error().Err(err).Msg("read downlink body error")
-			return
-		}
-
-		// 解析内部头部：8字节房间ID + 8字节目标UID + 数据
-		if msgLen < 16 {
-			log.Error().Msg("downlink packet too short")
-			continue
-		}
-		roomID := binary.BigEndian.Uint64(buf[:8])
-		targetUID := binary.BigEndian.Uint64(buf[8:16])
-		payload := buf[16:msgLen]
+// dispatchDownlink 处理从游戏服务器发来的下行帧
+// 帧格式：8字节房间ID + 8字节目标UID（0表示房间广播）+ 数据
+func (g *Gateway) dispatchDownlink(gsAddr string, frame []byte) {
+	if len(frame) < 16 {
+		log.Error().Str("gs", gsAddr).Msg("downlink packet too short")
+		return
+	}
+	roomID := binary.BigEndian.Uint64(frame[:8])
+	targetUID := binary.BigEndian.Uint64(frame[8:16])
+	payload := frame[16:]
+	if isControlFrame(roomID) {
+		g.handleControlDownlink(gsAddr, payload)
+		return
+	}
 
-		// 查找目标客户端并发送
+	if targetUID == 0 {
+		// 广播：收集房间内所有 client 的引用，然后逐个发送
+		var targets []*ClientSession
 		g.mu.RLock()
-		if targetUID == 0 {
-			// 广播：收集房间内所有 client 的引用，然后逐个发送
-			var targets []*ClientSession
-			g.mu.RLock()
-			for _, client := range g.clients {
-				client.mu.RLock()
-				if client.roomID == roomID && client.state == SessionStateInRoom {
-					targets = append(targets, client)
-				}
-				client.mu.RUnlock()
-			}
-			g.mu.RUnlock()
-			for _, client := range targets {
-				g.sendGameDataToClient(client, payload)
-			}
-		} else {
-			// 单播
-			g.mu.RLock()
-			client, ok := g.clientsByUID[int64(targetUID)]
-			g.mu.RUnlock()
-			if ok {
-				client.mu.RLock()
-				if client.roomID == roomID && client.state == SessionStateInRoom {
-					g.sendGameDataToClient(client, payload)
-				}
-				client.mu.RUnlock()
+		for _, client := range g.clients {
+			client.mu.RLock()
+			if client.roomID == roomID && client.state == SessionStateInRoom {
+				targets = append(targets, client)
 			}
+			client.mu.RUnlock()
 		}
 		g.mu.RUnlock()
+		for _, client := range targets {
+			g.sendGameDataToClient(client, payload)
+		}
+		return
+	}
+
+	// 单播
+	g.mu.RLock()
+	client, ok := g.clientsByUID[int64(targetUID)]
+	g.mu.RUnlock()
+	if !ok {
+		return
+	}
+	client.mu.RLock()
+	inRoom := client.roomID == roomID && client.state == SessionStateInRoom
+	client.mu.RUnlock()
+	if inRoom {
+		g.sendGameDataToClient(client, payload)
 	}
 }
 
@@ -632,30 +727,26 @@ func (g *Gateway) sendGameDataToClient(client *ClientSession, data []byte) {
 	g.buildAndSendMessage(client, net_proto.AnyMessageGameData, bodyOff, builder)
 }
 
-// handleHeartbeat 处理心跳
-func (g *Gateway) handleHeartbeat(client *ClientSession, header *net_proto.PacketHeader, req *net_proto.Heartbeat) error {
-	// 更新心跳时间
-	builder := flatbuffers.NewBuilder(32)
-	net_proto.HeartbeatStart(builder)
-	net_proto.HeartbeatAddPing(builder, req.Ping())
-	respOff := net_proto.HeartbeatEnd(builder)
-
-	return g.buildAndSendMessage(client, net_proto.AnyMessageHeartbeat, respOff, builder)
-}
-
 // buildAndSendMessage 构建并发送消息
 func (g *Gateway) buildAndSendMessage(client *ClientSession, msgType net_proto.AnyMessage, bodyOff flatbuffers.UOffsetT, builder *flatbuffers.Builder) error {
+	version := client.clientVersion()
+	// 旧版本客户端无法识别的消息直接丢弃
+	if !supportsMessage(version, msgType) {
+		log.Debug().Uint64("session", client.sessionID).Uint16("version", version).Str("type", msgType.String()).Msg("message not supported by client version, dropped")
+		return nil
+	}
+
 	// 构建 PacketHeader
 	headerOff := net_proto.CreatePacketHeader(
 		builder,
-		0x4B435057, // magic
-		1,          // version
-		0,          // flags
+		ProtocolMagic,
+		version,
+		0, // flags
 		client.sessionID,
 		client.roomID,
 		uint16(msgType),
-		0,                         // reserved
-		uint64(time.Now().Unix()), // timestamp
+		0, // reserved
+		headerTimestamp(version, time.Now()),
 	)
 
 	// 构建 Message table
@@ -675,8 +766,11 @@ func (g *Gateway) buildAndSendMessage(client *ClientSession, msgType net_proto.A
 	binary.LittleEndian.PutUint32(packet[:4], uint32(len(data)))
 	copy(packet[4:], data)
 
-	_, err := client.conn.Write(packet)
-	return err
+	if _, err := client.conn.Write(packet); err != nil {
+		return err
+	}
+	monitor.ObservePacket(monitor.DirectionOut, msgType.String(), len(packet))
+	return nil
 }
 
 // generateSessionID 生成唯一会话ID
@@ -707,7 +801,7 @@ func (g *Gateway) cleanIdleRooms() {
 
 					// 发布房间销毁通知
 					if g.natsDao != nil {
-						if err := g.natsDao.PublishRoomDestroyed(id); err != nil {
+						if err := g.natsDao.PublishRoomDestroyed(g.ctx, id, room.GameServer); err != nil {
 							log.Error().Err(err).Uint64("room", id).Msg("failed to publish room.destroyed")
 						}
 					}
@@ -718,6 +812,24 @@ func (g *Gateway) cleanIdleRooms() {
 	}
 }
 
+// Shutdown 通知所有客户端服务器即将停止，稍后关闭连接并停止网关
+func (g *Gateway) Shutdown() {
+	g.mu.RLock()
+	clients := make([]*ClientSession, 0, len(g.clients))
+	for _, c := range g.clients {
+		clients = append(clients, c)
+	}
+	g.mu.RUnlock()
+
+	n := Notice{Kind: net_proto.NoticeKindServerShutdown, Reason: net_proto.NoticeReasonServerShutdown}
+	for _, c := range clients {
+		_ = g.writeNotice(c, n, true)
+	}
+	log.Info().Int("clients", len(clients)).Msg("gateway shutting down")
+	time.Sleep(noticeCloseDelay)
+	g.Stop()
+}
+
 // Stop 停止网关
 func (g *Gateway) Stop() {
 	g.cancel()
@@ -726,10 +838,26 @@ func (g *Gateway) Stop() {
 	for _, client := range g.clients {
 		client.conn.Close()
 	}
-	for _, gsConn := range g.gameConns {
-		gsConn.conn.Close()
+	links := make([]*GameServerLink, 0, len(g.gameLinks))
+	for _, link := range g.gameLinks {
+		links = append(links, link)
 	}
 	g.mu.Unlock()
+
+	for _, link := range links {
+		link.Close()
+	}
+}
+
+// GatewayID 返回网关实例ID：优先使用配置，否则使用主机名
+func GatewayID(cfg *Config) string {
+	if cfg.Server.GatewayID != "" {
+		return cfg.Server.GatewayID
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return fmt.Sprintf("gateway-%d", os.Getpid())
 }
 
 // abs 浮点数绝对值
@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"encoding/binary"
+	"time"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/game_gateway/internal/monitor"
+	"github.com/zrurf/quiver/server/game_gateway/internal/proto/net_proto"
+)
+
+// 心跳默认参数（配置缺省时使用）
+const (
+	defaultHeartbeatInterval = 5 * time.Second
+	defaultHeartbeatTimeout  = 30 * time.Second
+)
+
+// rttEstimator 按 RFC 6298 的方式平滑 RTT，rttvar 即抖动
+type rttEstimator struct {
+	srtt    time.Duration
+	rttvar  time.Duration
+	samples int
+}
+
+// observe 记录一个 RTT 样本
+func (e *rttEstimator) observe(sample time.Duration) {
+	if e.samples == 0 {
+		e.srtt = sample
+		e.rttvar = sample / 2
+	} else {
+		delta := e.srtt - sample
+		if delta < 0 {
+			delta = -delta
+		}
+		e.rttvar += (delta - e.rttvar) / 4
+		e.srtt += (sample - e.srtt) / 8
+	}
+	e.samples++
+}
+
+// heartbeatInterval 网关发送心跳与检查超时的间隔
+func (g *Gateway) heartbeatInterval() time.Duration {
+	if d := g.config.Server.HeartbeatInterval; d > 0 {
+		return d
+	}
+	return defaultHeartbeatInterval
+}
+
+// heartbeatTimeout 会话在该时间内没有任何消息即被断开
+func (g *Gateway) heartbeatTimeout() time.Duration {
+	if d := g.config.Server.HeartbeatTimeout; d > 0 {
+		return d
+	}
+	return defaultHeartbeatTimeout
+}
+
+// heartbeatLoop 定期断开超时会话，并向已握手的客户端发送心跳以测量 RTT
+func (g *Gateway) heartbeatLoop() {
+	ticker := time.NewTicker(g.heartbeatInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-ticker.C:
+			g.reapSessions()
+		}
+	}
+}
+
+// reapSessions 检查所有会话：超时的关闭连接（读循环随即退出并清理会话），其余发送心跳并续期在线记录
+func (g *Gateway) reapSessions() {
+	g.mu.RLock()
+	clients := make([]*ClientSession, 0, len(g.clients))
+	for _, c := range g.clients {
+		clients = append(clients, c)
+	}
+	g.mu.RUnlock()
+
+	now := time.Now()
+	timeout := g.heartbeatTimeout()
+	online := make([]int64, 0, len(clients))
+	for _, c := range clients {
+		c.mu.RLock()
+		idle := now.Sub(c.lastHeartbeat)
+		version := c.version
+		uid := c.uid
+		c.mu.RUnlock()
+
+		if idle > timeout {
+			monitor.IncHeartbeatTimeout()
+			log.Info().Uint64("session", c.sessionID).Dur("idle", idle).Msg("session heartbeat timeout")
+			c.conn.Close()
+			continue
+		}
+		if uid != 0 {
+			online = append(online, uid)
+		}
+		if version >= ProtocolVersionCurrent {
+			g.sendPing(c, now)
+		} else if srtt := c.conn.GetSRTT(); srtt > 0 {
+			// 旧版客户端不响应网关心跳，以 KCP 的平滑 RTT 作为样本
+			g.observeRTT(c, time.Duration(srtt)*time.Millisecond)
+		}
+	}
+	g.refreshOnline(online)
+}
+
+// sendPing 向客户端发送网关心跳，客户端以 pong 回传 ping
+func (g *Gateway) sendPing(client *ClientSession, now time.Time) {
+	builder := flatbuffers.NewBuilder(32)
+	net_proto.HeartbeatStart(builder)
+	net_proto.HeartbeatAddPing(builder, uint64(now.UnixMilli()))
+	bodyOff := net_proto.HeartbeatEnd(builder)
+	if err := g.buildAndSendMessage(client, net_proto.AnyMessageHeartbeat, bodyOff, builder); err != nil {
+		log.Debug().Err(err).Uint64("session", client.sessionID).Msg("send heartbeat failed")
+	}
+}
+
+// handleHeartbeat 处理心跳
+// pong 非0时为客户端对网关心跳的回应，据此计算 RTT；ping 非0时为客户端发起的心跳，原样回传
+func (g *Gateway) handleHeartbeat(client *ClientSession, header *net_proto.PacketHeader, req *net_proto.Heartbeat) error {
+	if pong := req.Pong(); pong != 0 {
+		sample := time.Since(time.UnixMilli(int64(pong)))
+		if sample >= 0 && sample <= g.heartbeatTimeout() {
+			g.observeRTT(client, sample)
+		}
+	}
+	if req.Ping() == 0 {
+		return nil
+	}
+
+	builder := flatbuffers.NewBuilder(32)
+	net_proto.HeartbeatStart(builder)
+	net_proto.HeartbeatAddPing(builder, req.Ping())
+	respOff := net_proto.HeartbeatEnd(builder)
+
+	return g.buildAndSendMessage(client, net_proto.AnyMessageHeartbeat, respOff, builder)
+}
+
+// observeRTT 更新会话的平滑 RTT 与抖动，房间内的玩家同步给游戏服务器用于延迟补偿
+func (g *Gateway) observeRTT(client *ClientSession, sample time.Duration) {
+	monitor.ObserveRTT(sample)
+
+	client.mu.Lock()
+	client.rtt.observe(sample)
+	srtt, jitter := client.rtt.srtt, client.rtt.rttvar
+	inRoom := client.state == SessionStateInRoom
+	roomID, uid, gsAddr := client.roomID, client.uid, client.gameServerAddr
+	client.mu.Unlock()
+
+	if inRoom {
+		g.notifyPlayerLatency(gsAddr, roomID, uid, srtt, jitter)
+	}
+}
+
+// notifyPlayerLatency 通知游戏服务器玩家的网络延迟
+func (g *Gateway) notifyPlayerLatency(gsAddr string, roomID uint64, uid int64, srtt, jitter time.Duration) {
+	if gsAddr == "" || !g.registry.Healthy(gsAddr) {
+		return
+	}
+	body := make([]byte, 24)
+	binary.BigEndian.PutUint64(body[:8], roomID)
+	binary.BigEndian.PutUint64(body[8:16], uint64(uid))
+	binary.BigEndian.PutUint32(body[16:20], uint32(srtt.Microseconds()))
+	binary.BigEndian.PutUint32(body[20:24], uint32(jitter.Microseconds()))
+	if !g.getGameServerLink(gsAddr).Send(encodeControlFrame(ctrlPlayerLatency, body)) {
+		monitor.IncForwardError(gsAddr, "queue_full")
+	}
+}
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	sessionsDesc = prometheus.NewDesc(
+		"quiver_gateway_sessions",
+		"Client sessions by state.",
+		[]string{"state"}, nil,
+	)
+	gameServerConnectedDesc = prometheus.NewDesc(
+		"quiver_gateway_gameserver_connected",
+		"Whether the link to a game server is connected (1) or not (0).",
+		[]string{"gs"}, nil,
+	)
+	gameServerQueueDesc = prometheus.NewDesc(
+		"quiver_gateway_gameserver_queue_length",
+		"Frames waiting in the forward queue of a game server link.",
+		[]string{"gs"}, nil,
+	)
+	gameServerDroppedDesc = prometheus.NewDesc(
+		"quiver_gateway_gameserver_dropped_frames_total",
+		"Frames dropped because the forward queue of a game server link was full.",
+		[]string{"gs"}, nil,
+	)
+)
+
+var sessionStateNames = map[int]string{
+	SessionStateUnauthed: "unauthed",
+	SessionStateAuthed:   "authed",
+	SessionStateInRoom:   "in_room",
+}
+
+// gatewayCollector 在抓取时从网关当前状态生成指标（会话数、游戏服务器链路状态）
+type gatewayCollector struct {
+	g *Gateway
+}
+
+func newGatewayCollector(g *Gateway) *gatewayCollector {
+	return &gatewayCollector{g: g}
+}
+
+func (c *gatewayCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sessionsDesc
+	ch <- gameServerConnectedDesc
+	ch <- gameServerQueueDesc
+	ch <- gameServerDroppedDesc
+}
+
+func (c *gatewayCollector) Collect(ch chan<- prometheus.Metric) {
+	c.g.mu.RLock()
+	clients := make([]*ClientSession, 0, len(c.g.clients))
+	for _, client := range c.g.clients {
+		clients = append(clients, client)
+	}
+	links := make([]*GameServerLink, 0, len(c.g.gameLinks))
+	for _, link := range c.g.gameLinks {
+		links = append(links, link)
+	}
+	c.g.mu.RUnlock()
+
+	counts := make(map[int]int, len(sessionStateNames))
+	for _, client := range clients {
+		client.mu.RLock()
+		counts[client.state]++
+		client.mu.RUnlock()
+	}
+	for state, name := range sessionStateNames {
+		ch <- prometheus.MustNewConstMetric(sessionsDesc, prometheus.GaugeValue, float64(counts[state]), name)
+	}
+
+	for _, link := range links {
+		connected := 0.0
+		if link.Connected() {
+			connected = 1
+		}
+		ch <- prometheus.MustNewConstMetric(gameServerConnectedDesc, prometheus.GaugeValue, connected, link.addr)
+		ch <- prometheus.MustNewConstMetric(gameServerQueueDesc, prometheus.GaugeValue, float64(link.QueueLen()), link.addr)
+		ch <- prometheus.MustNewConstMetric(gameServerDroppedDesc, prometheus.CounterValue, float64(link.Dropped()), link.addr)
+	}
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// subscribeServerEvents 订阅游戏服务器的排空与房间迁移通知
+func (g *Gateway) subscribeServerEvents() {
+	if g.natsDao == nil {
+		return
+	}
+	if err := g.natsDao.SubscribeServerDraining(g.onServerDraining); err != nil {
+		log.Error().Err(err).Msg("failed to subscribe to gameserver.draining")
+	}
+	if err := g.natsDao.SubscribeRoomMigrate(g.onRoomMigrate); err != nil {
+		log.Error().Err(err).Msg("failed to subscribe to room.migrate")
+	}
+}
+
+// onServerDraining 游戏服务器进入排空模式：不再向其放置新房间，已有房间的数据照常转发
+func (g *Gateway) onServerDraining(ctx context.Context, addr string) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("gs.addr", addr))
+	log.Info().Str("gs", addr).Msg("game server draining")
+	g.registry.MarkDraining(addr)
+}
+
+// onRoomMigrate 房间迁移到其他服务器：更新房间缓存并将房间内玩家的后续数据改发到目标服务器
+// 目标服务器收到第一帧时从快照恢复房间，玩家无需重新加入
+func (g *Gateway) onRoomMigrate(ctx context.Context, roomID uint64, from, to string) {
+	g.mu.Lock()
+	if room, ok := g.rooms[roomID]; ok {
+		room.GameServer = to
+	}
+	clients := make([]*ClientSession, 0, len(g.clients))
+	for _, c := range g.clients {
+		clients = append(clients, c)
+	}
+	g.mu.Unlock()
+
+	moved := 0
+	for _, c := range clients {
+		c.mu.Lock()
+		if c.roomID == roomID && c.gameServerAddr == from {
+			c.gameServerAddr = to
+			moved++
+		}
+		c.mu.Unlock()
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int64("room.id", int64(roomID)),
+		attribute.String("gs.from", from),
+		attribute.String("gs.to", to),
+		attribute.Int("room.players_moved", moved),
+	)
+	log.Info().Uint64("room", roomID).Str("from", from).Str("to", to).Int("players", moved).Msg("room migrated")
+}
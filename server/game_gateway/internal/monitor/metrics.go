@@ -1,21 +1,126 @@
 package monitor
 
 import (
-	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "quiver_gateway"
+
+// 流量方向
+const (
+	DirectionIn  = "in"  // 客户端 -> 网关
+	DirectionOut = "out" // 网关 -> 客户端
 )
 
 var (
-	activeConnections int64
+	activeConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "connections",
+		Help:      "Active KCP connections.",
+	})
+
+	authTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_total",
+		Help:      "Authentication attempts by result.",
+	}, []string{"result"})
+
+	joinDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "join_room_duration_seconds",
+		Help:      "Time to handle a JoinRoom request, including matchmaking and room creation.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"result"})
+
+	packetsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "packets_total",
+		Help:      "Client packets by direction and message type.",
+	}, []string{"direction", "type"})
+
+	bytesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_total",
+		Help:      "Client bytes by direction and message type.",
+	}, []string{"direction", "type"})
+
+	rateLimitDrops = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_drops_total",
+		Help:      "Connections or packets rejected by the rate limiter.",
+	}, []string{"stage"})
+
+	heartbeatRTT = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "heartbeat_rtt_seconds",
+		Help:      "Round trip time measured from heartbeats.",
+		Buckets:   []float64{.005, .01, .02, .04, .06, .08, .1, .15, .2, .3, .5, 1},
+	})
+
+	heartbeatTimeouts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "heartbeat_timeouts_total",
+		Help:      "Sessions disconnected because no message arrived within the heartbeat timeout.",
+	})
+
+	forwardErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "forward_errors_total",
+		Help:      "Frames not forwarded to a game server, by reason.",
+	}, []string{"gs", "reason"})
 )
 
 func IncConnections() {
-	atomic.AddInt64(&activeConnections, 1)
+	activeConnections.Inc()
 }
 
 func DecConnections() {
-	atomic.AddInt64(&activeConnections, -1)
+	activeConnections.Dec()
+}
+
+// ObserveAuth 记录认证结果（success/failure）
+func ObserveAuth(success bool) {
+	if success {
+		authTotal.WithLabelValues("success").Inc()
+	} else {
+		authTotal.WithLabelValues("failure").Inc()
+	}
+}
+
+// ObserveJoin 记录加入房间耗时
+func ObserveJoin(start time.Time, success bool) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	joinDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// ObservePacket 记录一个客户端包
+func ObservePacket(direction, msgType string, size int) {
+	packetsTotal.WithLabelValues(direction, msgType).Inc()
+	bytesTotal.WithLabelValues(direction, msgType).Add(float64(size))
+}
+
+// IncRateLimitDrop 记录被限流拒绝的连接（connect）或包（packet）
+func IncRateLimitDrop(stage string) {
+	rateLimitDrops.WithLabelValues(stage).Inc()
+}
+
+// IncForwardError 记录转发失败
+func IncForwardError(gs, reason string) {
+	forwardErrors.WithLabelValues(gs, reason).Inc()
+}
+
+// ObserveRTT 记录一个心跳 RTT 样本
+func ObserveRTT(rtt time.Duration) {
+	heartbeatRTT.Observe(rtt.Seconds())
 }
 
-func GetActiveConnections() int64 {
-	return atomic.LoadInt64(&activeConnections)
+// IncHeartbeatTimeout 记录一次心跳超时断开
+func IncHeartbeatTimeout() {
+	heartbeatTimeouts.Inc()
 }
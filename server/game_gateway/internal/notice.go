@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/game_gateway/internal/proto/net_proto"
+)
+
+// 发送断线通知后等待 KCP 发出数据再关闭连接
+const noticeCloseDelay = 500 * time.Millisecond
+
+var errRateLimited = errors.New("rate limit exceeded")
+
+// Notice 下发给客户端的系统通知
+type Notice struct {
+	Kind     net_proto.NoticeKind
+	Reason   net_proto.NoticeReason
+	Message  string
+	Deadline time.Time // 维护开始/房间关闭/停服时间，零值表示无
+}
+
+// noticeFrame 游戏服务器经控制帧下发的通知（JSON）
+// kind/reason 为 net_proto 中的枚举名称；room_id 为 0 时发给该服务器上的所有玩家，uid 为 0 时发给房间内所有玩家
+type noticeFrame struct {
+	Kind     string `json:"kind"`
+	Reason   string `json:"reason"`
+	Message  string `json:"message"`
+	Deadline int64  `json:"deadline"` // 毫秒时间戳
+	RoomID   uint64 `json:"room_id"`
+	UID      int64  `json:"uid"`
+}
+
+// sendNotice 向客户端发送系统通知
+func (g *Gateway) sendNotice(client *ClientSession, n Notice) error {
+	return g.writeNotice(client, n, false)
+}
+
+// disconnectWithNotice 发送通知后断开连接，让客户端能够展示断线原因而不是等待超时
+func (g *Gateway) disconnectWithNotice(client *ClientSession, n Notice) {
+	if err := g.writeNotice(client, n, true); err != nil {
+		log.Debug().Err(err).Uint64("session", client.sessionID).Msg("send notice failed")
+		client.conn.Close()
+		return
+	}
+	time.AfterFunc(noticeCloseDelay, func() { client.conn.Close() })
+}
+
+func (g *Gateway) writeNotice(client *ClientSession, n Notice, disconnect bool) error {
+	builder := flatbuffers.NewBuilder(64 + len(n.Message))
+	msgOff := builder.CreateString(n.Message)
+	net_proto.SystemMessageStart(builder)
+	net_proto.SystemMessageAddMessage(builder, msgOff)
+	net_proto.SystemMessageAddKind(builder, n.Kind)
+	net_proto.SystemMessageAddReason(builder, n.Reason)
+	if !n.Deadline.IsZero() {
+		net_proto.SystemMessageAddDeadline(builder, uint64(n.Deadline.UnixMilli()))
+	}
+	net_proto.SystemMessageAddDisconnect(builder, disconnect)
+	bodyOff := net_proto.SystemMessageEnd(builder)
+
+	return g.buildAndSendMessage(client, net_proto.AnyMessageSystemMessage, bodyOff, builder)
+}
+
+// noticeProtocolError 连接因错误即将关闭时告知客户端原因（关闭连接时 KCP 会尽力发出）
+// 协议版本不受支持的客户端已收到更新提示，不再重复通知
+func (g *Gateway) noticeProtocolError(client *ClientSession, err error) {
+	if errors.Is(err, errUnsupportedClient) {
+		return
+	}
+	reason := net_proto.NoticeReasonProtocolError
+	if errors.Is(err, errRateLimited) {
+		reason = net_proto.NoticeReasonRateLimited
+	}
+	_ = g.writeNotice(client, Notice{Kind: net_proto.NoticeKindKicked, Reason: reason}, true)
+}
+
+// notifyClients 向满足条件的客户端发送通知，返回发送成功的数量
+func (g *Gateway) notifyClients(n Notice, match func(c *ClientSession) bool) int {
+	g.mu.RLock()
+	targets := make([]*ClientSession, 0, len(g.clients))
+	for _, c := range g.clients {
+		c.mu.RLock()
+		if c.state >= SessionStateAuthed && match(c) {
+			targets = append(targets, c)
+		}
+		c.mu.RUnlock()
+	}
+	g.mu.RUnlock()
+
+	sent := 0
+	for _, c := range targets {
+		if err := g.sendNotice(c, n); err != nil {
+			log.Debug().Err(err).Uint64("session", c.sessionID).Msg("send notice failed")
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+// handleNoticeFrame 处理游戏服务器下发的通知控制帧
+func (g *Gateway) handleNoticeFrame(gsAddr string, body []byte) {
+	var f noticeFrame
+	if err := json.Unmarshal(body, &f); err != nil {
+		log.Error().Err(err).Str("gs", gsAddr).Msg("invalid notice frame")
+		return
+	}
+	n := Notice{
+		Kind:    net_proto.EnumValuesNoticeKind[f.Kind],
+		Reason:  net_proto.EnumValuesNoticeReason[f.Reason],
+		Message: f.Message,
+	}
+	if f.Deadline > 0 {
+		n.Deadline = time.UnixMilli(f.Deadline)
+	}
+	sent := g.notifyClients(n, func(c *ClientSession) bool {
+		if c.state != SessionStateInRoom || c.gameServerAddr != gsAddr {
+			return false
+		}
+		if f.RoomID != 0 && c.roomID != f.RoomID {
+			return false
+		}
+		return f.UID == 0 || c.uid == f.UID
+	})
+	log.Info().Str("gs", gsAddr).Str("kind", f.Kind).Uint64("room", f.RoomID).Int("sent", sent).Msg("game server notice delivered")
+}
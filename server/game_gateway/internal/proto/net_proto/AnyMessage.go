@@ -7,33 +7,51 @@ import "strconv"
 type AnyMessage byte
 
 const (
-	AnyMessageNONE             AnyMessage = 0
-	AnyMessageAuthRequest      AnyMessage = 1
-	AnyMessageAuthResponse     AnyMessage = 2
-	AnyMessageJoinRoom         AnyMessage = 3
-	AnyMessageJoinRoomResponse AnyMessage = 4
-	AnyMessageGameData         AnyMessage = 5
-	AnyMessageHeartbeat        AnyMessage = 6
+	AnyMessageNONE              AnyMessage = 0
+	AnyMessageAuthRequest       AnyMessage = 1
+	AnyMessageAuthResponse      AnyMessage = 2
+	AnyMessageJoinRoom          AnyMessage = 3
+	AnyMessageJoinRoomResponse  AnyMessage = 4
+	AnyMessageGameData          AnyMessage = 5
+	AnyMessageHeartbeat         AnyMessage = 6
+	AnyMessageHello             AnyMessage = 7
+	AnyMessageHelloResponse     AnyMessage = 8
+	AnyMessageSystemMessage     AnyMessage = 9
+	AnyMessageLeaveRoom         AnyMessage = 10
+	AnyMessageLeaveRoomResponse AnyMessage = 11
+	AnyMessageSwitchRoom        AnyMessage = 12
 )
 
 var EnumNamesAnyMessage = map[AnyMessage]string{
-	AnyMessageNONE:             "NONE",
-	AnyMessageAuthRequest:      "AuthRequest",
-	AnyMessageAuthResponse:     "AuthResponse",
-	AnyMessageJoinRoom:         "JoinRoom",
-	AnyMessageJoinRoomResponse: "JoinRoomResponse",
-	AnyMessageGameData:         "GameData",
-	AnyMessageHeartbeat:        "Heartbeat",
+	AnyMessageNONE:              "NONE",
+	AnyMessageAuthRequest:       "AuthRequest",
+	AnyMessageAuthResponse:      "AuthResponse",
+	AnyMessageJoinRoom:          "JoinRoom",
+	AnyMessageJoinRoomResponse:  "JoinRoomResponse",
+	AnyMessageGameData:          "GameData",
+	AnyMessageHeartbeat:         "Heartbeat",
+	AnyMessageHello:             "Hello",
+	AnyMessageHelloResponse:     "HelloResponse",
+	AnyMessageSystemMessage:     "SystemMessage",
+	AnyMessageLeaveRoom:         "LeaveRoom",
+	AnyMessageLeaveRoomResponse: "LeaveRoomResponse",
+	AnyMessageSwitchRoom:        "SwitchRoom",
 }
 
 var EnumValuesAnyMessage = map[string]AnyMessage{
-	"NONE":             AnyMessageNONE,
-	"AuthRequest":      AnyMessageAuthRequest,
-	"AuthResponse":     AnyMessageAuthResponse,
-	"JoinRoom":         AnyMessageJoinRoom,
-	"JoinRoomResponse": AnyMessageJoinRoomResponse,
-	"GameData":         AnyMessageGameData,
-	"Heartbeat":        AnyMessageHeartbeat,
+	"NONE":              AnyMessageNONE,
+	"AuthRequest":       AnyMessageAuthRequest,
+	"AuthResponse":      AnyMessageAuthResponse,
+	"JoinRoom":          AnyMessageJoinRoom,
+	"JoinRoomResponse":  AnyMessageJoinRoomResponse,
+	"GameData":          AnyMessageGameData,
+	"Heartbeat":         AnyMessageHeartbeat,
+	"Hello":             AnyMessageHello,
+	"HelloResponse":     AnyMessageHelloResponse,
+	"SystemMessage":     AnyMessageSystemMessage,
+	"LeaveRoom":         AnyMessageLeaveRoom,
+	"LeaveRoomResponse": AnyMessageLeaveRoomResponse,
+	"SwitchRoom":        AnyMessageSwitchRoom,
 }
 
 func (v AnyMessage) String() string {
@@ -53,12 +53,27 @@ func (rcv *Heartbeat) MutatePing(n uint64) bool {
 	return rcv._tab.MutateUint64Slot(4, n)
 }
 
+func (rcv *Heartbeat) Pong() uint64 {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(6))
+	if o != 0 {
+		return rcv._tab.GetUint64(o + rcv._tab.Pos)
+	}
+	return 0
+}
+
+func (rcv *Heartbeat) MutatePong(n uint64) bool {
+	return rcv._tab.MutateUint64Slot(6, n)
+}
+
 func HeartbeatStart(builder *flatbuffers.Builder) {
-	builder.StartObject(1)
+	builder.StartObject(2)
 }
 func HeartbeatAddPing(builder *flatbuffers.Builder, ping uint64) {
 	builder.PrependUint64Slot(0, ping, 0)
 }
+func HeartbeatAddPong(builder *flatbuffers.Builder, pong uint64) {
+	builder.PrependUint64Slot(1, pong, 0)
+}
 func HeartbeatEnd(builder *flatbuffers.Builder) flatbuffers.UOffsetT {
 	return builder.EndObject()
 }
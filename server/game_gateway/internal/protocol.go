@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"errors"
+	"time"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/game_gateway/internal/proto/net_proto"
+)
+
+// 协议常量
+const (
+	ProtocolMagic uint32 = 0x4B435057 // 包头魔数
+
+	ProtocolVersionLegacy  uint16 = 1 // 旧版协议：无握手，直接发送 AuthRequest
+	ProtocolVersionCurrent uint16 = 2 // 当前协议：先 Hello 握手再认证
+)
+
+var (
+	errBadMagic          = errors.New("bad packet magic")
+	errVersionMismatch   = errors.New("protocol version mismatch")
+	errUnsupportedClient = errors.New("unsupported protocol version")
+)
+
+// messageSince 记录各消息类型首次出现的协议版本
+// 网关向旧版本客户端发送消息时，据此过滤对方无法识别的消息
+var messageSince = map[net_proto.AnyMessage]uint16{
+	net_proto.AnyMessageHello:             2,
+	net_proto.AnyMessageHelloResponse:     2,
+	net_proto.AnyMessageSystemMessage:     2,
+	net_proto.AnyMessageLeaveRoom:         2,
+	net_proto.AnyMessageLeaveRoomResponse: 2,
+	net_proto.AnyMessageSwitchRoom:        2,
+}
+
+// protocolRange 网关当前允许的协议版本区间（编译期支持范围与配置的交集）
+func (g *Gateway) protocolRange() (uint16, uint16) {
+	minVer, maxVer := ProtocolVersionLegacy, ProtocolVersionCurrent
+	if v := uint16(g.config.Protocol.MinVersion); v > minVer && v <= maxVer {
+		minVer = v
+	}
+	if v := uint16(g.config.Protocol.MaxVersion); v >= minVer && v < maxVer {
+		maxVer = v
+	}
+	return minVer, maxVer
+}
+
+// negotiateVersion 从客户端声明的版本列表中选出双方都支持的最高版本，没有则返回0
+func (g *Gateway) negotiateVersion(req *net_proto.Hello) uint16 {
+	minVer, maxVer := g.protocolRange()
+	var best uint16
+	for i := 0; i < req.SupportedVersionsLength(); i++ {
+		v := req.SupportedVersions(i)
+		if v >= minVer && v <= maxVer && v > best {
+			best = v
+		}
+	}
+	return best
+}
+
+// checkHeader 校验包头魔数与协议版本
+// 未握手的客户端若以旧版协议通信，则按旧版协议处理（兼容尚未升级的客户端）
+func (g *Gateway) checkHeader(client *ClientSession, header *net_proto.PacketHeader, bodyType net_proto.AnyMessage) error {
+	if header.Magic() != ProtocolMagic {
+		return errBadMagic
+	}
+
+	client.mu.Lock()
+	version := client.version
+	if version == 0 && bodyType != net_proto.AnyMessageHello {
+		minVer, _ := g.protocolRange()
+		if header.Version() != ProtocolVersionLegacy || minVer > ProtocolVersionLegacy {
+			client.mu.Unlock()
+			return errUnsupportedClient
+		}
+		client.version = ProtocolVersionLegacy
+		version = ProtocolVersionLegacy
+		log.Debug().Uint64("session", client.sessionID).Msg("legacy client without handshake")
+	}
+	client.mu.Unlock()
+
+	if version != 0 && header.Version() != version {
+		return errVersionMismatch
+	}
+	return nil
+}
+
+// handleHello 处理协议握手
+func (g *Gateway) handleHello(client *ClientSession, header *net_proto.PacketHeader, req *net_proto.Hello) error {
+	client.mu.RLock()
+	negotiated := client.version
+	client.mu.RUnlock()
+	if negotiated != 0 {
+		return errors.New("duplicate handshake")
+	}
+
+	version := g.negotiateVersion(req)
+	if version == 0 {
+		log.Warn().Uint64("session", client.sessionID).Str("client", string(req.ClientVersion())).Msg("client protocol version unsupported")
+		if err := g.sendHelloResponse(client, 0); err != nil {
+			return err
+		}
+		return errUnsupportedClient
+	}
+
+	client.mu.Lock()
+	client.version = version
+	client.mu.Unlock()
+
+	log.Info().Uint64("session", client.sessionID).Uint16("version", version).Str("client", string(req.ClientVersion())).Msg("protocol negotiated")
+	return g.sendHelloResponse(client, version)
+}
+
+// sendHelloResponse 发送握手响应，version为0表示握手失败
+func (g *Gateway) sendHelloResponse(client *ClientSession, version uint16) error {
+	minVer, maxVer := g.protocolRange()
+	builder := flatbuffers.NewBuilder(256)
+
+	var errOff, urlOff flatbuffers.UOffsetT
+	if version == 0 {
+		errOff = builder.CreateString("unsupported protocol version, please update the client")
+		if g.config.Protocol.UpdateURL != "" {
+			urlOff = builder.CreateString(g.config.Protocol.UpdateURL)
+		}
+	}
+
+	net_proto.HelloResponseStart(builder)
+	net_proto.HelloResponseAddSuccess(builder, version != 0)
+	net_proto.HelloResponseAddVersion(builder, version)
+	net_proto.HelloResponseAddMinVersion(builder, minVer)
+	net_proto.HelloResponseAddMaxVersion(builder, maxVer)
+	if errOff != 0 {
+		net_proto.HelloResponseAddErrorMessage(builder, errOff)
+	}
+	if urlOff != 0 {
+		net_proto.HelloResponseAddUpdateUrl(builder, urlOff)
+	}
+	respOff := net_proto.HelloResponseEnd(builder)
+
+	return g.buildAndSendMessage(client, net_proto.AnyMessageHelloResponse, respOff, builder)
+}
+
+// rejectLegacyClient 通知无法握手的旧版客户端更新
+// 旧版客户端不认识 HelloResponse，因此借用其能识别的 AuthResponse 携带提示
+// 包头按旧版协议生成（版本 1、秒级时间戳），否则旧版客户端无法解析
+func (g *Gateway) rejectLegacyClient(client *ClientSession) error {
+	client.mu.Lock()
+	client.version = ProtocolVersionLegacy
+	client.mu.Unlock()
+	msg := "unsupported protocol version, please update the client"
+	if g.config.Protocol.UpdateURL != "" {
+		msg += ": " + g.config.Protocol.UpdateURL
+	}
+	return g.sendAuthResponse(client, false, msg)
+}
+
+// clientVersion 返回发送给客户端时使用的协议版本
+// 尚未确定版本时（如握手失败）使用当前版本
+func (c *ClientSession) clientVersion() uint16 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.version == 0 {
+		return ProtocolVersionCurrent
+	}
+	return c.version
+}
+
+// supportsMessage 判断指定协议版本是否能识别该消息类型
+func supportsMessage(version uint16, msgType net_proto.AnyMessage) bool {
+	since, ok := messageSince[msgType]
+	return !ok || version >= since
+}
+
+// headerTimestamp 按协议版本生成包头时间戳：旧版协议为秒，新版协议为毫秒
+func headerTimestamp(version uint16, now time.Time) uint64 {
+	if version <= ProtocolVersionLegacy {
+		return uint64(now.Unix())
+	}
+	return uint64(now.UnixMilli())
+}
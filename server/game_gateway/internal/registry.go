@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/game_gateway/internal/dao"
+)
+
+// ServerRegistry 游戏服务器注册表的本地缓存
+// 定期从 IMDB 拉取游戏服务器上报的负载，用于新房间的放置与转发前的健康检查
+type ServerRegistry struct {
+	repo       *dao.RegistryRepository
+	static     []string // 配置文件中的静态服务器列表，注册表为空时使用
+	interval   time.Duration
+	staleAfter time.Duration
+
+	servers  map[string]dao.GameServerInfo
+	draining map[string]struct{} // 已通过 NATS 宣告排空、但注册表尚未刷新的服务器
+	mu       sync.RWMutex
+	next     atomic.Uint64 // 静态列表轮询游标
+}
+
+func NewServerRegistry(repo *dao.RegistryRepository, cfg *Config) *ServerRegistry {
+	interval := cfg.Registry.RefreshInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	staleAfter := cfg.Registry.StaleAfter
+	if staleAfter <= 0 {
+		staleAfter = 10 * time.Second
+	}
+	return &ServerRegistry{
+		repo:       repo,
+		static:     cfg.GameServers,
+		interval:   interval,
+		staleAfter: staleAfter,
+		servers:    make(map[string]dao.GameServerInfo),
+		draining:   make(map[string]struct{}),
+	}
+}
+
+// Run 定期刷新注册表，直到 ctx 结束
+func (r *ServerRegistry) Run(ctx context.Context) {
+	r.refresh(ctx)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.refresh(ctx)
+		}
+	}
+}
+
+func (r *ServerRegistry) refresh(ctx context.Context) {
+	if r.repo == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	list, err := r.repo.ListGameServers(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to refresh game server registry")
+		return
+	}
+
+	servers := make(map[string]dao.GameServerInfo, len(list))
+	for _, info := range list {
+		servers[info.Addr] = info
+	}
+
+	r.mu.Lock()
+	for addr := range r.servers {
+		if _, ok := servers[addr]; !ok {
+			log.Warn().Str("gs", addr).Msg("game server left registry")
+		}
+	}
+	for addr := range servers {
+		if _, ok := r.servers[addr]; !ok {
+			log.Info().Str("gs", addr).Msg("game server joined registry")
+		}
+	}
+	r.servers = servers
+	for addr := range r.draining {
+		if _, ok := servers[addr]; !ok {
+			delete(r.draining, addr)
+		}
+	}
+	r.mu.Unlock()
+}
+
+// fresh 注册信息是否仍在有效期内
+func (r *ServerRegistry) fresh(info dao.GameServerInfo, now time.Time) bool {
+	return now.Sub(time.Unix(info.UpdatedAt, 0)) <= r.staleAfter
+}
+
+// Healthy 判断游戏服务器是否可用
+// 注册表为空（游戏服务器未启用注册）时不做判断，视为可用
+func (r *ServerRegistry) Healthy(addr string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.servers) == 0 {
+		return true
+	}
+	info, ok := r.servers[addr]
+	return ok && r.fresh(info, time.Now())
+}
+
+// MarkDraining 标记服务器正在排空（收到排空通知后立即生效，无需等待注册表刷新）
+func (r *ServerRegistry) MarkDraining(addr string) {
+	r.mu.Lock()
+	r.draining[addr] = struct{}{}
+	r.mu.Unlock()
+}
+
+// isDraining 调用方需持有读锁
+func (r *ServerRegistry) isDraining(addr string, info dao.GameServerInfo) bool {
+	if info.Draining {
+		return true
+	}
+	_, ok := r.draining[addr]
+	return ok
+}
+
+// Servers 返回注册表快照，已宣告排空的服务器 Draining 为 true
+func (r *ServerRegistry) Servers() map[string]dao.GameServerInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	servers := make(map[string]dao.GameServerInfo, len(r.servers))
+	for addr, info := range r.servers {
+		info.Draining = r.isDraining(addr, info)
+		servers[addr] = info
+	}
+	return servers
+}
+
+// Accepting 判断服务器是否接收新玩家：健康且未在排空
+// 排空中的服务器仍可转发已有房间的数据（见 Healthy），但不应再有新玩家加入
+func (r *ServerRegistry) Accepting(addr string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.draining[addr]; ok {
+		return false
+	}
+	if len(r.servers) == 0 {
+		return true
+	}
+	info, ok := r.servers[addr]
+	return ok && r.fresh(info, time.Now()) && !info.Draining
+}
+
+// PickServer 为新房间选择游戏服务器
+// 在健康、未排空且未满载的服务器中选择负载最低的；注册表为空时轮询静态配置
+// exclude 中的服务器（如刚刚建房失败的服务器）不参与选择
+func (r *ServerRegistry) PickServer(exclude ...string) string {
+	r.mu.RLock()
+	now := time.Now()
+	var best string
+	var bestLoad float64
+	for addr, info := range r.servers {
+		if !r.fresh(info, now) || r.isDraining(addr, info) || slices.Contains(exclude, addr) {
+			continue
+		}
+		if info.MaxRooms > 0 && info.Rooms >= info.MaxRooms {
+			continue
+		}
+		load := serverLoad(info)
+		if best == "" || load < bestLoad {
+			best, bestLoad = addr, load
+		}
+	}
+	empty := len(r.servers) == 0
+	r.mu.RUnlock()
+
+	if best != "" || !empty {
+		return best
+	}
+	if len(r.static) == 0 {
+		return ""
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for range r.static {
+		addr := r.static[int(r.next.Add(1)-1)%len(r.static)]
+		if _, ok := r.draining[addr]; !ok && !slices.Contains(exclude, addr) {
+			return addr
+		}
+	}
+	return ""
+}
+
+// serverLoad 计算服务器负载评分（越小越空闲）
+// 以房间占用率为主，tick 超时的服务器额外加权，避免继续向已过载的服务器放置房间
+func serverLoad(info dao.GameServerInfo) float64 {
+	load := float64(info.Rooms)
+	if info.MaxRooms > 0 {
+		load = float64(info.Rooms) / float64(info.MaxRooms)
+	}
+	load += float64(info.Players) * 0.001
+	if info.TickOverrun > 0 {
+		load += 1
+	}
+	return load
+}
@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/game_gateway/internal/monitor"
+	"github.com/zrurf/quiver/server/game_gateway/internal/proto/net_proto"
+	"github.com/zrurf/quiver/server/game_gateway/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// handleLeaveRoom 处理离开房间请求，会话回到已认证状态
+func (g *Gateway) handleLeaveRoom(client *ClientSession, header *net_proto.PacketHeader) error {
+	client.mu.RLock()
+	state := client.state
+	client.mu.RUnlock()
+	if state != SessionStateInRoom {
+		return g.sendLeaveRoomResponse(client, false, 0, "not in room")
+	}
+
+	ctx, cancel := context.WithTimeout(g.ctx, 5*time.Second)
+	defer cancel()
+	roomID := g.leaveRoom(ctx, client)
+	return g.sendLeaveRoomResponse(client, true, roomID, "")
+}
+
+// handleSwitchRoom 处理切换房间请求
+// 先为玩家选定新房间，成功后才离开当前房间，匹配失败时玩家留在原房间
+func (g *Gateway) handleSwitchRoom(client *ClientSession, header *net_proto.PacketHeader, req *net_proto.SwitchRoom) error {
+	start := time.Now()
+	joined := false
+	defer func() { monitor.ObserveJoin(start, joined) }()
+
+	client.mu.RLock()
+	uid := client.uid
+	state := client.state
+	curRoomID := client.roomID
+	client.mu.RUnlock()
+
+	ctx, span := tracing.Start(g.ctx, "gateway.handleSwitchRoom", trace.WithAttributes(
+		attribute.Int64("user.id", uid),
+		attribute.String("join.mode", req.Mode().String()),
+		attribute.Int64("room.from", int64(curRoomID)),
+	))
+	defer func() {
+		if !joined {
+			span.SetStatus(codes.Error, "switch failed")
+		}
+		span.End()
+	}()
+
+	if state != SessionStateInRoom {
+		return g.sendJoinRoomResponse(client, false, 0, "", "not in room")
+	}
+	if req.Mode() == net_proto.GameModeSpecificRoom && req.TargetRoomId() == curRoomID {
+		return g.sendJoinRoomResponse(client, false, 0, "", "already in room")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	targetRoomID, gameServerAddr, errMsg := g.matchRoom(ctx, uid, req.Mode(), req.TargetRoomId())
+	if errMsg != "" {
+		return g.sendJoinRoomResponse(client, false, 0, "", errMsg)
+	}
+	if targetRoomID == curRoomID {
+		// 快速匹配选中了当前房间，无需切换
+		client.mu.RLock()
+		gameServerAddr = client.gameServerAddr
+		client.mu.RUnlock()
+		joined = true
+		return g.sendJoinRoomResponse(client, true, curRoomID, gameServerAddr, "")
+	}
+	g.leaveRoom(ctx, client)
+	g.enterRoom(ctx, client, targetRoomID, gameServerAddr)
+
+	span.SetAttributes(attribute.Int64("room.id", int64(targetRoomID)), attribute.String("gs.addr", gameServerAddr))
+	log.Info().Int64("uid", uid).Uint64("from", curRoomID).Uint64("room", targetRoomID).Str("gs", gameServerAddr).Msg("switched room")
+
+	joined = true
+	return g.sendJoinRoomResponse(client, true, targetRoomID, gameServerAddr, "")
+}
+
+// leaveRoom 让会话离开当前房间，返回离开的房间ID（不在房间内时返回0）
+// 通知游戏服务器保存并移除玩家，同时减少网关缓存与 Garnet 中的房间人数
+func (g *Gateway) leaveRoom(ctx context.Context, client *ClientSession) uint64 {
+	client.mu.Lock()
+	if client.state != SessionStateInRoom {
+		client.mu.Unlock()
+		return 0
+	}
+	uid := client.uid
+	roomID := client.roomID
+	gsAddr := client.gameServerAddr
+	client.roomID = 0
+	client.gameServerAddr = ""
+	client.state = SessionStateAuthed
+	client.mu.Unlock()
+
+	g.notifyPlayerLeave(gsAddr, roomID, uid)
+
+	g.mu.Lock()
+	if room, ok := g.rooms[roomID]; ok && room.PlayerCount > 0 {
+		room.PlayerCount--
+		if room.PlayerCount == 0 {
+			// 房间空闲计时从最后一名玩家离开时开始
+			room.ExpireAt = time.Now().Add(g.config.Server.IdleRoomTimeout)
+		}
+	}
+	g.mu.Unlock()
+
+	if err := g.roomDao.AdjustPlayerCount(ctx, roomID, -1); err != nil {
+		log.Warn().Err(err).Uint64("room", roomID).Msg("update room player count failed")
+	}
+	log.Info().Int64("uid", uid).Uint64("room", roomID).Str("gs", gsAddr).Msg("left room")
+	return roomID
+}
+
+// notifyPlayerLeave 通知游戏服务器玩家已离开房间
+// 服务器不可用时直接丢弃：房间停止或迁移时同样会保存玩家数据
+func (g *Gateway) notifyPlayerLeave(gsAddr string, roomID uint64, uid int64) {
+	if gsAddr == "" || !g.registry.Healthy(gsAddr) {
+		return
+	}
+	body := make([]byte, 16)
+	binary.BigEndian.PutUint64(body[:8], roomID)
+	binary.BigEndian.PutUint64(body[8:], uint64(uid))
+	if !g.getGameServerLink(gsAddr).Send(encodeControlFrame(ctrlPlayerLeave, body)) {
+		monitor.IncForwardError(gsAddr, "queue_full")
+		log.Warn().Str("gs", gsAddr).Uint64("room", roomID).Int64("uid", uid).Msg("forward queue full, player leave dropped")
+	}
+}
+
+// sendLeaveRoomResponse 发送离开房间响应
+func (g *Gateway) sendLeaveRoomResponse(client *ClientSession, success bool, roomID uint64, errMsg string) error {
+	builder := flatbuffers.NewBuilder(128)
+	var errOff flatbuffers.UOffsetT
+	if errMsg != "" {
+		errOff = builder.CreateString(errMsg)
+	}
+	net_proto.LeaveRoomResponseStart(builder)
+	net_proto.LeaveRoomResponseAddSuccess(builder, success)
+	net_proto.LeaveRoomResponseAddRoomId(builder, roomID)
+	if errMsg != "" {
+		net_proto.LeaveRoomResponseAddErrorMessage(builder, errOff)
+	}
+	respOff := net_proto.LeaveRoomResponseEnd(builder)
+	return g.buildAndSendMessage(client, net_proto.AnyMessageLeaveRoomResponse, respOff, builder)
+}
@@ -1,14 +1,18 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
 
 	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 	"github.com/xtaci/kcp-go/v5"
 	"github.com/zrurf/quiver/server/game_gateway/internal/dao"
+	"github.com/zrurf/quiver/server/game_gateway/internal/monitor"
 )
 
 func StartHealthCheck(addr string) {
@@ -16,6 +20,7 @@ func StartHealthCheck(addr string) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
+	http.Handle("/metrics", promhttp.Handler())
 	if addr == "" {
 		addr = ":8080"
 	}
@@ -25,7 +30,8 @@ func StartHealthCheck(addr string) {
 	}
 }
 
-func StartKCPGateway(cfg *Config, sessionDao *dao.SessionRepository, roomDao *dao.RoomRepository, natsClient *dao.NatsClient) {
+// StartKCPGateway 启动 KCP 网关，阻塞直到 ctx 结束；结束时通知所有客户端后关闭连接
+func StartKCPGateway(ctx context.Context, cfg *Config, sessionDao *dao.SessionRepository, roomDao *dao.RoomRepository, registryDao *dao.RegistryRepository, natsClient *dao.NatsClient) {
 	addr := fmt.Sprintf(":%d", cfg.Server.KCPPort)
 	listener, err := kcp.ListenWithOptions(addr, nil, 0, 0)
 	if err != nil {
@@ -39,13 +45,33 @@ func StartKCPGateway(cfg *Config, sessionDao *dao.SessionRepository, roomDao *da
 	defer decoder.Close()
 	defer encoder.Close()
 
-	gateway := NewGateway(cfg, sessionDao, roomDao, natsClient)
+	gateway := NewGateway(cfg, sessionDao, roomDao, registryDao, natsClient)
+	go gateway.registry.Run(gateway.ctx)
+	if gateway.tokens != nil {
+		// 拉取验签公钥并同步吊销列表（网关重启或错过 session.kick 时以 IMDB 为准）
+		go gateway.tokens.Run(gateway.ctx)
+	}
+	go gateway.cleanIdleRooms()
+	go gateway.heartbeatLoop()
+	prometheus.MustRegister(newGatewayCollector(gateway))
+	gateway.subscribeServerEvents()
+	gateway.subscribeSessionEvents()
+	go StartAdminServer(cfg, gateway)
 
 	log.Info().Msgf("KCP gateway listening on %s", addr)
 
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
 	for {
 		conn, err := listener.AcceptKCP()
 		if err != nil {
+			if ctx.Err() != nil {
+				gateway.Shutdown()
+				return
+			}
 			log.Error().Err(err).Msg("accept KCP connection error")
 			continue
 		}
@@ -59,6 +85,7 @@ func StartKCPGateway(cfg *Config, sessionDao *dao.SessionRepository, roomDao *da
 
 		// 限流
 		if !gateway.rateLimiter.Allow(ip) {
+			monitor.IncRateLimitDrop("connect")
 			log.Warn().Str("ip", ip).Msg("rate limit exceeded, closing connection")
 			conn.Close()
 			continue
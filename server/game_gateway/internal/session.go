@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/game_gateway/internal/dao"
+	"github.com/zrurf/quiver/server/game_gateway/internal/proto/net_proto"
+)
+
+// 同一账号重复登录时的处理策略（session.duplicate-login）
+const (
+	DuplicateLoginKickOldest   = "kick-oldest"   // 断开已在线的会话，新会话登录成功
+	DuplicateLoginRejectNewest = "reject-newest" // 已有会话在线时拒绝新会话
+)
+
+var errAlreadyOnline = errors.New("account already online")
+
+// onlineTTL 在线记录有效期，由心跳循环续期；网关异常退出后记录在该时间后失效
+func (g *Gateway) onlineTTL() time.Duration {
+	return 2 * g.heartbeatTimeout()
+}
+
+// claimSession 按重复登录策略登记账号的在线会话
+// 本网关上的旧会话按 clientsByUID 与在线记录中的会话ID断开（并发认证时前者可能尚未登记）
+// 其他网关上的旧会话通过 NATS 通知其所在网关断开；Garnet 不可用时只在本网关内保证单会话
+func (g *Gateway) claimSession(ctx context.Context, client *ClientSession, uid int64) error {
+	replace := g.config.Session.DuplicateLogin != DuplicateLoginRejectNewest
+
+	g.mu.RLock()
+	old := g.clientsByUID[uid]
+	g.mu.RUnlock()
+	if old == client {
+		old = nil
+	}
+	if old != nil && !replace {
+		return errAlreadyOnline
+	}
+
+	rec := dao.OnlineSession{Gateway: g.id, SessionID: client.sessionID, Since: time.Now().UnixMilli()}
+	prev, claimed, err := g.sessionDao.ClaimOnline(ctx, uid, rec, g.onlineTTL(), replace)
+	if err != nil {
+		log.Warn().Err(err).Int64("uid", uid).Msg("claim online session failed")
+	} else if !claimed {
+		return errAlreadyOnline
+	}
+
+	kick := Notice{Kind: net_proto.NoticeKindKicked, Reason: net_proto.NoticeReasonDuplicateLogin}
+	if old != nil {
+		log.Info().Int64("uid", uid).Uint64("session", old.sessionID).Uint64("new_session", client.sessionID).Msg("duplicate login, kicking old session")
+		g.disconnectWithNotice(old, kick)
+	}
+	if prev != nil && prev.Gateway == g.id && prev.SessionID != client.sessionID {
+		// 本网关上并发认证时旧会话可能尚未登记到 clientsByUID，按在线记录中的会话ID断开
+		g.mu.RLock()
+		local := g.clients[prev.SessionID]
+		g.mu.RUnlock()
+		if local != nil && local != old && local != client {
+			log.Info().Int64("uid", uid).Uint64("session", prev.SessionID).Uint64("new_session", client.sessionID).Msg("duplicate login, kicking concurrent session")
+			g.disconnectWithNotice(local, kick)
+		}
+	}
+	if prev != nil && prev.Gateway != g.id && g.natsDao != nil {
+		log.Info().Int64("uid", uid).Str("gateway", prev.Gateway).Uint64("session", prev.SessionID).Msg("duplicate login on another gateway")
+		if err := g.natsDao.PublishSessionKick(ctx, dao.SessionKickEvent{
+			UID:       uid,
+			Gateway:   prev.Gateway,
+			SessionID: prev.SessionID,
+			Reason:    kick.Reason.String(),
+		}); err != nil {
+			log.Error().Err(err).Int64("uid", uid).Msg("publish session.kick failed")
+		}
+	}
+	return nil
+}
+
+// releaseSession 会话断开后删除其在线记录（已被新会话替换时保留）
+func (g *Gateway) releaseSession(ctx context.Context, uid int64, sessionID uint64) {
+	if err := g.sessionDao.ReleaseOnline(ctx, uid, dao.OnlineSession{Gateway: g.id, SessionID: sessionID}); err != nil {
+		log.Warn().Err(err).Int64("uid", uid).Msg("release online session failed")
+	}
+}
+
+// refreshOnline 为本网关上已认证的账号续期在线记录
+func (g *Gateway) refreshOnline(uids []int64) {
+	ctx, cancel := context.WithTimeout(g.ctx, 2*time.Second)
+	defer cancel()
+	if err := g.sessionDao.RefreshOnline(ctx, uids, g.onlineTTL()); err != nil {
+		log.Warn().Err(err).Int("sessions", len(uids)).Msg("refresh online sessions failed")
+	}
+}
+
+// hashToken 访问令牌的 SHA-256 十六进制，与用户服务器吊销令牌时发布的 token_hash 对应
+func hashToken(token []byte) string {
+	sum := sha256.Sum256(token)
+	return hex.EncodeToString(sum[:])
+}
+
+// subscribeSessionEvents 订阅会话断开通知
+func (g *Gateway) subscribeSessionEvents() {
+	if g.natsDao == nil {
+		return
+	}
+	if err := g.natsDao.SubscribeSessionKick(g.onSessionKick); err != nil {
+		log.Error().Err(err).Msg("failed to subscribe to session.kick")
+	}
+}
+
+// matchesToken 会话是否由 ev 指定的令牌族（或访问令牌）认证，调用方持有 c.mu
+// 令牌族在刷新轮换后不变；认证时未能取得令牌族的会话按访问令牌哈希匹配
+func (c *ClientSession) matchesToken(ev dao.SessionKickEvent) bool {
+	switch {
+	case ev.Family == "" && ev.TokenHash == "":
+		return true
+	case ev.Family != "" && c.family != "":
+		return c.family == ev.Family
+	default:
+		return ev.TokenHash != "" && c.tokenHash == ev.TokenHash
+	}
+}
+
+// onSessionKick 断开本网关上符合条件的会话
+func (g *Gateway) onSessionKick(ctx context.Context, ev dao.SessionKickEvent) {
+	if g.tokens != nil {
+		g.tokens.Revoke(ev.RevokedTokens...)
+	}
+	if ev.Gateway != "" && ev.Gateway != g.id {
+		return
+	}
+	g.mu.RLock()
+	var targets []*ClientSession
+	for _, c := range g.clients {
+		c.mu.RLock()
+		if c.uid == ev.UID && (ev.SessionID == 0 || c.sessionID == ev.SessionID) && c.matchesToken(ev) {
+			targets = append(targets, c)
+		}
+		c.mu.RUnlock()
+	}
+	g.mu.RUnlock()
+
+	n := Notice{Kind: net_proto.NoticeKindKicked, Reason: net_proto.EnumValuesNoticeReason[ev.Reason], Message: ev.Message}
+	if n.Reason == net_proto.NoticeReasonBanned {
+		n.Kind = net_proto.NoticeKindBanned
+	}
+	for _, c := range targets {
+		log.Info().Int64("uid", ev.UID).Uint64("session", c.sessionID).Str("reason", ev.Reason).Msg("session kicked")
+		g.disconnectWithNotice(c, n)
+	}
+}
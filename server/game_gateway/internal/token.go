@@ -0,0 +1,306 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/game_gateway/internal/dao"
+)
+
+const (
+	signedTokenAlg      = "EdDSA"
+	tokenKeysPath       = "/api/auth/keys"
+	tokenKeysTimeout    = 5 * time.Second
+	tokenKeysRetryAfter = 10 * time.Second // 遇到未知密钥ID时重新拉取公钥的最小间隔
+)
+
+var (
+	errTokenInvalid    = errors.New("invalid signed token")
+	errTokenExpired    = errors.New("signed token expired")
+	errTokenRevoked    = errors.New("signed token revoked")
+	errTokenScope      = errors.New("signed token missing required scope")
+	errTokenUnknownKey = errors.New("signed token key unknown")
+)
+
+// TokenClaims 用户服务器签发的访问令牌载荷
+type TokenClaims struct {
+	UID       int64  `json:"uid"`
+	SessionID string `json:"sid"` // 令牌族ID
+	Scope     string `json:"scope"`
+	MFA       bool   `json:"mfa"`
+	ID        string `json:"jti"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// tokenKey 用户服务器公开的验签公钥（JWK）
+type tokenKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	Kid string `json:"kid"`
+	X   string `json:"x"`
+}
+
+// IsSignedToken 签名令牌为 header.payload.signature 三段，随机令牌不含 '.'
+func IsSignedToken(token []byte) bool {
+	return bytes.Count(token, []byte{'.'}) == 2
+}
+
+// TokenVerifier 在本地校验签名访问令牌
+// 公钥从用户服务器拉取并缓存，吊销列表定期从 IMDB 同步，同步失败时沿用上次的结果
+type TokenVerifier struct {
+	repo           *dao.SessionRepository
+	keysURL        string
+	keysRefresh    time.Duration
+	revocationSync time.Duration
+	requiredScope  string
+	client         *http.Client
+
+	keys      map[string]ed25519.PublicKey // kid -> 公钥
+	revoked   map[string]struct{}          // 令牌哈希
+	lastFetch time.Time                    // 上次拉取公钥的时间（无论成功与否）
+	mu        sync.RWMutex
+	fetchMu   sync.Mutex
+}
+
+func NewTokenVerifier(repo *dao.SessionRepository, cfg *Config) *TokenVerifier {
+	keysURL := cfg.Token.KeysURL
+	if keysURL == "" && cfg.UserServer.URL != "" {
+		keysURL = strings.TrimRight(cfg.UserServer.URL, "/") + tokenKeysPath
+	}
+	keysRefresh := cfg.Token.KeysRefresh
+	if keysRefresh <= 0 {
+		keysRefresh = 10 * time.Minute
+	}
+	revocationSync := cfg.Token.RevocationSync
+	if revocationSync <= 0 {
+		revocationSync = 5 * time.Second
+	}
+	return &TokenVerifier{
+		repo:           repo,
+		keysURL:        keysURL,
+		keysRefresh:    keysRefresh,
+		revocationSync: revocationSync,
+		requiredScope:  cfg.Token.RequiredScope,
+		client:         &http.Client{Timeout: tokenKeysTimeout},
+		keys:           make(map[string]ed25519.PublicKey),
+		revoked:        make(map[string]struct{}),
+	}
+}
+
+// Run 定期拉取公钥与同步吊销列表，直到 ctx 结束
+func (v *TokenVerifier) Run(ctx context.Context) {
+	v.refreshKeys(ctx)
+	v.syncRevocations(ctx)
+	keysTicker := time.NewTicker(v.keysRefresh)
+	defer keysTicker.Stop()
+	syncTicker := time.NewTicker(v.revocationSync)
+	defer syncTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keysTicker.C:
+			v.refreshKeys(ctx)
+		case <-syncTicker.C:
+			v.syncRevocations(ctx)
+		}
+	}
+}
+
+// refreshKeys 从用户服务器拉取公钥，失败时保留已缓存的公钥
+func (v *TokenVerifier) refreshKeys(ctx context.Context) {
+	v.fetchMu.Lock()
+	defer v.fetchMu.Unlock()
+	v.updateKeys(ctx)
+}
+
+// retryKeys 与 refreshKeys 相同，但距上次拉取不足 tokenKeysRetryAfter 时跳过（并发的认证请求只拉取一次）
+func (v *TokenVerifier) retryKeys(ctx context.Context) {
+	v.fetchMu.Lock()
+	defer v.fetchMu.Unlock()
+	v.mu.RLock()
+	last := v.lastFetch
+	v.mu.RUnlock()
+	if time.Since(last) < tokenKeysRetryAfter {
+		return
+	}
+	v.updateKeys(ctx)
+}
+
+func (v *TokenVerifier) updateKeys(ctx context.Context) {
+	if v.keysURL == "" {
+		return
+	}
+	v.mu.Lock()
+	v.lastFetch = time.Now()
+	v.mu.Unlock()
+
+	keys, err := v.fetchKeys(ctx)
+	if err != nil {
+		log.Error().Err(err).Str("url", v.keysURL).Msg("failed to fetch token keys")
+		return
+	}
+	v.mu.Lock()
+	for kid := range keys {
+		if _, ok := v.keys[kid]; !ok {
+			log.Info().Str("kid", kid).Msg("token key added")
+		}
+	}
+	v.keys = keys
+	v.mu.Unlock()
+}
+
+func (v *TokenVerifier) fetchKeys(ctx context.Context) (map[string]ed25519.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.keysURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	// 用户服务器的统一响应格式，公钥集合在 payload 中
+	var body struct {
+		Payload struct {
+			Keys []tokenKey `json:"keys"`
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode token keys: %w", err)
+	}
+	keys := make(map[string]ed25519.PublicKey, len(body.Payload.Keys))
+	for _, k := range body.Payload.Keys {
+		if k.Kty != "OKP" || k.Crv != "Ed25519" {
+			continue
+		}
+		pub, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			log.Warn().Str("kid", k.Kid).Msg("skip malformed token key")
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+// syncRevocations 从 IMDB 同步吊销列表，IMDB 不可用时沿用本地列表
+func (v *TokenVerifier) syncRevocations(ctx context.Context) {
+	if v.repo == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	list, err := v.repo.ListRevocations(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to sync token revocations, keeping local list")
+		return
+	}
+	revoked := make(map[string]struct{}, len(list))
+	for _, hash := range list {
+		revoked[hash] = struct{}{}
+	}
+	v.mu.Lock()
+	v.revoked = revoked
+	v.mu.Unlock()
+}
+
+// Revoke 立即吊销令牌（来自 session.kick 事件），下次同步时以 IMDB 为准
+func (v *TokenVerifier) Revoke(hashes ...string) {
+	if len(hashes) == 0 {
+		return
+	}
+	v.mu.Lock()
+	for _, hash := range hashes {
+		v.revoked[hash] = struct{}{}
+	}
+	v.mu.Unlock()
+}
+
+// Verify 校验签名、有效期、权限范围与吊销列表，返回令牌载荷
+// 没有对应公钥时返回 errTokenUnknownKey，调用方可改为查询 IMDB
+func (v *TokenVerifier) Verify(ctx context.Context, token []byte) (*TokenClaims, error) {
+	parts := bytes.Split(token, []byte{'.'})
+	if len(parts) != 3 {
+		return nil, errTokenInvalid
+	}
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != signedTokenAlg {
+		return nil, errTokenInvalid
+	}
+	sig := make([]byte, base64.RawURLEncoding.DecodedLen(len(parts[2])))
+	n, err := base64.RawURLEncoding.Decode(sig, parts[2])
+	if err != nil {
+		return nil, errTokenInvalid
+	}
+
+	key, ok := v.key(ctx, header.Kid)
+	if !ok {
+		return nil, errTokenUnknownKey
+	}
+	if !ed25519.Verify(key, token[:len(parts[0])+1+len(parts[1])], sig[:n]) {
+		return nil, errTokenInvalid
+	}
+	var claims TokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil || claims.UID <= 0 {
+		return nil, errTokenInvalid
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errTokenExpired
+	}
+	if v.requiredScope != "" && !slices.Contains(strings.Fields(claims.Scope), v.requiredScope) {
+		return nil, errTokenScope
+	}
+	v.mu.RLock()
+	_, revoked := v.revoked[hashToken(token)]
+	v.mu.RUnlock()
+	if revoked {
+		return nil, errTokenRevoked
+	}
+	return &claims, nil
+}
+
+// key 查找公钥，未知的密钥ID（用户服务器刚轮换密钥）触发一次重新拉取，间隔不小于 tokenKeysRetryAfter
+func (v *TokenVerifier) key(ctx context.Context, kid string) (ed25519.PublicKey, bool) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	last := v.lastFetch
+	v.mu.RUnlock()
+	if ok || time.Since(last) < tokenKeysRetryAfter {
+		return key, ok
+	}
+	v.retryKeys(ctx)
+	v.mu.RLock()
+	key, ok = v.keys[kid]
+	v.mu.RUnlock()
+	return key, ok
+}
+
+func decodeSegment(seg []byte, v any) error {
+	data := make([]byte, base64.RawURLEncoding.DecodedLen(len(seg)))
+	n, err := base64.RawURLEncoding.Decode(data, seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data[:n], v)
+}
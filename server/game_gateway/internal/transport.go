@@ -0,0 +1,300 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// 内部传输参数
+const (
+	linkDialTimeout    = 5 * time.Second
+	linkWriteTimeout   = 5 * time.Second
+	linkEnqueueTimeout = 50 * time.Millisecond // block 策略下入队的最长等待时间
+	linkMaxBackoff     = 5 * time.Second
+	linkKeepalive      = 10 * time.Second // 空闲超过该时间发送保活帧，避免游戏服务器读超时断开
+	linkMaxFrameSize   = 65536
+)
+
+// 队列满时的处理策略
+const (
+	DropPolicyNewest = "drop-newest" // 丢弃新帧
+	DropPolicyOldest = "drop-oldest" // 丢弃队首最旧的帧
+	DropPolicyBlock  = "block"       // 短暂等待，超时后丢弃新帧
+)
+
+var errLinkClosed = errors.New("game server link closed")
+
+// GameServerLink 到单个游戏服务器的内部传输链路
+// 所有发往该服务器的帧经由同一个写协程按入队顺序发送，因此同一客户端的包保持有序；
+// 写协程会把队列中积压的小帧合并为一次写入，断线后自动重连
+type GameServerLink struct {
+	addr       string
+	queue      chan []byte
+	batchBytes int
+	policy     string
+	hello      []byte                          // 每次建立连接后首先发送的握手帧
+	onDownlink func(addr string, frame []byte) // 下行帧回调（不含长度头）
+
+	conn      net.Conn
+	connMu    sync.Mutex
+	connected atomic.Bool
+	dropped   atomic.Uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newGameServerLink 创建链路并启动后台连接协程
+func newGameServerLink(parent context.Context, addr string, cfg *Config, hello []byte, onDownlink func(string, []byte)) *GameServerLink {
+	queueSize := cfg.Transport.QueueSize
+	if queueSize <= 0 {
+		queueSize = 4096
+	}
+	batchBytes := cfg.Transport.BatchBytes
+	if batchBytes <= 0 {
+		batchBytes = 16 * 1024
+	}
+	policy := cfg.Transport.DropPolicy
+	switch policy {
+	case DropPolicyNewest, DropPolicyOldest, DropPolicyBlock:
+	default:
+		policy = DropPolicyNewest
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	l := &GameServerLink{
+		addr:       addr,
+		queue:      make(chan []byte, queueSize),
+		batchBytes: batchBytes,
+		policy:     policy,
+		hello:      hello,
+		onDownlink: onDownlink,
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// encodeForwardFrame 构造转发帧
+// 帧格式：4字节长度（小端）+ 8字节房间ID + 8字节UID + 数据
+func encodeForwardFrame(roomID uint64, uid int64, data []byte) []byte {
+	frame := make([]byte, 4+16+len(data))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(16+len(data)))
+	binary.BigEndian.PutUint64(frame[4:12], roomID)
+	binary.BigEndian.PutUint64(frame[12:20], uint64(uid))
+	copy(frame[20:], data)
+	return frame
+}
+
+// Send 将帧放入发送队列，队列满时按策略处理，返回帧是否入队
+func (l *GameServerLink) Send(frame []byte) bool {
+	select {
+	case <-l.ctx.Done():
+		return false
+	default:
+	}
+
+	select {
+	case l.queue <- frame:
+		return true
+	default:
+	}
+
+	switch l.policy {
+	case DropPolicyOldest:
+		for {
+			select {
+			case <-l.queue:
+				l.dropped.Add(1)
+			default:
+			}
+			select {
+			case l.queue <- frame:
+				return true
+			default:
+			}
+		}
+	case DropPolicyBlock:
+		timer := time.NewTimer(linkEnqueueTimeout)
+		defer timer.Stop()
+		select {
+		case l.queue <- frame:
+			return true
+		case <-timer.C:
+		case <-l.ctx.Done():
+		}
+	}
+	l.dropped.Add(1)
+	return false
+}
+
+// Connected 链路当前是否已连接
+func (l *GameServerLink) Connected() bool {
+	return l.connected.Load()
+}
+
+// QueueLen 当前排队的帧数
+func (l *GameServerLink) QueueLen() int {
+	return len(l.queue)
+}
+
+// Dropped 因队列满被丢弃的帧数
+func (l *GameServerLink) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Close 关闭链路并等待后台协程退出
+func (l *GameServerLink) Close() {
+	l.cancel()
+	l.connMu.Lock()
+	if l.conn != nil {
+		l.conn.Close()
+	}
+	l.connMu.Unlock()
+	<-l.done
+}
+
+// run 维护连接：断线后按指数退避重连
+func (l *GameServerLink) run() {
+	defer close(l.done)
+	backoff := 100 * time.Millisecond
+	for {
+		dialer := net.Dialer{Timeout: linkDialTimeout}
+		conn, err := dialer.DialContext(l.ctx, "tcp", l.addr)
+		if err != nil {
+			if l.ctx.Err() != nil {
+				return
+			}
+			log.Error().Err(err).Str("gs", l.addr).Dur("retry", backoff).Msg("failed to connect game server")
+			select {
+			case <-l.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, linkMaxBackoff)
+			continue
+		}
+		backoff = 100 * time.Millisecond
+
+		l.connMu.Lock()
+		l.conn = conn
+		l.connMu.Unlock()
+		l.connected.Store(true)
+		log.Info().Str("gs", l.addr).Msg("game server link established")
+
+		readDone := make(chan struct{})
+		go func() {
+			defer close(readDone)
+			l.readLoop(conn)
+		}()
+		err = l.writeLoop(conn, readDone)
+
+		l.connected.Store(false)
+		conn.Close()
+		<-readDone
+		l.connMu.Lock()
+		l.conn = nil
+		l.connMu.Unlock()
+
+		if l.ctx.Err() != nil {
+			return
+		}
+		log.Warn().Err(err).Str("gs", l.addr).Msg("game server link lost, reconnecting")
+	}
+}
+
+// writeLoop 从队列取帧写入连接，积压的帧合并后一次刷出
+func (l *GameServerLink) writeLoop(conn net.Conn, readDone <-chan struct{}) error {
+	w := bufio.NewWriterSize(conn, l.batchBytes)
+	if len(l.hello) > 0 {
+		conn.SetWriteDeadline(time.Now().Add(linkWriteTimeout))
+		if _, err := conn.Write(l.hello); err != nil {
+			return err
+		}
+	}
+
+	keepalive := time.NewTicker(linkKeepalive)
+	defer keepalive.Stop()
+	lastWrite := time.Now()
+	for {
+		select {
+		case <-l.ctx.Done():
+			return errLinkClosed
+		case <-readDone:
+			return errors.New("downlink closed")
+		case <-keepalive.C:
+			if time.Since(lastWrite) < linkKeepalive {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(linkWriteTimeout))
+			if _, err := conn.Write(encodeControlFrame(ctrlKeepalive, nil)); err != nil {
+				return err
+			}
+			lastWrite = time.Now()
+		case frame := <-l.queue:
+			conn.SetWriteDeadline(time.Now().Add(linkWriteTimeout))
+			if _, err := w.Write(frame); err != nil {
+				return err
+			}
+			l.drainInto(w)
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			lastWrite = time.Now()
+		}
+	}
+}
+
+// drainInto 将队列中已积压的帧写入缓冲，直到缓冲达到批量上限或队列为空
+func (l *GameServerLink) drainInto(w *bufio.Writer) {
+	for w.Buffered() < l.batchBytes {
+		select {
+		case frame := <-l.queue:
+			if _, err := w.Write(frame); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// readLoop 读取游戏服务器发来的下行帧
+func (l *GameServerLink) readLoop(conn net.Conn) {
+	header := make([]byte, 4)
+	buf := make([]byte, 4096)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			if l.ctx.Err() == nil {
+				log.Error().Err(err).Str("gs", l.addr).Msg("read downlink length error")
+			}
+			return
+		}
+		msgLen := binary.LittleEndian.Uint32(header)
+		if msgLen > linkMaxFrameSize {
+			log.Error().Uint32("len", msgLen).Str("gs", l.addr).Msg("downlink packet too large")
+			return
+		}
+		if cap(buf) < int(msgLen) {
+			buf = make([]byte, msgLen)
+		}
+		frame := buf[:msgLen]
+		if _, err := io.ReadFull(conn, frame); err != nil {
+			log.Error().Err(err).Str("gs", l.addr).Msg("read downlink body error")
+			return
+		}
+		l.onDownlink(l.addr, frame)
+	}
+}
@@ -3,9 +3,14 @@ package main
 import (
 	"context"
 	"fmt"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/exaring/otelpgx"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -13,6 +18,7 @@ import (
 	"github.com/spf13/viper"
 	"github.com/zrurf/quiver/server/game_gateway/internal"
 	"github.com/zrurf/quiver/server/game_gateway/internal/dao"
+	"github.com/zrurf/quiver/server/game_gateway/internal/tracing"
 )
 
 func main() {
@@ -27,7 +33,19 @@ func main() {
 	// 初始化logger
 	initLogger(strings.ToLower(config.Logger.Level))
 
-	log.Info().Any("config", config).Msg("Config body")
+	log.Info().Any("config", config.Redacted()).Msg("Config body")
+
+	// 初始化链路追踪
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Options{
+		Enabled:     config.Tracing.Enabled,
+		Endpoint:    config.Tracing.Endpoint,
+		Insecure:    config.Tracing.Insecure,
+		SampleRatio: config.Tracing.SampleRatio,
+	}, "quiver-gateway", internal.GatewayID(config))
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to init tracing")
+	}
+	defer shutdownTracing(context.Background())
 
 	// 初始化基础设施
 	dbPool, err := initDB(config)
@@ -42,7 +60,7 @@ func main() {
 	}
 	defer imdb.Close()
 
-	natsClient, err := dao.NewNATSClient(config.Mq.Addr)
+	natsClient, err := dao.NewNATSClient(config.Mq.Addr, config.Mq.Subject, internal.GatewayID(config))
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to connect to NATS")
 	}
@@ -51,12 +69,14 @@ func main() {
 	// 初始化数据访问层
 	roomDao := dao.NewRoomRepository(dbPool, imdb)
 	sessionDao := dao.NewSessionRepository(imdb)
+	registryDao := dao.NewRegistryRepository(imdb)
 
-	go internal.StartKCPGateway(config, sessionDao, roomDao, natsClient)
-
-	internal.StartHealthCheck(config.Server.Listen)
+	go internal.StartHealthCheck(config.Server.Listen)
 
-	select {}
+	// 收到退出信号后通知客户端并关闭连接
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	internal.StartKCPGateway(ctx, config, sessionDao, roomDao, registryDao, natsClient)
 }
 
 func initConfig() (*internal.Config, error) {
@@ -78,7 +98,7 @@ func initConfig() (*internal.Config, error) {
 	}
 
 	v.SetEnvPrefix("QUIVER")
-	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
 	v.AutomaticEnv()
 
 	pflag.CommandLine.VisitAll(func(f *pflag.Flag) {
@@ -106,10 +126,19 @@ func initFlag() {
 
 	// Server
 	pflag.String("server.listen", ":80", "Server listen address (e.g., :80 or 127.0.0.1:8080)")
-	pflag.Int("server.internal-listen", 8080, "Server internal listen port")
+	pflag.Int("server.internal-listen", 8080, "Admin API listen port (internal network only)")
+	pflag.String("server.gateway-id", "", "Gateway instance ID (defaults to hostname)")
 	pflag.Int("server.kcp-port", 8081, "Server KCP port")
 	pflag.Duration("server.idle-room-timeout", 5*60, "Idle room timeout (seconds)")
 	pflag.Int("server.rate-limit", 100, "Rate limit (requests per second)")
+	pflag.Duration("server.heartbeat-interval", 5*time.Second, "Interval of gateway heartbeats and session timeout checks")
+	pflag.Duration("server.heartbeat-timeout", 30*time.Second, "Disconnect sessions silent for longer than this")
+
+	// Session
+	pflag.String("session.duplicate-login", "kick-oldest", "Policy for concurrent logins of one account (kick-oldest, reject-newest)")
+
+	// Admin
+	pflag.String("admin.token", "", "Bearer token of the admin API (admin API is disabled when empty)")
 
 	// Logger
 	pflag.String("logger.level", "info", "Log level (debug, info, warn, error, fatal)")
@@ -120,6 +149,23 @@ func initFlag() {
 	// Game Servers
 	pflag.StringSlice("game-servers", []string{}, "List of game server addresses (e.g., game_server_1:18650)")
 
+	// Token
+	pflag.Bool("token.local-verify", true, "Verify signed access tokens locally instead of looking them up in IMDB")
+	pflag.String("token.keys-url", "", "Token key set URL (empty to use user-server.url + /api/auth/keys)")
+	pflag.Duration("token.keys-refresh", 10*time.Minute, "Interval of token key set refresh")
+	pflag.Duration("token.revocation-sync", 5*time.Second, "Interval of token revocation list sync from IMDB")
+	pflag.String("token.required-scope", "game", "Scope a signed token must carry to connect (empty to skip)")
+
+	// Registry
+	pflag.Duration("registry.refresh-interval", time.Second, "Interval of game server registry refresh")
+	pflag.Duration("registry.stale-after", 10*time.Second, "Treat a game server as down when its heartbeat is older than this")
+
+	// Tracing
+	pflag.Bool("tracing.enabled", false, "Export OpenTelemetry traces")
+	pflag.String("tracing.endpoint", "otel-collector:4318", "OTLP/HTTP collector endpoint (host:port)")
+	pflag.Bool("tracing.insecure", true, "Use plain HTTP to the collector")
+	pflag.Float64("tracing.sample-ratio", 1.0, "Sampling ratio for root spans (0-1)")
+
 	// Database
 	pflag.String("database.host", "localhost", "Database host")
 	pflag.String("database.port", "5432", "Database port")
@@ -132,10 +178,20 @@ func initFlag() {
 
 	// Mq
 	pflag.String("mq.addr", "nats://localhost:4222", "Message queue address")
-	pflag.String("mq.subject", "default", "Message queue subject/topic")
+	pflag.String("mq.subject", "quiver.events", "Subject prefix shared by all services for events")
 
 	// Play
 	pflag.Int("play.max-players-per-room", 50, "Maximum number of players per room")
+
+	// Transport
+	pflag.Int("transport.queue-size", 4096, "Per game server forward queue size (frames)")
+	pflag.Int("transport.batch-bytes", 16384, "Maximum bytes batched into one write to a game server")
+	pflag.String("transport.drop-policy", "drop-newest", "Policy when the forward queue is full (drop-newest, drop-oldest, block)")
+
+	// Protocol
+	pflag.Int("protocol.min-version", 1, "Minimum accepted client protocol version")
+	pflag.Int("protocol.max-version", 2, "Maximum accepted client protocol version")
+	pflag.String("protocol.update-url", "", "Client update URL sent to unsupported clients")
 }
 
 func initLogger(level_str string) {
@@ -164,6 +220,9 @@ func initIMDB(config *internal.Config) (*redis.Client, error) {
 	imdb := redis.NewClient(&redis.Options{
 		Addr: config.Imdb.Addr,
 	})
+	if err := redisotel.InstrumentTracing(imdb); err != nil {
+		log.Error().Err(err).Msg("failed to instrument imdb tracing")
+	}
 	_, err := imdb.Ping(context.Background()).Result()
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to connect to imdb")
@@ -172,11 +231,16 @@ func initIMDB(config *internal.Config) (*redis.Client, error) {
 }
 
 func initDB(config *internal.Config) (*pgxpool.Pool, error) {
-	dbPool, err := pgxpool.New(context.Background(), fmt.Sprintf(
+	poolConfig, err := pgxpool.ParseConfig(fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s",
 		config.Database.Host, config.Database.Port, config.Database.User,
 		config.Database.Password, config.Database.Name,
 	))
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid database config")
+	}
+	poolConfig.ConnConfig.Tracer = otelpgx.NewTracer()
+	dbPool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to connect to user db")
 	}
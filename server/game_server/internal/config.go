@@ -9,8 +9,28 @@ type Config struct {
 		ListenAddr        string        `mapstructure:"listen-addr"`       // TCP 监听地址，如 ":18650"
 		IdleRoomTimeout   time.Duration `mapstructure:"idle-room-timeout"` // 房间空闲超时
 		MaxPlayersPerRoom int           `mapstructure:"max-players-per-room"`
+		AdvertiseAddr     string        `mapstructure:"advertise-addr"` // 注册到 IMDB 供网关连接的地址，为空时使用主机名加监听端口
+		MaxRooms          int           `mapstructure:"max-rooms"`      // 最大房间数，网关据此判断是否满载，0 表示不限制
+		DrainTimeout      time.Duration `mapstructure:"drain-timeout"`  // 退出时等待房间结束的最长时间，超时后迁移剩余房间
 	} `mapstructure:"server"`
 
+	Registry struct {
+		HeartbeatInterval time.Duration `mapstructure:"heartbeat-interval"` // 上报注册信息与负载的间隔
+		TTL               time.Duration `mapstructure:"ttl"`                // 注册信息过期时间，超过该时间未上报视为下线
+	} `mapstructure:"registry"`
+
+	Metrics struct {
+		Listen string `mapstructure:"listen"` // 监控 HTTP 服务地址（/metrics），为空则不启动
+		Pprof  bool   `mapstructure:"pprof"`  // 是否提供 /debug/pprof/
+	} `mapstructure:"metrics"`
+
+	Tracing struct {
+		Enabled     bool    `mapstructure:"enabled"`      // 是否导出 OpenTelemetry 链路追踪
+		Endpoint    string  `mapstructure:"endpoint"`     // OTLP/HTTP 收集器地址，如 "otel-collector:4318"
+		Insecure    bool    `mapstructure:"insecure"`     // 使用 HTTP 连接收集器
+		SampleRatio float64 `mapstructure:"sample-ratio"` // 根 span 采样率（0~1）
+	} `mapstructure:"tracing"`
+
 	Logger struct {
 		Level string `mapstructure:"level"`
 	} `mapstructure:"logger"`
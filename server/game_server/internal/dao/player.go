@@ -4,13 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 	"github.com/zrurf/quiver/server/game/internal/model"
+	"github.com/zrurf/quiver/server/game/internal/monitor"
 )
 
 type PlayerDAO struct {
@@ -23,10 +23,12 @@ func NewPlayerDAO(db *pgxpool.Pool, rdb *redis.Client) *PlayerDAO {
 }
 
 // Load 从数据库加载玩家数据，若不存在则创建默认记录
-func (d *PlayerDAO) Load(ctx context.Context, uid int64) (*model.Player, error) {
+func (d *PlayerDAO) Load(ctx context.Context, uid int64) (p *model.Player, err error) {
+	defer func(start time.Time) { monitor.ObserveDAO("player_load", start, err) }(time.Now())
+
 	var level int
 	var exp, coins, kills, deaths, playTime int64
-	err := d.db.QueryRow(ctx, `
+	err = d.db.QueryRow(ctx, `
         SELECT level, exp, coins, kills, deaths, play_time
         FROM player_stats WHERE uid = $1
     `, uid).Scan(&level, &exp, &coins, &kills, &deaths, &playTime)
@@ -69,7 +71,7 @@ func (d *PlayerDAO) Load(ctx context.Context, uid int64) (*model.Player, error)
 		json.Unmarshal(data, &buffs)
 	}
 
-	p := model.NewPlayer(uid)
+	p = model.NewPlayer(uid)
 	p.Level = level
 	p.Exp = exp
 	p.Coins = coins
@@ -84,9 +86,11 @@ func (d *PlayerDAO) Load(ctx context.Context, uid int64) (*model.Player, error)
 }
 
 // Save 保存玩家数据
-func (d *PlayerDAO) Save(ctx context.Context, p *model.Player) error {
+func (d *PlayerDAO) Save(ctx context.Context, p *model.Player) (err error) {
+	defer func(start time.Time) { monitor.ObserveDAO("player_save", start, err) }(time.Now())
+
 	// 更新 player_stats
-	_, err := d.db.Exec(ctx, `
+	_, err = d.db.Exec(ctx, `
 		UPDATE player_stats
 		SET level = $2, exp = $3, coins = $4, kills = $5, deaths = $6, play_time = $7, update_at = NOW()
 		WHERE uid = $1
@@ -104,14 +108,10 @@ func (d *PlayerDAO) Save(ctx context.Context, p *model.Player) error {
 	return nil
 }
 
-// UpdateRoomRating 更新房间排名信息
+// UpdateRoomRating 更新房间排名信息（保留房间记录中的服务器地址）
 func (d *PlayerDAO) UpdateRoomRating(ctx context.Context, roomID uint64, avgRating float64, playerCnt int) error {
-	data := map[string]interface{}{
-		"addr":       "", // 地址不需要更新
-		"avg_rating": avgRating,
-		"player_cnt": playerCnt,
-		"updated_at": time.Now().Unix(),
-	}
-	jsonData, _ := json.Marshal(data)
-	return d.rdb.Set(ctx, "room:"+strconv.FormatUint(roomID, 10), jsonData, 0).Err()
+	return updateRoom(ctx, d.rdb, roomID, func(room map[string]interface{}) {
+		room["avg_rating"] = avgRating
+		room["player_cnt"] = playerCnt
+	})
 }
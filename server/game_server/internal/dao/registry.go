@@ -0,0 +1,74 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/zrurf/quiver/server/game/internal/model"
+)
+
+const (
+	gameServerPrefix = "gameserver:"
+	gameServerSet    = "gameservers"
+)
+
+type RegistryDAO struct {
+	rdb *redis.Client
+}
+
+func NewRegistryDAO(rdb *redis.Client) *RegistryDAO {
+	return &RegistryDAO{rdb: rdb}
+}
+
+// Heartbeat 写入服务器注册信息，超过 ttl 未刷新即视为下线
+func (d *RegistryDAO) Heartbeat(ctx context.Context, info *model.GameServerInfo, ttl time.Duration) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	pipe := d.rdb.TxPipeline()
+	pipe.Set(ctx, gameServerPrefix+info.Addr, data, ttl)
+	pipe.SAdd(ctx, gameServerSet, info.Addr)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Deregister 删除服务器注册信息
+func (d *RegistryDAO) Deregister(ctx context.Context, addr string) error {
+	pipe := d.rdb.TxPipeline()
+	pipe.Del(ctx, gameServerPrefix+addr)
+	pipe.SRem(ctx, gameServerSet, addr)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ListGameServers 返回所有仍在心跳有效期内的游戏服务器
+func (d *RegistryDAO) ListGameServers(ctx context.Context) ([]model.GameServerInfo, error) {
+	addrs, err := d.rdb.SMembers(ctx, gameServerSet).Result()
+	if err != nil || len(addrs) == 0 {
+		return nil, err
+	}
+	keys := make([]string, len(addrs))
+	for i, addr := range addrs {
+		keys[i] = gameServerPrefix + addr
+	}
+	values, err := d.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	servers := make([]model.GameServerInfo, 0, len(values))
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var info model.GameServerInfo
+		if err := json.Unmarshal([]byte(s), &info); err != nil {
+			continue
+		}
+		servers = append(servers, info)
+	}
+	return servers, nil
+}
@@ -0,0 +1,71 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/zrurf/quiver/server/game/internal/model"
+)
+
+const migrationPrefix = "migration:"
+
+type RoomDAO struct {
+	rdb *redis.Client
+}
+
+func NewRoomDAO(rdb *redis.Client) *RoomDAO {
+	return &RoomDAO{rdb: rdb}
+}
+
+// SaveSnapshot 写入房间迁移快照
+func (d *RoomDAO) SaveSnapshot(ctx context.Context, snap *model.RoomSnapshot, ttl time.Duration) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return d.rdb.Set(ctx, migrationPrefix+strconv.FormatUint(snap.RoomID, 10), data, ttl).Err()
+}
+
+// TakeSnapshot 取出并删除房间迁移快照，不存在时返回 nil
+func (d *RoomDAO) TakeSnapshot(ctx context.Context, roomID uint64) (*model.RoomSnapshot, error) {
+	data, err := d.rdb.GetDel(ctx, migrationPrefix+strconv.FormatUint(roomID, 10)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var snap model.RoomSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// SetRoomAddr 更新房间记录中的游戏服务器地址（房间迁移后网关据此路由新玩家）
+func (d *RoomDAO) SetRoomAddr(ctx context.Context, roomID uint64, addr string) error {
+	return updateRoom(ctx, d.rdb, roomID, func(room map[string]interface{}) {
+		room["addr"] = addr
+	})
+}
+
+// updateRoom 读取-修改-写回房间记录，保留未修改的字段
+func updateRoom(ctx context.Context, rdb *redis.Client, roomID uint64, fn func(map[string]interface{})) error {
+	key := "room:" + strconv.FormatUint(roomID, 10)
+	room := make(map[string]interface{})
+	data, err := rdb.Get(ctx, key).Bytes()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	if err == nil {
+		json.Unmarshal(data, &room)
+	}
+	fn(room)
+	room["updated_at"] = time.Now().Unix()
+	jsonData, _ := json.Marshal(room)
+	return rdb.Set(ctx, key, jsonData, 0).Err()
+}
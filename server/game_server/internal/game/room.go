@@ -4,6 +4,7 @@ import (
 	"context"
 	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	flatbuffers "github.com/google/flatbuffers/go"
@@ -11,11 +12,13 @@ import (
 	"github.com/zrurf/quiver/server/game/internal"
 	"github.com/zrurf/quiver/server/game/internal/dao"
 	"github.com/zrurf/quiver/server/game/internal/model"
+	"github.com/zrurf/quiver/server/game/internal/monitor"
 	"github.com/zrurf/quiver/server/game/internal/proto/game_proto"
 )
 
 const (
 	maxPlayerSpeed float32 = 250
+	tickInterval           = 30 * time.Millisecond // 房间 tick 间隔
 )
 
 type Room struct {
@@ -26,18 +29,24 @@ type Room struct {
 	comp          *internal.Compressor
 	avgRating     float64
 	players       map[int64]*model.Player
+	leaving       map[int64]*model.Player // 已离开、数据尚在异步保存的玩家（受 playersMu 保护）
 	playersMu     sync.RWMutex
 	projectiles   []*Projectile
 	projectilesMu sync.RWMutex
 	events        []*GameEvent
 	eventsMu      sync.RWMutex
 	stopCh        chan struct{}
+	haltOnce      sync.Once
+	stopOnce      sync.Once
+	frozen        bool         // 已冻结：不再处理客户端输入（受 inputMu 保护）
+	inputMu       sync.RWMutex // 处理客户端输入时持有读锁，Freeze 持有写锁以等待正在处理的输入
 	wg            sync.WaitGroup
 	onDestroy     func(roomID uint64)
 	lastActivity  time.Time
 	sendFunc      func(roomID uint64, targetUID int64, data []byte)
 	nextProjID    uint64
-	roomKey       []byte // 房间对称密钥
+	roomKey       []byte       // 房间对称密钥
+	tickOverruns  atomic.Int64 // tick 耗时超过 tickInterval 的次数
 }
 
 func NewRoom(id uint64, cfg *internal.Config, playerDAO *dao.PlayerDAO,
@@ -56,6 +65,7 @@ func NewRoom(id uint64, cfg *internal.Config, playerDAO *dao.PlayerDAO,
 		comp:         comp,
 		avgRating:    rating,
 		players:      make(map[int64]*model.Player),
+		leaving:      make(map[int64]*model.Player),
 		projectiles:  make([]*Projectile, 0),
 		events:       make([]*GameEvent, 0),
 		stopCh:       make(chan struct{}),
@@ -71,7 +81,8 @@ func NewRoom(id uint64, cfg *internal.Config, playerDAO *dao.PlayerDAO,
 }
 
 func (r *Room) gameLoop() {
-	ticker := time.NewTicker(30 * time.Millisecond)
+	defer r.wg.Done()
+	ticker := time.NewTicker(tickInterval)
 	ratingTicker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 	defer ratingTicker.Stop()
@@ -80,11 +91,19 @@ func (r *Room) gameLoop() {
 		case <-r.stopCh:
 			return
 		case <-ticker.C:
+			start := time.Now()
 			r.update()
 			r.broadcastState()
+			elapsed := time.Since(start)
+			overrun := elapsed > tickInterval
+			if overrun {
+				r.tickOverruns.Add(1)
+			}
+			monitor.ObserveTick(elapsed, overrun)
 			if time.Since(r.lastActivity) > r.cfg.Server.IdleRoomTimeout {
 				log.Info().Uint64("room", r.id).Msg("room idle timeout, stopping")
-				r.Stop()
+				// Stop 会等待本协程退出，因此异步调用
+				go r.Stop()
 				return
 			}
 		case <-ratingTicker.C:
@@ -95,7 +114,7 @@ func (r *Room) gameLoop() {
 
 func (r *Room) update() {
 	now := time.Now().UnixMilli()
-	dt := int64(30)
+	dt := tickInterval.Milliseconds()
 
 	// 更新玩家
 	r.playersMu.RLock()
@@ -195,6 +214,7 @@ func (r *Room) broadcastState() {
 
 	builder.Finish(packetOff)
 	data := builder.FinishedBytes()
+	monitor.ObserveBroadcast(monitor.StageRaw, len(data))
 
 	// 使用房间密钥加密
 	if r.enc != nil {
@@ -204,9 +224,11 @@ func (r *Room) broadcastState() {
 			return
 		}
 		data = encData
+		monitor.ObserveBroadcast(monitor.StageEncrypted, len(data))
 	}
 	if r.comp != nil {
 		data = r.comp.Compress(data)
+		monitor.ObserveBroadcast(monitor.StageCompressed, len(data))
 	}
 
 	// 广播给所有玩家
@@ -219,6 +241,11 @@ func (r *Room) broadcastState() {
 }
 
 func (r *Room) HandleClientData(uid int64, payload []byte) {
+	r.inputMu.RLock()
+	defer r.inputMu.RUnlock()
+	if r.frozen {
+		return
+	}
 	r.lastActivity = time.Now()
 	var err error
 	if r.enc != nil {
@@ -247,6 +274,14 @@ func (r *Room) HandleClientData(uid int64, payload []byte) {
 	// 获取或创建玩家
 	r.playersMu.Lock()
 	p, exists := r.players[uid]
+	if !exists {
+		p, exists = r.leaving[uid]
+		if exists {
+			// 离开后数据尚未保存完就重新加入，沿用内存中的数据
+			delete(r.leaving, uid)
+			r.players[uid] = p
+		}
+	}
 	if !exists {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -322,21 +357,134 @@ func (r *Room) handlePlayerShoot(uid int64, msg *game_proto.PlayerShoot) {
 	r.nextProjID++
 }
 
-func (r *Room) Stop() {
-	close(r.stopCh)
+// RemovePlayer 将玩家移出房间并异步保存玩家数据，调用方（网关连接的读循环）不等待数据库
+func (r *Room) RemovePlayer(uid int64) {
+	r.playersMu.Lock()
+	p, ok := r.players[uid]
+	delete(r.players, uid)
+	if ok {
+		r.leaving[uid] = p
+	}
+	r.playersMu.Unlock()
+	if !ok {
+		return
+	}
+	log.Info().Int64("uid", uid).Uint64("room", r.id).Msg("player left")
+	go r.saveLeavingPlayer(p)
+}
+
+// saveLeavingPlayer 保存已离开的玩家并更新房间平均分
+func (r *Room) saveLeavingPlayer(p *model.Player) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.playerDAO.Save(ctx, p); err != nil {
+		log.Error().Err(err).Int64("uid", p.UID).Msg("failed to save player")
+	}
+	r.playersMu.Lock()
+	if r.leaving[p.UID] == p {
+		delete(r.leaving, p.UID)
+	}
+	r.playersMu.Unlock()
+	r.updateAvgRating()
+}
+
+// Freeze 停止 tick 循环并丢弃之后的客户端输入，返回后房间状态不再变化，可重复调用
+// 迁移时先冻结再生成快照，冻结后到达的输入被丢弃，不会只改变源服务器上已过时的状态
+func (r *Room) Freeze() {
+	r.inputMu.Lock()
+	r.frozen = true
+	r.inputMu.Unlock()
+	r.haltOnce.Do(func() { close(r.stopCh) })
 	r.wg.Wait()
-	ctx := context.Background()
+}
+
+// Stop 停止房间并保存玩家数据，可重复调用
+func (r *Room) Stop() {
+	r.stopOnce.Do(func() {
+		r.Freeze()
+		ctx := context.Background()
+		r.playersMu.RLock()
+		for _, p := range r.players {
+			if err := r.playerDAO.Save(ctx, p); err != nil {
+				log.Error().Err(err).Int64("uid", p.UID).Msg("failed to save player")
+			}
+		}
+		// 异步保存可能尚未完成（进程即将退出），在此再保存一次
+		for _, p := range r.leaving {
+			if err := r.playerDAO.Save(ctx, p); err != nil {
+				log.Error().Err(err).Int64("uid", p.UID).Msg("failed to save player")
+			}
+		}
+		r.playersMu.RUnlock()
+		if r.onDestroy != nil {
+			r.onDestroy(r.id)
+		}
+		log.Info().Uint64("room", r.id).Msg("room stopped")
+	})
+}
+
+// ID 房间ID
+func (r *Room) ID() uint64 {
+	return r.id
+}
+
+// Snapshot 导出房间状态用于迁移
+func (r *Room) Snapshot() *model.RoomSnapshot {
 	r.playersMu.RLock()
+	defer r.playersMu.RUnlock()
+	snap := &model.RoomSnapshot{
+		RoomID:    r.id,
+		AvgRating: r.avgRating,
+		Players:   make([]*model.Player, 0, len(r.players)),
+		CreatedAt: time.Now().Unix(),
+	}
 	for _, p := range r.players {
-		if err := r.playerDAO.Save(ctx, p); err != nil {
-			log.Error().Err(err).Int64("uid", p.UID).Msg("failed to save player")
-		}
+		snap.Players = append(snap.Players, p.Clone())
+	}
+	return snap
+}
+
+// Restore 从迁移快照恢复玩家状态，快照中的玩家无需再从数据库加载
+func (r *Room) Restore(snap *model.RoomSnapshot) {
+	r.playersMu.Lock()
+	defer r.playersMu.Unlock()
+	for _, p := range snap.Players {
+		r.players[p.UID] = p
+	}
+	r.lastActivity = time.Now()
+}
+
+// SetPlayerLatency 更新玩家的网络延迟（由网关心跳测得）
+func (r *Room) SetPlayerLatency(uid int64, rtt, jitter time.Duration) {
+	r.playersMu.RLock()
+	p, ok := r.players[uid]
+	r.playersMu.RUnlock()
+	if ok {
+		p.SetLatency(rtt, jitter)
 	}
+}
+
+// PlayerLatency 返回玩家的平滑 RTT 与抖动，未知时为0
+func (r *Room) PlayerLatency(uid int64) (time.Duration, time.Duration) {
+	r.playersMu.RLock()
+	p, ok := r.players[uid]
 	r.playersMu.RUnlock()
-	if r.onDestroy != nil {
-		r.onDestroy(r.id)
+	if !ok {
+		return 0, 0
 	}
-	log.Info().Uint64("room", r.id).Msg("room stopped")
+	return p.GetLatency()
+}
+
+// PlayerCount 当前房间玩家数
+func (r *Room) PlayerCount() int {
+	r.playersMu.RLock()
+	defer r.playersMu.RUnlock()
+	return len(r.players)
+}
+
+// TakeTickOverruns 返回并清零 tick 超时次数
+func (r *Room) TakeTickOverruns() int64 {
+	return r.tickOverruns.Swap(0)
 }
 
 func clamp(v, min, max float32) float32 {
@@ -352,15 +500,16 @@ func clamp(v, min, max float32) float32 {
 func (r *Room) updateAvgRating() {
 	r.playersMu.RLock()
 	defer r.playersMu.RUnlock()
-	if len(r.players) == 0 {
-		return
-	}
-	var sum float64
-	for _, p := range r.players {
-		sum += p.Rating
+	// 房间已空时保留原平均分，仅更新人数
+	avg := r.avgRating
+	if len(r.players) > 0 {
+		var sum float64
+		for _, p := range r.players {
+			sum += p.Rating
+		}
+		avg = sum / float64(len(r.players))
+		r.avgRating = avg
 	}
-	avg := sum / float64(len(r.players))
-	r.avgRating = avg
 
 	// 写入 Garnet
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
@@ -0,0 +1,65 @@
+package model
+
+import "encoding/json"
+
+// EventVersion 当前事件格式版本（与网关一致），结构见 schema/mq/events.schema.json
+const EventVersion = 1
+
+// 事件类型（同时作为主题后缀，完整主题为 "<mq.subject>.<类型>"）
+const (
+	EventRoomCreated    = "room.created"
+	EventRoomDestroyed  = "room.destroyed"
+	EventRoomMigrate    = "room.migrate"
+	EventServerDraining = "gameserver.draining"
+)
+
+// Event 事件信封
+type Event struct {
+	Version int             `json:"v"`
+	Type    string          `json:"type"`
+	Source  string          `json:"source"` // 发布方实例ID
+	Time    int64           `json:"ts"`     // 毫秒时间戳
+	Data    json.RawMessage `json:"data"`
+}
+
+type RoomCreatedEvent struct {
+	RoomID     uint64  `json:"room_id"`
+	Addr       string  `json:"addr"`
+	InitRating float64 `json:"init_rating"`
+}
+
+type RoomDestroyedEvent struct {
+	RoomID uint64 `json:"room_id"`
+	Addr   string `json:"addr,omitempty"`
+}
+
+type RoomMigrateEvent struct {
+	RoomID uint64 `json:"room_id"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+type ServerDrainingEvent struct {
+	Addr string `json:"addr"`
+}
+
+// CreateRoomRequest 网关请求创建房间（request/reply）
+type CreateRoomRequest struct {
+	RoomID     uint64  `json:"room_id"`
+	InitRating float64 `json:"init_rating"`
+}
+
+type CreateRoomReply struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// DrainRequest 排空指令（request/reply，由网关管理接口发起）
+type DrainRequest struct {
+	Addr string `json:"addr"`
+}
+
+type DrainReply struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
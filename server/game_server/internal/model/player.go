@@ -2,6 +2,7 @@ package model
 
 import (
 	"sync"
+	"time"
 )
 
 type Player struct {
@@ -21,6 +22,8 @@ type Player struct {
 	Rating          float64
 	RatingDeviation float64
 	Volatility      float64
+	rtt             time.Duration // 网关测得的平滑 RTT（不持久化，迁移后由网关重新上报）
+	jitter          time.Duration // RTT 抖动
 	mu              sync.RWMutex
 }
 
@@ -49,6 +52,21 @@ func (p *Player) SetPosition(x, y, vx, vy float32) {
 	p.VelY = vy
 }
 
+// GetLatency 获取玩家网络延迟
+func (p *Player) GetLatency() (rtt, jitter time.Duration) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.rtt, p.jitter
+}
+
+// SetLatency 设置玩家网络延迟
+func (p *Player) SetLatency(rtt, jitter time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rtt = rtt
+	p.jitter = jitter
+}
+
 // GetHealth 获取当前生命值
 func (p *Player) GetHealth() int {
 	p.mu.RLock()
@@ -81,3 +99,31 @@ func (p *Player) SetBuffs(buffs []uint8) {
 	defer p.mu.Unlock()
 	p.Buffs = buffs
 }
+
+// Clone 返回玩家数据的副本
+func (p *Player) Clone() *Player {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	c := &Player{
+		UID:             p.UID,
+		PosX:            p.PosX,
+		PosY:            p.PosY,
+		VelX:            p.VelX,
+		VelY:            p.VelY,
+		Health:          p.Health,
+		Level:           p.Level,
+		Exp:             p.Exp,
+		Coins:           p.Coins,
+		Kills:           p.Kills,
+		Deaths:          p.Deaths,
+		PlayTime:        p.PlayTime,
+		Rating:          p.Rating,
+		RatingDeviation: p.RatingDeviation,
+		Volatility:      p.Volatility,
+	}
+	if p.Buffs != nil {
+		c.Buffs = make([]uint8, len(p.Buffs))
+		copy(c.Buffs, p.Buffs)
+	}
+	return c
+}
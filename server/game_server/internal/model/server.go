@@ -0,0 +1,21 @@
+package model
+
+// GameServerInfo 游戏服务器注册信息（定期写入 IMDB 供网关选择服务器）
+type GameServerInfo struct {
+	Addr        string `json:"addr"`         // 网关连接使用的地址
+	MaxRooms    int    `json:"max_rooms"`    // 房间容量
+	Rooms       int    `json:"rooms"`        // 当前房间数
+	Players     int    `json:"players"`      // 当前玩家数
+	TickOverrun int64  `json:"tick_overrun"` // 上个心跳周期内 tick 超时次数
+	Draining    bool   `json:"draining"`     // 正在排空，不再接收新房间
+	StartedAt   int64  `json:"started_at"`
+	UpdatedAt   int64  `json:"updated_at"`
+}
+
+// RoomSnapshot 房间迁移快照（排空时写入 IMDB，由目标服务器恢复）
+type RoomSnapshot struct {
+	RoomID    uint64    `json:"room_id"`
+	AvgRating float64   `json:"avg_rating"`
+	Players   []*Player `json:"players"`
+	CreatedAt int64     `json:"created_at"`
+}
@@ -0,0 +1,68 @@
+package monitor
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "quiver_game"
+
+// 广播包处理阶段
+const (
+	StageRaw        = "raw"        // 序列化后
+	StageEncrypted  = "encrypted"  // 加密后
+	StageCompressed = "compressed" // 压缩后（最终发送大小）
+)
+
+var (
+	tickDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tick_duration_seconds",
+		Help:      "Duration of a room tick (update + broadcast).",
+		Buckets:   []float64{.001, .002, .005, .01, .015, .02, .025, .03, .04, .05, .075, .1},
+	})
+
+	tickOverruns = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tick_overruns_total",
+		Help:      "Room ticks that exceeded the tick interval.",
+	})
+
+	broadcastBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "broadcast_bytes",
+		Help:      "Size of room state broadcasts at each processing stage.",
+		Buckets:   prometheus.ExponentialBuckets(64, 2, 12),
+	}, []string{"stage"})
+
+	daoDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "dao_duration_seconds",
+		Help:      "Latency of data access operations.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"op", "result"})
+)
+
+// ObserveTick 记录一次 tick 耗时
+func ObserveTick(d time.Duration, overrun bool) {
+	tickDuration.Observe(d.Seconds())
+	if overrun {
+		tickOverruns.Inc()
+	}
+}
+
+// ObserveBroadcast 记录广播包在某一阶段的大小
+func ObserveBroadcast(stage string, size int) {
+	broadcastBytes.WithLabelValues(stage).Observe(float64(size))
+}
+
+// ObserveDAO 记录数据访问耗时
+func ObserveDAO(op string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	daoDuration.WithLabelValues(op, result).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,31 @@
+package monitor
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+// StartServer 启动监控 HTTP 服务：/metrics，启用 pprof 时额外提供 /debug/pprof/
+func StartServer(addr string, enablePprof bool) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+	if enablePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		log.Warn().Msg("pprof enabled")
+	}
+	log.Info().Msgf("metrics listening on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Error().Err(err).Msg("metrics server failed")
+	}
+}
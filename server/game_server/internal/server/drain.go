@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/game/internal/game"
+	"github.com/zrurf/quiver/server/game/internal/model"
+	"github.com/zrurf/quiver/server/game/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	drainCheckInterval = time.Second
+	snapshotTTL        = 5 * time.Minute // 迁移快照有效期，超过后目标服务器将按新房间处理
+)
+
+// Drain 进入排空模式，直到所有房间结束或 ctx 超时
+// 排空期间服务器在注册表中标记为 draining，网关不再向其放置新房间，已有房间继续运行；
+// 没有玩家的房间立即关闭；超时后仍在运行的房间生成快照迁移到其他服务器
+// 已在排空（如管理接口发起）时等待该次排空结束，或 ctx 结束
+func (s *Server) Drain(ctx context.Context) {
+	if !s.draining.CompareAndSwap(false, true) {
+		select {
+		case <-s.drainDone:
+		case <-ctx.Done():
+		}
+		return
+	}
+	defer close(s.drainDone)
+	addr := s.advertiseAddr()
+	log.Info().Str("addr", addr).Msg("game server draining")
+
+	// 立即上报，不等待下一次心跳
+	s.heartbeat(s.registryTTL())
+	if err := s.publish(ctx, model.EventServerDraining, model.ServerDrainingEvent{Addr: addr}); err != nil {
+		log.Error().Err(err).Msg("publish gameserver.draining failed")
+	}
+	// 告知玩家服务器即将维护，期限后未结束的房间会被迁移
+	deadline, _ := ctx.Deadline()
+	s.sendNotice(notice{Kind: noticeKindMaintenance, Reason: noticeReasonMaintenance, Deadline: deadlineMillis(deadline)})
+
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+	for {
+		remaining := 0
+		for _, r := range s.roomList() {
+			if r.PlayerCount() == 0 {
+				r.Stop()
+				continue
+			}
+			remaining++
+		}
+		if remaining == 0 {
+			log.Info().Msg("all rooms finished, drain complete")
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Warn().Int("rooms", remaining).Msg("drain deadline reached, migrating remaining rooms")
+			s.migrateRooms()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Draining 服务器是否处于排空模式
+func (s *Server) Draining() bool {
+	return s.draining.Load()
+}
+
+// migrateRooms 将剩余房间迁移到其他服务器
+func (s *Server) migrateRooms() {
+	for _, r := range s.roomList() {
+		// 先冻结再生成快照，快照之后不再有 tick 与输入改变房间状态
+		r.Freeze()
+		target, err := s.pickMigrationTarget()
+		if err != nil {
+			log.Error().Err(err).Uint64("room", r.ID()).Msg("room migration failed, stopping room")
+			s.sendNotice(notice{Kind: noticeKindRoomClosing, Reason: noticeReasonServerShutdown, RoomID: r.ID()})
+			r.Stop()
+			continue
+		}
+		if err := s.migrateRoom(r, target); err != nil {
+			log.Error().Err(err).Uint64("room", r.ID()).Str("target", target).Msg("room migration failed, stopping room")
+			s.sendNotice(notice{Kind: noticeKindRoomClosing, Reason: noticeReasonServerShutdown, RoomID: r.ID()})
+		}
+		r.Stop()
+	}
+}
+
+// migrateRoom 写入房间快照并通知网关改道，调用前房间必须已冻结（Room.Freeze）
+// 快照必须先于通知写入：网关改道后的第一帧到达目标服务器时即从快照恢复房间
+func (s *Server) migrateRoom(r *game.Room, target string) (err error) {
+	ctx, span := tracing.Start(context.Background(), "gameserver.migrateRoom", trace.WithAttributes(
+		attribute.Int64("room.id", int64(r.ID())),
+		attribute.String("gs.to", target),
+	))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	snap := r.Snapshot()
+	if err := s.roomDAO.SaveSnapshot(ctx, snap, snapshotTTL); err != nil {
+		return err
+	}
+	if err := s.roomDAO.SetRoomAddr(ctx, r.ID(), target); err != nil {
+		return err
+	}
+	if err := s.publish(ctx, model.EventRoomMigrate, model.RoomMigrateEvent{RoomID: r.ID(), From: s.advertiseAddr(), To: target}); err != nil {
+		return err
+	}
+	log.Info().Uint64("room", r.ID()).Str("target", target).Int("players", len(snap.Players)).Msg("room migrated")
+	return nil
+}
+
+// pickMigrationTarget 选择负载最低的其他可用服务器
+func (s *Server) pickMigrationTarget() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	servers, err := s.registryDAO.ListGameServers(ctx)
+	if err != nil {
+		return "", err
+	}
+	self := s.advertiseAddr()
+	var best string
+	var bestLoad float64
+	for _, info := range servers {
+		if info.Addr == self || info.Draining {
+			continue
+		}
+		if info.MaxRooms > 0 && info.Rooms >= info.MaxRooms {
+			continue
+		}
+		load := float64(info.Rooms)
+		if info.MaxRooms > 0 {
+			load /= float64(info.MaxRooms)
+		}
+		if best == "" || load < bestLoad {
+			best, bestLoad = info.Addr, load
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("no migration target available")
+	}
+	return best, nil
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/game/internal/model"
+	"github.com/zrurf/quiver/server/game/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 房间生命周期事件流（与网关一致）
+const roomStreamMaxAge = 24 * time.Hour
+
+var (
+	errDraining = errors.New("server draining")
+	errRoomFull = errors.New("room capacity reached")
+)
+
+// subject 返回带前缀的完整主题
+func (s *Server) subject(eventType string) string {
+	return s.cfg.Mq.Subject + "." + eventType
+}
+
+// subjectToken 将地址转换为可用作主题片段的形式（NATS 主题以 . 分隔）
+func subjectToken(v string) string {
+	return strings.NewReplacer(".", "_", ":", "_", "*", "_", ">", "_", " ", "_").Replace(v)
+}
+
+func encodeEvent(eventType, source string, data any) ([]byte, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(model.Event{
+		Version: model.EventVersion,
+		Type:    eventType,
+		Source:  source,
+		Time:    time.Now().UnixMilli(),
+		Data:    body,
+	})
+}
+
+func decodeEvent(raw []byte, out any) (*model.Event, error) {
+	var ev model.Event
+	if err := json.Unmarshal(raw, &ev); err != nil {
+		return nil, err
+	}
+	if ev.Version != model.EventVersion {
+		return nil, fmt.Errorf("unsupported event version %d", ev.Version)
+	}
+	if err := json.Unmarshal(ev.Data, out); err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+// startSpan 为一次消息收发创建 span
+func startSpan(ctx context.Context, op, subject string, kind trace.SpanKind) (context.Context, trace.Span) {
+	return tracing.Start(ctx, op+" "+subject, trace.WithSpanKind(kind), trace.WithAttributes(
+		attribute.String("messaging.system", "nats"),
+		attribute.String("messaging.destination.name", subject),
+	))
+}
+
+// publish 发布事件；room.* 事件经 JetStream 持久化，其余为普通发布
+// 追踪上下文写入消息头，订阅方据此延续调用链
+func (s *Server) publish(ctx context.Context, eventType string, data any) (err error) {
+	if s.natsConn == nil {
+		return errors.New("nats not connected")
+	}
+	subject := s.subject(eventType)
+	ctx, span := startSpan(ctx, "publish", subject, trace.SpanKindProducer)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	payload, err := encodeEvent(eventType, s.advertiseAddr(), data)
+	if err != nil {
+		return err
+	}
+	msg := &nats.Msg{Subject: subject, Data: payload}
+	tracing.Inject(ctx, msg)
+	if s.js != nil && strings.HasPrefix(eventType, "room.") {
+		ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		defer cancel()
+		_, err = s.js.PublishMsg(ctx, msg)
+		return err
+	}
+	return s.natsConn.PublishMsg(msg)
+}
+
+// StartNATSListener 连接 NATS，响应建房请求并消费房间生命周期事件
+// 房间事件使用以本服务器地址命名的持久消费者，重启后从上次确认的位置继续，不会丢失停机期间的事件
+func (s *Server) StartNATSListener() {
+	nc, err := nats.Connect(s.cfg.Mq.Addr)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to connect to NATS")
+	}
+	s.natsConn = nc
+	js, err := jetstream.New(nc)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to init JetStream")
+	}
+	s.js = js
+
+	self := s.advertiseAddr()
+	createSubject := s.subject("gameserver." + subjectToken(self) + ".room.create")
+	if _, err := nc.Subscribe(createSubject, s.handleCreateRoomRequest); err != nil {
+		log.Fatal().Err(err).Str("subject", createSubject).Msg("failed to subscribe to room create requests")
+	}
+
+	drainSubject := s.subject("gameserver." + subjectToken(self) + ".drain")
+	if _, err := nc.Subscribe(drainSubject, s.handleDrainRequest); err != nil {
+		log.Fatal().Err(err).Str("subject", drainSubject).Msg("failed to subscribe to drain requests")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream := strings.ToUpper(subjectToken(s.cfg.Mq.Subject)) + "_ROOMS"
+	if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     stream,
+		Subjects: []string{s.cfg.Mq.Subject + ".room.>"},
+		MaxAge:   roomStreamMaxAge,
+		Storage:  jetstream.FileStorage,
+	}); err != nil {
+		log.Fatal().Err(err).Msg("failed to create room event stream")
+	}
+	consumer, err := js.CreateOrUpdateConsumer(ctx, stream, jetstream.ConsumerConfig{
+		Durable:        "gs_" + subjectToken(self),
+		FilterSubjects: []string{s.subject(model.EventRoomCreated), s.subject(model.EventRoomDestroyed)},
+		AckPolicy:      jetstream.AckExplicitPolicy,
+		DeliverPolicy:  jetstream.DeliverNewPolicy,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create room event consumer")
+	}
+	if _, err := consumer.Consume(s.handleRoomEvent); err != nil {
+		log.Fatal().Err(err).Msg("failed to consume room events")
+	}
+	log.Info().Str("stream", stream).Str("subject", createSubject).Msg("NATS listener started")
+}
+
+// handleCreateRoomRequest 处理网关的建房请求，房间创建成功后才回复确认
+func (s *Server) handleCreateRoomRequest(msg *nats.Msg) {
+	ctx, span := startSpan(tracing.Extract(context.Background(), msg.Header), "process", msg.Subject, trace.SpanKindServer)
+	defer span.End()
+
+	var req model.CreateRoomRequest
+	reply := model.CreateRoomReply{OK: true}
+	if _, err := decodeEvent(msg.Data, &req); err != nil {
+		reply = model.CreateRoomReply{Error: err.Error()}
+		tracing.RecordError(span, err)
+	} else if _, err := s.createRoom(ctx, req.RoomID, req.InitRating); err != nil {
+		reply = model.CreateRoomReply{Error: err.Error()}
+		tracing.RecordError(span, err)
+	}
+	payload, err := encodeEvent("room.create.reply", s.advertiseAddr(), reply)
+	if err != nil {
+		return
+	}
+	if err := msg.Respond(payload); err != nil {
+		log.Error().Err(err).Uint64("room", req.RoomID).Msg("failed to reply room create request")
+	}
+}
+
+// handleDrainRequest 处理排空指令：回复确认后在后台排空，进程保持运行直到收到退出信号
+func (s *Server) handleDrainRequest(msg *nats.Msg) {
+	ctx, span := startSpan(tracing.Extract(context.Background(), msg.Header), "process", msg.Subject, trace.SpanKindServer)
+	defer span.End()
+
+	reply := model.DrainReply{OK: true}
+	var req model.DrainRequest
+	if ev, err := decodeEvent(msg.Data, &req); err != nil {
+		reply = model.DrainReply{Error: err.Error()}
+		tracing.RecordError(span, err)
+	} else if !s.draining.Load() {
+		log.Info().Str("source", ev.Source).Msg("drain requested")
+		go func() {
+			drainCtx, cancel := context.WithTimeout(ctx, s.cfg.Server.DrainTimeout)
+			defer cancel()
+			s.Drain(drainCtx)
+		}()
+	}
+	payload, err := encodeEvent("gameserver.drain.reply", s.advertiseAddr(), reply)
+	if err != nil {
+		return
+	}
+	if err := msg.Respond(payload); err != nil {
+		log.Error().Err(err).Msg("failed to reply drain request")
+	}
+}
+
+// handleRoomEvent 处理房间生命周期事件
+func (s *Server) handleRoomEvent(msg jetstream.Msg) {
+	defer msg.Ack()
+	ctx, span := startSpan(tracing.Extract(context.Background(), msg.Headers()), "receive", msg.Subject(), trace.SpanKindConsumer)
+	defer span.End()
+	self := s.advertiseAddr()
+	switch strings.TrimPrefix(msg.Subject(), s.cfg.Mq.Subject+".") {
+	case model.EventRoomCreated:
+		var ev model.RoomCreatedEvent
+		if _, err := decodeEvent(msg.Data(), &ev); err != nil {
+			log.Error().Err(err).Str("subject", msg.Subject()).Msg("invalid event")
+			tracing.RecordError(span, err)
+			return
+		}
+		// 补收停机期间分配给本服务器的房间
+		if ev.Addr != self {
+			return
+		}
+		if _, err := s.createRoom(ctx, ev.RoomID, ev.InitRating); err != nil {
+			log.Warn().Err(err).Uint64("room", ev.RoomID).Msg("room from event not created")
+		}
+	case model.EventRoomDestroyed:
+		var ev model.RoomDestroyedEvent
+		if _, err := decodeEvent(msg.Data(), &ev); err != nil {
+			log.Error().Err(err).Str("subject", msg.Subject()).Msg("invalid event")
+			tracing.RecordError(span, err)
+			return
+		}
+		if ev.Addr != "" && ev.Addr != self {
+			return
+		}
+		s.roomsMu.RLock()
+		room, ok := s.rooms[ev.RoomID]
+		s.roomsMu.RUnlock()
+		if ok {
+			room.Stop()
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// 内部控制帧（与网关约定）
+// 房间ID为0的帧不是游戏数据：数据首字节为控制码，其后为控制码对应的内容
+const (
+	ctrlGatewayHello  byte = 1 // 网关 -> 游戏服务器：声明网关ID（连接建立后的第一帧）
+	ctrlKeepalive     byte = 2 // 网关 -> 游戏服务器：空闲保活
+	ctrlNotice        byte = 3 // 游戏服务器 -> 网关：向玩家下发系统通知（JSON，见 notice）
+	ctrlPlayerLeave   byte = 4 // 网关 -> 游戏服务器：玩家离开房间（8字节房间ID + 8字节UID）
+	ctrlPlayerLatency byte = 5 // 网关 -> 游戏服务器：玩家延迟（8字节房间ID + 8字节UID + 4字节RTT + 4字节抖动，单位微秒）
+)
+
+const (
+	maxFrameSize        = 65536
+	gatewayQueueSize    = 4096
+	gatewayBatchBytes   = 32 * 1024
+	gatewayWriteTimeout = 5 * time.Second
+)
+
+var errFrameTooLarge = errors.New("frame too large")
+
+// gatewayConn 一个已连接的网关
+// 下行数据经由独立的写协程发送，避免慢网关阻塞房间 tick
+type gatewayConn struct {
+	id    string
+	conn  net.Conn
+	queue chan []byte
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newGatewayConn(id string, conn net.Conn) *gatewayConn {
+	gc := &gatewayConn{
+		id:    id,
+		conn:  conn,
+		queue: make(chan []byte, gatewayQueueSize),
+		done:  make(chan struct{}),
+	}
+	go gc.writeLoop()
+	return gc
+}
+
+// send 将下行包放入发送队列，队列满时丢弃
+func (gc *gatewayConn) send(packet []byte) bool {
+	select {
+	case <-gc.done:
+		return false
+	case gc.queue <- packet:
+		return true
+	default:
+		return false
+	}
+}
+
+func (gc *gatewayConn) close() {
+	gc.once.Do(func() {
+		close(gc.done)
+		gc.conn.Close()
+	})
+}
+
+func (gc *gatewayConn) writeLoop() {
+	w := bufio.NewWriterSize(gc.conn, gatewayBatchBytes)
+	for {
+		select {
+		case <-gc.done:
+			return
+		case packet := <-gc.queue:
+			gc.conn.SetWriteDeadline(time.Now().Add(gatewayWriteTimeout))
+			w.Write(packet)
+			// 合并队列中积压的包后一次写出
+			for w.Buffered() < gatewayBatchBytes && len(gc.queue) > 0 {
+				w.Write(<-gc.queue)
+			}
+			if err := w.Flush(); err != nil {
+				log.Error().Err(err).Str("gateway", gc.id).Msg("write to gateway failed")
+				gc.close()
+				return
+			}
+		}
+	}
+}
+
+// readFrame 读取一个带4字节长度头（小端）的帧
+func readFrame(conn net.Conn, header []byte) ([]byte, error) {
+	if _, err := io.ReadFull(conn, header[:4]); err != nil {
+		return nil, err
+	}
+	msgLen := binary.LittleEndian.Uint32(header[:4])
+	if msgLen > maxFrameSize {
+		return nil, errFrameTooLarge
+	}
+	data := make([]byte, msgLen)
+	if _, err := io.ReadFull(conn, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// encodeFrame 构造下行帧
+// 帧格式：4字节长度（小端）+ 8字节房间ID + 8字节目标UID + 数据
+func encodeFrame(roomID uint64, targetUID int64, payload []byte) []byte {
+	packet := make([]byte, 4+16+len(payload))
+	binary.LittleEndian.PutUint32(packet[0:4], uint32(16+len(payload)))
+	binary.BigEndian.PutUint64(packet[4:12], roomID)
+	binary.BigEndian.PutUint64(packet[12:20], uint64(targetUID))
+	copy(packet[20:], payload)
+	return packet
+}
+
+// registerGateway 登记网关连接，同一网关ID的旧连接（如网关重启前的残留连接）会被替换
+func (s *Server) registerGateway(gc *gatewayConn) {
+	s.gatewaysMu.Lock()
+	old, ok := s.gateways[gc.id]
+	s.gateways[gc.id] = gc
+	s.gatewaysMu.Unlock()
+	if ok && old != gc {
+		old.close()
+	}
+	log.Info().Str("gateway", gc.id).Str("remote", gc.conn.RemoteAddr().String()).Msg("gateway registered")
+}
+
+// unregisterGateway 注销网关连接
+// 路由表保留该网关的玩家，网关重启后以相同ID重连即可恢复下行
+func (s *Server) unregisterGateway(gc *gatewayConn) {
+	s.gatewaysMu.Lock()
+	if cur, ok := s.gateways[gc.id]; ok && cur == gc {
+		delete(s.gateways, gc.id)
+	}
+	s.gatewaysMu.Unlock()
+	log.Info().Str("gateway", gc.id).Msg("gateway disconnected")
+}
+
+// trackRoute 记录玩家所在的网关
+func (s *Server) trackRoute(roomID uint64, uid int64, gatewayID string) {
+	s.routesMu.RLock()
+	cur, ok := s.routes[roomID][uid]
+	s.routesMu.RUnlock()
+	if ok && cur == gatewayID {
+		return
+	}
+	s.routesMu.Lock()
+	players, ok := s.routes[roomID]
+	if !ok {
+		players = make(map[int64]string)
+		s.routes[roomID] = players
+	}
+	players[uid] = gatewayID
+	s.routesMu.Unlock()
+}
+
+// dropRoutes 删除房间的路由信息
+func (s *Server) dropRoutes(roomID uint64) {
+	s.routesMu.Lock()
+	delete(s.routes, roomID)
+	s.routesMu.Unlock()
+}
+
+// dropRoute 删除单个玩家的路由信息
+func (s *Server) dropRoute(roomID uint64, uid int64) {
+	s.routesMu.Lock()
+	if players, ok := s.routes[roomID]; ok {
+		delete(players, uid)
+	}
+	s.routesMu.Unlock()
+}
+
+// routeTargets 返回下行包需要发往的网关
+// 单播发往玩家所在网关，广播发往房间内玩家涉及的所有网关
+func (s *Server) routeTargets(roomID uint64, targetUID int64) []*gatewayConn {
+	s.routesMu.RLock()
+	var ids []string
+	if targetUID != 0 {
+		if id, ok := s.routes[roomID][targetUID]; ok {
+			ids = append(ids, id)
+		}
+	} else {
+		seen := make(map[string]struct{})
+		for _, id := range s.routes[roomID] {
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				ids = append(ids, id)
+			}
+		}
+	}
+	s.routesMu.RUnlock()
+
+	s.gatewaysMu.RLock()
+	defer s.gatewaysMu.RUnlock()
+	targets := make([]*gatewayConn, 0, len(ids))
+	for _, id := range ids {
+		if gc, ok := s.gateways[id]; ok {
+			targets = append(targets, gc)
+		}
+	}
+	return targets
+}
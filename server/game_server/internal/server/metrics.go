@@ -0,0 +1,71 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zrurf/quiver/server/game/internal/monitor"
+)
+
+var (
+	roomsDesc = prometheus.NewDesc(
+		"quiver_game_rooms",
+		"Rooms hosted by this server.",
+		nil, nil,
+	)
+	roomPlayersDesc = prometheus.NewDesc(
+		"quiver_game_room_players",
+		"Players in each room.",
+		[]string{"room"}, nil,
+	)
+	gatewaysDesc = prometheus.NewDesc(
+		"quiver_game_gateways",
+		"Connected gateways.",
+		nil, nil,
+	)
+	drainingDesc = prometheus.NewDesc(
+		"quiver_game_draining",
+		"Whether the server is draining (1) or not (0).",
+		nil, nil,
+	)
+)
+
+// serverCollector 在抓取时从服务器当前状态生成房间与玩家指标
+type serverCollector struct {
+	s *Server
+}
+
+func (c *serverCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- roomsDesc
+	ch <- roomPlayersDesc
+	ch <- gatewaysDesc
+	ch <- drainingDesc
+}
+
+func (c *serverCollector) Collect(ch chan<- prometheus.Metric) {
+	rooms := c.s.roomList()
+	ch <- prometheus.MustNewConstMetric(roomsDesc, prometheus.GaugeValue, float64(len(rooms)))
+	for _, r := range rooms {
+		ch <- prometheus.MustNewConstMetric(roomPlayersDesc, prometheus.GaugeValue, float64(r.PlayerCount()), strconv.FormatUint(r.ID(), 10))
+	}
+
+	c.s.gatewaysMu.RLock()
+	gateways := len(c.s.gateways)
+	c.s.gatewaysMu.RUnlock()
+	ch <- prometheus.MustNewConstMetric(gatewaysDesc, prometheus.GaugeValue, float64(gateways))
+
+	draining := 0.0
+	if c.s.draining.Load() {
+		draining = 1
+	}
+	ch <- prometheus.MustNewConstMetric(drainingDesc, prometheus.GaugeValue, draining)
+}
+
+// StartMetrics 注册服务器指标并启动监控 HTTP 服务
+func (s *Server) StartMetrics() {
+	prometheus.MustRegister(&serverCollector{s: s})
+	if s.cfg.Metrics.Listen == "" {
+		return
+	}
+	go monitor.StartServer(s.cfg.Metrics.Listen, s.cfg.Metrics.Pprof)
+}
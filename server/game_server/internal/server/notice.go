@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// 停止前等待通知发往网关的时间
+const shutdownNoticeDelay = 200 * time.Millisecond
+
+// 通知类型与原因码，取值为网关 net_proto.NoticeKind / net_proto.NoticeReason 的枚举名称
+const (
+	noticeKindMaintenance    = "Maintenance"
+	noticeKindRoomClosing    = "RoomClosing"
+	noticeKindServerShutdown = "ServerShutdown"
+
+	noticeReasonMaintenance    = "Maintenance"
+	noticeReasonServerShutdown = "ServerShutdown"
+)
+
+// notice 经控制帧发给网关的系统通知，由网关转换为 SystemMessage 下发给玩家
+// RoomID 为 0 时发给本服务器上的所有玩家，UID 为 0 时发给房间内所有玩家
+type notice struct {
+	Kind     string `json:"kind"`
+	Reason   string `json:"reason"`
+	Message  string `json:"message,omitempty"`
+	Deadline int64  `json:"deadline,omitempty"` // 毫秒时间戳
+	RoomID   uint64 `json:"room_id,omitempty"`
+	UID      int64  `json:"uid,omitempty"`
+}
+
+// sendNotice 向相关网关发送通知控制帧
+func (s *Server) sendNotice(n notice) {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return
+	}
+	data := make([]byte, 1+len(body))
+	data[0] = ctrlNotice
+	copy(data[1:], body)
+	packet := encodeFrame(0, 0, data)
+
+	var targets []*gatewayConn
+	if n.RoomID != 0 {
+		targets = s.routeTargets(n.RoomID, n.UID)
+	} else {
+		s.gatewaysMu.RLock()
+		for _, gc := range s.gateways {
+			targets = append(targets, gc)
+		}
+		s.gatewaysMu.RUnlock()
+	}
+	for _, gc := range targets {
+		if !gc.send(packet) {
+			log.Warn().Str("gateway", gc.id).Str("kind", n.Kind).Msg("gateway send queue full, notice dropped")
+		}
+	}
+}
+
+// deadlineMillis 返回毫秒时间戳，零值返回0
+func deadlineMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
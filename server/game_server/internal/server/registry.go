@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/game/internal/model"
+)
+
+// advertiseAddr 返回网关连接本服务器使用的地址
+// 未配置时使用主机名加监听端口
+func (s *Server) advertiseAddr() string {
+	if s.cfg.Server.AdvertiseAddr != "" {
+		return s.cfg.Server.AdvertiseAddr
+	}
+	_, port, err := net.SplitHostPort(s.cfg.Server.ListenAddr)
+	if err != nil {
+		port = "18650"
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// collectLoad 统计当前负载
+func (s *Server) collectLoad() *model.GameServerInfo {
+	s.roomsMu.RLock()
+	defer s.roomsMu.RUnlock()
+	info := &model.GameServerInfo{
+		Addr:      s.advertiseAddr(),
+		MaxRooms:  s.cfg.Server.MaxRooms,
+		Rooms:     len(s.rooms),
+		Draining:  s.draining.Load(),
+		StartedAt: s.startedAt.Unix(),
+		UpdatedAt: time.Now().Unix(),
+	}
+	for _, r := range s.rooms {
+		info.Players += r.PlayerCount()
+		info.TickOverrun += r.TakeTickOverruns()
+	}
+	return info
+}
+
+// StartRegistry 定期向 IMDB 上报注册信息与负载，直到服务器停止
+func (s *Server) StartRegistry() {
+	interval := s.registryInterval()
+	ttl := s.registryTTL()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		s.heartbeat(ttl)
+		for {
+			select {
+			case <-s.stopCh:
+				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				defer cancel()
+				if err := s.registryDAO.Deregister(ctx, s.advertiseAddr()); err != nil {
+					log.Error().Err(err).Msg("failed to deregister game server")
+				}
+				return
+			case <-ticker.C:
+				s.heartbeat(ttl)
+			}
+		}
+	}()
+	log.Info().Str("addr", s.advertiseAddr()).Dur("interval", interval).Msg("game server registry started")
+}
+
+func (s *Server) heartbeat(ttl time.Duration) {
+	info := s.collectLoad()
+	if info.TickOverrun > 0 {
+		log.Warn().Int64("overrun", info.TickOverrun).Msg("tick budget exceeded since last heartbeat")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.registryDAO.Heartbeat(ctx, info, ttl); err != nil {
+		log.Error().Err(err).Msg("game server heartbeat failed")
+	}
+}
+
+func (s *Server) registryInterval() time.Duration {
+	if s.cfg.Registry.HeartbeatInterval <= 0 {
+		return 2 * time.Second
+	}
+	return s.cfg.Registry.HeartbeatInterval
+}
+
+func (s *Server) registryTTL() time.Duration {
+	if ttl := s.cfg.Registry.TTL; ttl > s.registryInterval() {
+		return ttl
+	}
+	return 5 * s.registryInterval()
+}
@@ -1,21 +1,26 @@
 package server
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"io"
 	"net"
-	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
 	"github.com/zrurf/quiver/server/game/internal"
 	"github.com/zrurf/quiver/server/game/internal/dao"
 	"github.com/zrurf/quiver/server/game/internal/game"
+	"github.com/zrurf/quiver/server/game/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Server struct {
@@ -23,28 +28,45 @@ type Server struct {
 	db          *pgxpool.Pool
 	rdb         *redis.Client
 	natsConn    *nats.Conn
+	js          jetstream.JetStream
 	enc         *internal.Encryptor
 	comp        *internal.Compressor
 	playerDAO   *dao.PlayerDAO
+	registryDAO *dao.RegistryDAO
+	roomDAO     *dao.RoomDAO
+	draining    atomic.Bool   // 排空中：不再创建新房间
+	drainDone   chan struct{} // 排空结束时关闭
 	rooms       map[uint64]*game.Room
 	roomsMu     sync.RWMutex
 	listener    net.Listener
+	conns       map[net.Conn]struct{} // 所有已接受的连接（包括尚未握手的），Stop 后为 nil
+	connsMu     sync.Mutex
 	stopCh      chan struct{}
+	startedAt   time.Time
 	wg          sync.WaitGroup
-	gatewayConn net.Conn
-	connMu      sync.Mutex
+	gateways    map[string]*gatewayConn // 网关ID -> 连接
+	gatewaysMu  sync.RWMutex
+	routes      map[uint64]map[int64]string // 房间ID -> UID -> 玩家所在网关ID
+	routesMu    sync.RWMutex
 }
 
 func NewServer(cfg *internal.Config, db *pgxpool.Pool, rdb *redis.Client, enc *internal.Encryptor, comp *internal.Compressor) *Server {
 	return &Server{
-		cfg:       cfg,
-		db:        db,
-		rdb:       rdb,
-		enc:       enc,
-		comp:      comp,
-		playerDAO: dao.NewPlayerDAO(db, rdb),
-		rooms:     make(map[uint64]*game.Room),
-		stopCh:    make(chan struct{}),
+		cfg:         cfg,
+		db:          db,
+		rdb:         rdb,
+		enc:         enc,
+		comp:        comp,
+		playerDAO:   dao.NewPlayerDAO(db, rdb),
+		registryDAO: dao.NewRegistryDAO(rdb),
+		roomDAO:     dao.NewRoomDAO(rdb),
+		startedAt:   time.Now(),
+		rooms:       make(map[uint64]*game.Room),
+		conns:       make(map[net.Conn]struct{}),
+		stopCh:      make(chan struct{}),
+		drainDone:   make(chan struct{}),
+		gateways:    make(map[string]*gatewayConn),
+		routes:      make(map[uint64]map[int64]string),
 	}
 }
 
@@ -74,50 +96,44 @@ func (s *Server) acceptLoop() {
 				continue
 			}
 		}
-		// 假设只接受一个网关连接，如果有新连接则替换旧的
-		s.connMu.Lock()
-		if s.gatewayConn != nil {
-			s.gatewayConn.Close()
-		}
-		s.gatewayConn = conn
-		s.connMu.Unlock()
 		log.Info().Str("remote", conn.RemoteAddr().String()).Msg("gateway connected")
+		if !s.trackConn(conn) {
+			conn.Close()
+			continue
+		}
 
 		s.wg.Add(1)
 		go s.handleConn(conn)
 	}
 }
 
+// handleConn 处理一个网关连接
+// 网关连接后首先发送握手控制帧声明自身ID；未发送握手的旧版网关以远端地址作为ID
 func (s *Server) handleConn(conn net.Conn) {
+	var gc *gatewayConn
 	defer func() {
-		conn.Close()
-		s.connMu.Lock()
-		if s.gatewayConn == conn {
-			s.gatewayConn = nil
+		if gc != nil {
+			s.unregisterGateway(gc)
+			gc.close()
+		} else {
+			conn.Close()
 		}
-		s.connMu.Unlock()
+		s.untrackConn(conn)
 		s.wg.Done()
 	}()
 
-	buf := make([]byte, 4)
+	header := make([]byte, 4)
 	for {
 		conn.SetReadDeadline(time.Now().Add(30 * time.Second))
-		if _, err := io.ReadFull(conn, buf); err != nil {
-			if err != io.EOF {
-				log.Error().Err(err).Msg("read length header error")
+		data, err := readFrame(conn, header)
+		if err != nil {
+			if errors.Is(err, errFrameTooLarge) {
+				log.Error().Msg("packet too large")
+			} else if err != io.EOF {
+				log.Error().Err(err).Msg("read packet error")
 			}
 			return
 		}
-		msgLen := binary.LittleEndian.Uint32(buf)
-		if msgLen > 65536 {
-			log.Error().Uint32("len", msgLen).Msg("packet too large")
-			return
-		}
-		data := make([]byte, msgLen)
-		if _, err := io.ReadFull(conn, data); err != nil {
-			log.Error().Err(err).Msg("read packet body error")
-			return
-		}
 		if len(data) < 16 {
 			log.Error().Msg("packet too short")
 			continue
@@ -126,6 +142,36 @@ func (s *Server) handleConn(conn net.Conn) {
 		uid := int64(binary.BigEndian.Uint64(data[8:16]))
 		payload := data[16:]
 
+		// 控制帧
+		if roomID == 0 {
+			if len(payload) == 0 {
+				continue
+			}
+			switch payload[0] {
+			case ctrlGatewayHello:
+				if gc != nil {
+					log.Warn().Str("gateway", gc.id).Msg("duplicate gateway hello ignored")
+					continue
+				}
+				gc = newGatewayConn(string(payload[1:]), conn)
+				s.registerGateway(gc)
+			case ctrlKeepalive:
+			case ctrlPlayerLeave:
+				s.handlePlayerLeave(payload[1:])
+			case ctrlPlayerLatency:
+				s.handlePlayerLatency(payload[1:])
+			default:
+				log.Warn().Uint8("op", payload[0]).Msg("unknown control frame")
+			}
+			continue
+		}
+
+		if gc == nil {
+			gc = newGatewayConn(conn.RemoteAddr().String(), conn)
+			s.registerGateway(gc)
+		}
+		s.trackRoute(roomID, uid, gc.id)
+
 		r := s.getOrCreateRoom(roomID)
 		if r == nil {
 			log.Error().Uint64("room", roomID).Msg("failed to get/create room")
@@ -135,6 +181,45 @@ func (s *Server) handleConn(conn net.Conn) {
 	}
 }
 
+// handlePlayerLeave 玩家离开房间：移除玩家（数据异步保存），不再向其下发房间数据
+func (s *Server) handlePlayerLeave(body []byte) {
+	if len(body) < 16 {
+		log.Error().Msg("player leave frame too short")
+		return
+	}
+	roomID := binary.BigEndian.Uint64(body[:8])
+	uid := int64(binary.BigEndian.Uint64(body[8:16]))
+	s.dropRoute(roomID, uid)
+
+	s.roomsMu.RLock()
+	r, ok := s.rooms[roomID]
+	s.roomsMu.RUnlock()
+	if !ok {
+		return
+	}
+	r.RemovePlayer(uid)
+}
+
+// handlePlayerLatency 记录网关测得的玩家延迟，供延迟补偿使用
+func (s *Server) handlePlayerLatency(body []byte) {
+	if len(body) < 24 {
+		log.Error().Msg("player latency frame too short")
+		return
+	}
+	roomID := binary.BigEndian.Uint64(body[:8])
+	uid := int64(binary.BigEndian.Uint64(body[8:16]))
+	rtt := time.Duration(binary.BigEndian.Uint32(body[16:20])) * time.Microsecond
+	jitter := time.Duration(binary.BigEndian.Uint32(body[20:24])) * time.Microsecond
+
+	s.roomsMu.RLock()
+	r, ok := s.rooms[roomID]
+	s.roomsMu.RUnlock()
+	if !ok {
+		return
+	}
+	r.SetPlayerLatency(uid, rtt, jitter)
+}
+
 func (s *Server) getOrCreateRoom(roomID uint64) *game.Room {
 	s.roomsMu.RLock()
 	r, ok := s.rooms[roomID]
@@ -142,100 +227,95 @@ func (s *Server) getOrCreateRoom(roomID uint64) *game.Room {
 	if ok {
 		return r
 	}
+	if s.draining.Load() {
+		log.Warn().Uint64("room", roomID).Msg("server draining, room not created")
+		return nil
+	}
+
+	// 由其他服务器迁移而来的房间从快照恢复
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	snap, err := s.roomDAO.TakeSnapshot(ctx, roomID)
+	cancel()
+	if err != nil {
+		log.Error().Err(err).Uint64("room", roomID).Msg("failed to load room snapshot")
+	}
+
 	s.roomsMu.Lock()
 	defer s.roomsMu.Unlock()
 	if r, ok = s.rooms[roomID]; ok {
 		return r
 	}
-	r = game.NewRoom(roomID, s.cfg, s.playerDAO, s.enc, s.comp,
-		func(roomID uint64) {
-			s.roomsMu.Lock()
-			delete(s.rooms, roomID)
-			s.roomsMu.Unlock()
-		},
-		s.sendToGateway,
-	)
+	if snap != nil {
+		r = game.NewRoom(roomID, s.cfg, s.playerDAO, s.enc, s.comp,
+			s.onRoomDestroyed,
+			s.sendToGateway,
+			snap.AvgRating,
+		)
+		r.Restore(snap)
+		log.Info().Uint64("room", roomID).Int("players", len(snap.Players)).Msg("room restored from migration snapshot")
+	} else {
+		r = game.NewRoom(roomID, s.cfg, s.playerDAO, s.enc, s.comp,
+			s.onRoomDestroyed,
+			s.sendToGateway,
+		)
+		log.Info().Uint64("room", roomID).Msg("room created")
+	}
 	s.rooms[roomID] = r
-	log.Info().Uint64("room", roomID).Msg("room created")
 	return r
 }
 
-// sendToGateway 将数据发送给网关（添加长度头）
-func (s *Server) sendToGateway(roomID uint64, targetUID int64, payload []byte) {
-	s.connMu.Lock()
-	defer s.connMu.Unlock()
-	if s.gatewayConn == nil {
-		log.Error().Msg("no gateway connection")
-		return
-	}
-	// 组装内部头部：8字节房间ID + 8字节目标UID
-	header := make([]byte, 16)
-	binary.BigEndian.PutUint64(header[0:8], roomID)
-	binary.BigEndian.PutUint64(header[8:16], uint64(targetUID))
-	fullData := append(header, payload...)
-
-	// 添加4字节长度头
-	packet := make([]byte, 4+len(fullData))
-	binary.LittleEndian.PutUint32(packet[0:4], uint32(len(fullData)))
-	copy(packet[4:], fullData)
+// createRoom 按请求创建房间，房间已存在时直接返回
+func (s *Server) createRoom(ctx context.Context, roomID uint64, initRating float64) (_ *game.Room, err error) {
+	_, span := tracing.Start(ctx, "gameserver.createRoom", trace.WithAttributes(
+		attribute.Int64("room.id", int64(roomID)),
+		attribute.Float64("room.init_rating", initRating),
+	))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
 
-	_, err := s.gatewayConn.Write(packet)
-	if err != nil {
-		log.Error().Err(err).Msg("write to gateway failed")
+	if s.draining.Load() {
+		return nil, errDraining
+	}
+	s.roomsMu.Lock()
+	defer s.roomsMu.Unlock()
+	if r, ok := s.rooms[roomID]; ok {
+		span.SetAttributes(attribute.Bool("room.existing", true))
+		return r, nil
+	}
+	if s.cfg.Server.MaxRooms > 0 && len(s.rooms) >= s.cfg.Server.MaxRooms {
+		return nil, errRoomFull
 	}
+	r := game.NewRoom(roomID, s.cfg, s.playerDAO, s.enc, s.comp,
+		s.onRoomDestroyed,
+		s.sendToGateway,
+		initRating)
+	s.rooms[roomID] = r
+	log.Info().Uint64("room", roomID).Msg("room pre-created via NATS")
+	return r, nil
 }
 
-func (s *Server) StartNATSListener() {
-	nc, err := nats.Connect(s.cfg.Mq.Addr)
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to connect to NATS")
+// sendToGateway 将数据发送给房间玩家所在的网关
+func (s *Server) sendToGateway(roomID uint64, targetUID int64, payload []byte) {
+	targets := s.routeTargets(roomID, targetUID)
+	if len(targets) == 0 {
+		return
 	}
-	s.natsConn = nc
-	_, err = nc.Subscribe("room.created", func(msg *nats.Msg) {
-		parts := strings.Split(string(msg.Data), ":")
-		if len(parts) != 3 {
-			return
-		}
-		roomID, _ := strconv.ParseUint(parts[0], 10, 64)
-		initRating, _ := strconv.ParseFloat(parts[2], 64)
-		// 如果房间未创建，则创建
-		s.roomsMu.Lock()
-		defer s.roomsMu.Unlock()
-		if _, ok := s.rooms[roomID]; !ok {
-			room := game.NewRoom(roomID, s.cfg, s.playerDAO, s.enc, s.comp,
-				func(id uint64) { s.removeRoom(id) },
-				s.sendToGateway,
-				initRating)
-			s.rooms[roomID] = room
-			log.Info().Uint64("room", roomID).Msg("room pre-created via NATS")
+	packet := encodeFrame(roomID, targetUID, payload)
+	for _, gc := range targets {
+		if !gc.send(packet) {
+			log.Warn().Str("gateway", gc.id).Uint64("room", roomID).Msg("gateway send queue full, packet dropped")
 		}
-	})
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to subscribe to room.created")
-	}
-	_, err = s.natsConn.Subscribe("room.destroyed", func(msg *nats.Msg) {
-		roomID, err := strconv.ParseUint(string(msg.Data), 10, 64)
-		if err != nil {
-			log.Error().Err(err).Str("data", string(msg.Data)).Msg("invalid room.destroyed message")
-			return
-		}
-		s.roomsMu.Lock()
-		room, ok := s.rooms[roomID]
-		if ok {
-			room.Stop()
-		}
-		s.roomsMu.Unlock()
-	})
-	if err != nil {
-		log.Error().Err(err).Msg("failed to subscribe to room.destroyed")
 	}
 }
 
-func (s *Server) removeRoom(roomID uint64) {
+// onRoomDestroyed 房间销毁回调
+func (s *Server) onRoomDestroyed(roomID uint64) {
 	s.roomsMu.Lock()
-	s.rooms[roomID].Stop()
 	delete(s.rooms, roomID)
 	s.roomsMu.Unlock()
+	s.dropRoutes(roomID)
 }
 
 func (s *Server) Stop() {
@@ -243,10 +323,62 @@ func (s *Server) Stop() {
 	if s.listener != nil {
 		s.listener.Close()
 	}
+	// 仍有房间（排空被跳过）时通知玩家服务器停止，并留出时间让网关收到通知
+	if rooms := s.roomList(); len(rooms) > 0 {
+		for _, r := range rooms {
+			s.sendNotice(notice{Kind: noticeKindServerShutdown, Reason: noticeReasonServerShutdown, RoomID: r.ID()})
+		}
+		time.Sleep(shutdownNoticeDelay)
+	}
+	s.gatewaysMu.RLock()
+	for _, gc := range s.gateways {
+		gc.close()
+	}
+	s.gatewaysMu.RUnlock()
+	// 尚未发送握手的连接不在 gateways 中，同样关闭，否则要等读超时（30s）才退出
+	s.closeConns()
 	s.wg.Wait()
-	s.roomsMu.Lock()
-	for _, r := range s.rooms {
+	// 房间停止时会回调 onRoomDestroyed 获取写锁，因此先复制列表
+	for _, r := range s.roomList() {
 		r.Stop()
 	}
-	s.roomsMu.Unlock()
+}
+
+// trackConn 登记已接受的连接，服务器已停止时返回 false
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if s.conns == nil {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+// untrackConn 连接处理结束后移除登记
+func (s *Server) untrackConn(conn net.Conn) {
+	s.connsMu.Lock()
+	delete(s.conns, conn)
+	s.connsMu.Unlock()
+}
+
+// closeConns 关闭所有已接受的连接，之后接受的连接会被立即关闭
+func (s *Server) closeConns() {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+// roomList 返回当前所有房间
+func (s *Server) roomList() []*game.Room {
+	s.roomsMu.RLock()
+	defer s.roomsMu.RUnlock()
+	rooms := make([]*game.Room, 0, len(s.rooms))
+	for _, r := range s.rooms {
+		rooms = append(rooms, r)
+	}
+	return rooms
 }
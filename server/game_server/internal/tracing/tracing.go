@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/zrurf/quiver/server/game"
+
+// Options 链路追踪配置
+type Options struct {
+	Enabled     bool
+	Endpoint    string  // OTLP/HTTP 收集器地址，如 "otel-collector:4318"
+	Insecure    bool    // 使用 HTTP 而非 HTTPS
+	SampleRatio float64 // 根 span 采样率（0~1）
+}
+
+// Init 初始化全局 TracerProvider 与上下文传播格式（W3C Trace Context）
+// 未启用时仍设置传播器，使上游传入的追踪上下文能够继续向下游传递
+func Init(ctx context.Context, opts Options, service, instance string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !opts.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporterOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx, resource.WithAttributes(
+		semconv.ServiceName(service),
+		semconv.ServiceInstanceID(instance),
+	))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	log.Info().Str("endpoint", opts.Endpoint).Float64("ratio", opts.SampleRatio).Msg("tracing enabled")
+	return tp.Shutdown, nil
+}
+
+// Start 开始一个 span
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// HeaderCarrier 适配 NATS 消息头，用于注入/提取追踪上下文
+type HeaderCarrier nats.Header
+
+func (c HeaderCarrier) Get(key string) string { return nats.Header(c).Get(key) }
+
+func (c HeaderCarrier) Set(key, value string) { nats.Header(c).Set(key, value) }
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Inject 将 ctx 中的追踪上下文写入 NATS 消息头
+func Inject(ctx context.Context, msg *nats.Msg) {
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, HeaderCarrier(msg.Header))
+}
+
+// Extract 从 NATS 消息头提取追踪上下文
+func Extract(ctx context.Context, header nats.Header) context.Context {
+	if header == nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, HeaderCarrier(header))
+}
+
+// RecordError 记录错误并标记 span 失败
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
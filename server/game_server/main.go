@@ -7,8 +7,11 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/exaring/otelpgx"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -16,6 +19,7 @@ import (
 	"github.com/spf13/viper"
 	"github.com/zrurf/quiver/server/game/internal"
 	"github.com/zrurf/quiver/server/game/internal/server"
+	"github.com/zrurf/quiver/server/game/internal/tracing"
 )
 
 func main() {
@@ -32,6 +36,22 @@ func main() {
 
 	log.Info().Any("config", config).Msg("Config body")
 
+	// 初始化链路追踪
+	instance := config.Server.AdvertiseAddr
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Options{
+		Enabled:     config.Tracing.Enabled,
+		Endpoint:    config.Tracing.Endpoint,
+		Insecure:    config.Tracing.Insecure,
+		SampleRatio: config.Tracing.SampleRatio,
+	}, "quiver-game-server", instance)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to init tracing")
+	}
+	defer shutdownTracing(context.Background())
+
 	// 初始化基础设施
 	dbPool, err := initDB(config)
 	if err != nil {
@@ -67,11 +87,28 @@ func main() {
 	}()
 
 	go srv.StartNATSListener()
+	srv.StartRegistry()
+	srv.StartMetrics()
 
 	// 等待退出信号
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
+
+	// 排空：等待房间结束或超时后迁移，期间再次收到信号则立即退出
+	log.Info().Dur("timeout", config.Server.DrainTimeout).Msg("draining...")
+	ctx, cancel := context.WithTimeout(context.Background(), config.Server.DrainTimeout)
+	go func() {
+		select {
+		case <-quit:
+			log.Warn().Msg("received second signal, skipping drain")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	srv.Drain(ctx)
+	cancel()
+
 	log.Info().Msg("shutting down...")
 	srv.Stop()
 }
@@ -95,7 +132,7 @@ func initConfig() (*internal.Config, error) {
 	}
 
 	v.SetEnvPrefix("QUIVER")
-	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
 	v.AutomaticEnv()
 
 	pflag.CommandLine.VisitAll(func(f *pflag.Flag) {
@@ -127,6 +164,23 @@ func initFlag() {
 	pflag.String("server.listen-addr", ":18650", "Server TCP listen address")
 	pflag.Duration("server.idle-room-timeout", 5*60, "Idle room timeout (seconds)")
 	pflag.Int("server.max-players-per-room", 50, "Maximum number of players per room")
+	pflag.String("server.advertise-addr", "", "Address gateways use to reach this server (default: hostname + listen port)")
+	pflag.Int("server.max-rooms", 200, "Maximum number of rooms hosted by this server (0 = unlimited)")
+	pflag.Duration("server.drain-timeout", 10*time.Minute, "Maximum time to wait for rooms to finish before migrating them on shutdown")
+
+	// Registry
+	pflag.Duration("registry.heartbeat-interval", 2*time.Second, "Interval of registry heartbeats")
+	pflag.Duration("registry.ttl", 10*time.Second, "Registry entry TTL")
+
+	// Metrics
+	pflag.String("metrics.listen", ":9100", "Metrics HTTP listen address (empty to disable)")
+	pflag.Bool("metrics.pprof", false, "Expose pprof under /debug/pprof/ on the metrics server")
+
+	// Tracing
+	pflag.Bool("tracing.enabled", false, "Export OpenTelemetry traces")
+	pflag.String("tracing.endpoint", "otel-collector:4318", "OTLP/HTTP collector endpoint (host:port)")
+	pflag.Bool("tracing.insecure", true, "Use plain HTTP to the collector")
+	pflag.Float64("tracing.sample-ratio", 1.0, "Sampling ratio for root spans (0-1)")
 
 	// Logger
 	pflag.String("logger.level", "info", "Log level (debug, info, warn, error, fatal)")
@@ -143,7 +197,7 @@ func initFlag() {
 
 	// MQ
 	pflag.String("mq.addr", "nats://localhost:4222", "Message queue address")
-	pflag.String("mq.subject", "default", "Message queue subject/topic")
+	pflag.String("mq.subject", "quiver.events", "Subject prefix shared by all services for events")
 
 	// Encryption
 	pflag.Bool("encryption.enabled", false, "Enable encryption")
@@ -180,6 +234,9 @@ func initIMDB(config *internal.Config) (*redis.Client, error) {
 	imdb := redis.NewClient(&redis.Options{
 		Addr: config.IMDB.Addr,
 	})
+	if err := redisotel.InstrumentTracing(imdb); err != nil {
+		log.Error().Err(err).Msg("failed to instrument imdb tracing")
+	}
 	_, err := imdb.Ping(context.Background()).Result()
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to connect to imdb")
@@ -188,11 +245,16 @@ func initIMDB(config *internal.Config) (*redis.Client, error) {
 }
 
 func initDB(config *internal.Config) (*pgxpool.Pool, error) {
-	dbPool, err := pgxpool.New(context.Background(), fmt.Sprintf(
+	poolConfig, err := pgxpool.ParseConfig(fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s",
 		config.Database.Host, config.Database.Port, config.Database.User,
 		config.Database.Password, config.Database.Name,
 	))
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid database config")
+	}
+	poolConfig.ConnConfig.Tracer = otelpgx.NewTracer()
+	dbPool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to connect to user db")
 	}
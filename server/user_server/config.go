@@ -1,12 +1,25 @@
 package main
 
+import "time"
+
 type Config struct {
 	Server struct {
-		Listen string `mapstructure:"listen"`
+		Listen         string   `mapstructure:"listen"`
+		ProxyHeader    string   `mapstructure:"proxy-header"`
+		TrustedProxies []string `mapstructure:"trusted-proxies"`
 	} `mapstructure:"server"`
+	Admin struct {
+		Token string `mapstructure:"token"`
+	} `mapstructure:"admin"`
 	Logger struct {
 		Level string `mapstructure:"level"`
 	} `mapstructure:"logger"`
+	Tracing struct {
+		Enabled     bool    `mapstructure:"enabled"`
+		Endpoint    string  `mapstructure:"endpoint"`
+		Insecure    bool    `mapstructure:"insecure"`
+		SampleRatio float64 `mapstructure:"sample-ratio"`
+	} `mapstructure:"tracing"`
 	Database struct {
 		Host     string `mapstructure:"host"`
 		Port     string `mapstructure:"port"`
@@ -21,9 +34,46 @@ type Config struct {
 		Addr    string `mapstructure:"addr"`
 		Subject string `mapstructure:"subject"`
 	} `mapstructure:"mq"`
+	LoginLimit struct {
+		UserLimit       int           `mapstructure:"user-limit"`
+		UserWindow      time.Duration `mapstructure:"user-window"`
+		IPLimit         int           `mapstructure:"ip-limit"`
+		IPWindow        time.Duration `mapstructure:"ip-window"`
+		BackoffAfter    int           `mapstructure:"backoff-after"`
+		BackoffBase     time.Duration `mapstructure:"backoff-base"`
+		BackoffMax      time.Duration `mapstructure:"backoff-max"`
+		LockoutAfter    int           `mapstructure:"lockout-after"`
+		LockoutDuration time.Duration `mapstructure:"lockout-duration"`
+		FailureWindow   time.Duration `mapstructure:"failure-window"`
+	} `mapstructure:"login-limit"`
+	Username struct {
+		MinLength      int           `mapstructure:"min-length"`
+		MaxLength      int           `mapstructure:"max-length"`
+		ReservedFile   string        `mapstructure:"reserved-file"`
+		ReservationTTL time.Duration `mapstructure:"reservation-ttl"`
+	} `mapstructure:"username"`
+	Token struct {
+		Format      string   `mapstructure:"format"`
+		SigningKeys []string `mapstructure:"signing-keys"`
+	} `mapstructure:"token"`
 	Opaque struct {
 		OPRFSeedFile        string `mapstructure:"oprf-seed-file"`
 		ServerPublicKeyFile string `mapstructure:"server-public-key-file"`
 		ServerSecretKeyFile string `mapstructure:"server-secret-key-file"`
+		KeysetDir           string `mapstructure:"keyset-dir"`
 	} `mapstructure:"opaque"`
 }
+
+// Redacted 返回隐去管理接口令牌与数据库密码的副本，用于打印配置
+func (c Config) Redacted() Config {
+	c.Admin.Token = redactSecret(c.Admin.Token)
+	c.Database.Password = redactSecret(c.Database.Password)
+	return c
+}
+
+func redactSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "******"
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/user/internal/api"
+	"github.com/zrurf/quiver/server/user/internal/dao"
+	"github.com/zrurf/quiver/server/user/internal/model"
+	"github.com/zrurf/quiver/server/user/internal/services"
+)
+
+type AdminHandler struct {
+	audit   *services.AuditService
+	account *services.AccountService
+	auth    *services.AuthService
+}
+
+func NewAdminHandler(audit *services.AuditService, account *services.AccountService, auth *services.AuthService) *AdminHandler {
+	return &AdminHandler{
+		audit:   audit,
+		account: account,
+		auth:    auth,
+	}
+}
+
+// AdminAuth 管理接口鉴权：Authorization: Bearer <admin token>
+func AdminAuth(token string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		got := bearerToken(c)
+		if got == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "invalid admin token", api.StatusErrUnauthorized)
+		}
+		return c.Next()
+	}
+}
+
+// LoginLog 对应 /admin/login-log?uid=&ip=&from=&to=&limit=，from/to 为 RFC 3339 时间
+func (h *AdminHandler) LoginLog(c fiber.Ctx) error {
+	var f model.LoginLogFilter
+	var err error
+	if v := c.Query("uid"); v != "" {
+		if f.UID, err = strconv.ParseInt(v, 10, 64); err != nil || f.UID <= 0 {
+			return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid uid", api.StatusErrInvalidBody)
+		}
+	}
+	if v := c.Query("ip"); v != "" {
+		if net.ParseIP(v) == nil {
+			return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid ip", api.StatusErrInvalidBody)
+		}
+		f.IP = v
+	}
+	if f.From, err = queryTime(c, "from"); err != nil {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid from", api.StatusErrInvalidBody)
+	}
+	if f.To, err = queryTime(c, "to"); err != nil {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid to", api.StatusErrInvalidBody)
+	}
+	f.Username = c.Query("username")
+	f.Limit = fiber.Query[int](c, "limit")
+
+	items, err := h.audit.QueryLoginLog(c.Context(), f)
+	if err != nil {
+		log.Error().Any("ctx", c).Err(err).Msg("query login log failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "query login log failed", api.StatusErrServer)
+	}
+	return api.Success(c, model.LoginLogResponse{Items: items}, "OK")
+}
+
+// Sanctions 对应 GET /admin/users/:uid/sanctions，返回账号状态与处罚记录
+func (h *AdminHandler) Sanctions(c fiber.Ctx) error {
+	uid, err := strconv.ParseInt(c.Params("uid"), 10, 64)
+	if err != nil {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid uid", api.StatusErrInvalidBody)
+	}
+	status, items, err := h.account.ListSanctions(c.Context(), uid)
+	if err != nil {
+		return sanctionError(c, err)
+	}
+	return api.Success(c, model.SanctionsResponse{Status: status, Items: items}, "OK")
+}
+
+// ApplySanction 对应 POST /admin/users/:uid/sanctions，封禁或暂停账号
+func (h *AdminHandler) ApplySanction(c fiber.Ctx) error {
+	uid, err := strconv.ParseInt(c.Params("uid"), 10, 64)
+	if err != nil {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid uid", api.StatusErrInvalidBody)
+	}
+	var req model.ApplySanctionRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid request body", api.StatusErrInvalidBody)
+	}
+	sanction, revoked, err := h.account.ApplySanction(c.Context(), uid, &req)
+	if err != nil {
+		return sanctionError(c, err)
+	}
+	return api.Success(c, model.SanctionResponse{Sanction: sanction, Revoked: revoked}, "sanction applied")
+}
+
+// LiftSanctions 对应 POST /admin/users/:uid/sanctions/lift，解除所有未解除的处罚
+func (h *AdminHandler) LiftSanctions(c fiber.Ctx) error {
+	uid, err := strconv.ParseInt(c.Params("uid"), 10, 64)
+	if err != nil {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid uid", api.StatusErrInvalidBody)
+	}
+	var req model.LiftSanctionRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid request body", api.StatusErrInvalidBody)
+	}
+	lifted, err := h.account.LiftSanctions(c.Context(), uid, req.Operator)
+	if err != nil {
+		return sanctionError(c, err)
+	}
+	return api.Success(c, model.LiftSanctionsResponse{Lifted: lifted}, "sanctions lifted")
+}
+
+func sanctionError(c fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidSanction):
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, err.Error(), api.StatusErrInvalidBody)
+	case errors.Is(err, dao.ErrUserNotFound):
+		return api.Error(c, fiber.StatusNotFound, api.CodeUserNotFound, "user not found", api.StatusErrUserNotFound)
+	}
+	log.Error().Any("ctx", c).Err(err).Msg("sanction operation failed")
+	return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "sanction operation failed", api.StatusErrServer)
+}
+
+// queryTime 解析 RFC 3339 时间参数，转换为 UTC 与数据库 NOW() 保持一致
+func queryTime(c fiber.Ctx, key string) (time.Time, error) {
+	v := c.Query(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t.UTC(), err
+}
+
+// OpaqueKeys 对应 GET /admin/opaque-keys，返回各 OPAQUE 密钥集版本的用户数，用于判断旧密钥集能否停用
+func (h *AdminHandler) OpaqueKeys(c fiber.Ctx) error {
+	resp, err := h.auth.KeySetUsage(c.Context())
+	if err != nil {
+		log.Error().Any("ctx", c).Err(err).Msg("query opaque key set usage failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "query opaque key set usage failed", api.StatusErrServer)
+	}
+	return api.Success(c, resp, "OK")
+}
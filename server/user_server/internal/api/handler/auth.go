@@ -1,6 +1,10 @@
 package handler
 
 import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
@@ -11,122 +15,214 @@ import (
 )
 
 type AuthHandler struct {
-	auth *services.AuthService
+	auth  *services.AuthService
+	audit *services.AuditService
+	guard *services.LoginGuard
 }
 
-func NewAuthHandler(auth *services.AuthService) *AuthHandler {
+func NewAuthHandler(auth *services.AuthService, audit *services.AuditService, guard *services.LoginGuard) *AuthHandler {
 	return &AuthHandler{
-		auth: auth,
+		auth:  auth,
+		audit: audit,
+		guard: guard,
+	}
+}
+
+// newAttempt 创建审计记录，默认记为请求无效，处理过程中更新结果
+func newAttempt(c fiber.Ctx, action string) *model.LoginAttempt {
+	return &model.LoginAttempt{
+		Action:    action,
+		Reason:    services.ReasonInvalidRequest,
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
 	}
 }
 
 // RegisterInit 对应 /api/auth/register-init
 func (h *AuthHandler) RegisterInit(c fiber.Ctx) error {
+	attempt := newAttempt(c, services.ActionRegisterInit)
+	defer h.audit.RecordAttempt(c.Context(), attempt)
+
 	var req model.RegisterInitRequest
 	if err := c.Bind().Body(&req); err != nil {
 		log.Error().Any("ctx", c).Err(err).Msg("bind request body failed")
 		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid request body", api.StatusErrInvalidBody)
 	}
+	attempt.Username = req.Username
 	if req.Username == "" || len(req.RegistrationRequest) == 0 {
 		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "missing username or registrationRequest", api.StatusErrInvalidBody)
 	}
 
-	if exists, err := h.auth.UsernameExists(c.Context(), req.Username); err != nil {
-		log.Error().Any("ctx", c).Err(err).Msg("failed to check username exists")
-		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "failed to check username exists", api.StatusErrServer)
-	} else if exists {
-		return api.Error(c, fiber.StatusBadRequest, api.CodeRegisterInitFailed, "username already exists", api.StatusErrUsernameConflict)
-	}
-
-	respBytes, pubKey, err := h.auth.RegisterInit(c.Context(), req.Username, req.RegistrationRequest)
+	respBytes, pubKey, sessionID, err := h.auth.RegisterInit(c.Context(), req.Username, req.RegistrationRequest)
 	if err != nil {
+		if resp := usernameError(c, attempt, err); resp != nil {
+			return resp
+		}
+		attempt.Reason = services.ReasonServerError
 		log.Error().Any("ctx", c).Err(err).Msg("register init failed")
 		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "register init failed", api.StatusErrServer)
 	}
 
+	attempt.Success = true
 	log.Info().Str("username", req.Username).Msg("register init OK")
 	return api.Success(c, model.RegisterInitResponse{
 		RegistrationResponse: respBytes,
 		ServerPublicKey:      pubKey,
+		RegistrationSession:  sessionID,
 	}, "register init OK")
 }
 
 // RegisterFinalize 对应 /api/auth/register-finalize
 func (h *AuthHandler) RegisterFinalize(c fiber.Ctx) error {
+	attempt := newAttempt(c, services.ActionRegisterFinalize)
+	defer h.audit.RecordAttempt(c.Context(), attempt)
+
 	var req model.RegisterFinalizeRequest
 	if err := c.Bind().Body(&req); err != nil {
 		log.Error().Any("ctx", c).Err(err).Msg("bind request body failed")
 		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid request body", api.StatusErrInvalidBody)
 	}
-	if req.Username == "" || len(req.RegistrationRecord) == 0 {
-		log.Info().Any("ctx", c).Msg("missing username or registrationRecord")
-		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "missing username or registrationRecord", api.StatusErrInvalidBody)
+	if req.RegistrationSessionID == "" || len(req.RegistrationRecord) == 0 {
+		log.Info().Any("ctx", c).Msg("missing registration_session_id or registrationRecord")
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "missing registration_session_id or registrationRecord", api.StatusErrInvalidBody)
 	}
 
-	if err := h.auth.RegisterFinalize(c.Context(), req.Username, req.RegistrationRecord); err != nil {
+	uid, username, codes, err := h.auth.RegisterFinalize(c.Context(), req.RegistrationSessionID, req.RegistrationRecord)
+	attempt.UID, attempt.Username = uid, username
+	if err != nil {
+		if resp := usernameError(c, attempt, err); resp != nil {
+			return resp
+		}
+		switch {
+		case errors.Is(err, services.ErrRegistrationExpired):
+			attempt.Reason = services.ReasonSessionExpired
+			return api.Error(c, fiber.StatusBadRequest, api.CodeRegisterInitFailed, "registration session expired", api.StatusErrRegistration)
+		case errors.Is(err, services.ErrInvalidRecord):
+			return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid registration record", api.StatusErrInvalidBody)
+		}
+		attempt.Reason = services.ReasonServerError
 		log.Error().Any("ctx", c).Err(err).Msg("register finalize failed")
 		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "register finalize failed", api.StatusErrServer)
 	}
 
-	log.Info().Str("username", req.Username).Msg("register finalize OK")
-	return api.Success(c, model.RegisterFinalizeResponse{OK: true}, "register finalize OK")
+	attempt.Success = true
+	log.Info().Str("username", username).Int64("uid", uid).Msg("register finalize OK")
+	return api.Success(c, model.RegisterFinalizeResponse{OK: true, UID: uid, Username: username, RecoveryCodes: codes}, "register finalize OK")
 }
 
 // LoginInit 对应 /api/auth/login-init
 func (h *AuthHandler) LoginInit(c fiber.Ctx) error {
+	attempt := newAttempt(c, services.ActionLoginInit)
+	defer h.audit.RecordAttempt(c.Context(), attempt)
+
 	var req model.LoginInitRequest
 	if err := c.Bind().Body(&req); err != nil {
 		log.Error().Any("ctx", c).Err(err).Msg("bind request body failed")
 		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid request body", api.StatusErrInvalidBody)
 	}
+	attempt.Username = req.Username
 	if req.Username == "" || len(req.KE1) == 0 {
 		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "missing username or ke1", api.StatusErrInvalidBody)
 	}
 
-	if exists, err := h.auth.UsernameExists(c.Context(), req.Username); err != nil {
-		log.Error().Any("ctx", c).Err(err).Msg("failed to check username exists")
-		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "failed to check username exists", api.StatusErrServer)
-	} else if !exists {
-		return api.Error(c, fiber.StatusBadRequest, api.CodeLoginFailed, "login init failed", api.StatusErrLogin)
+	if err := h.guard.CheckLoginInit(c.Context(), req.Username, attempt.IP); err != nil {
+		return limitError(c, attempt, err)
 	}
 
-	ke2Bytes, _, clientMAC, err := h.auth.LoginInit(c.Context(), req.Username, req.KE1)
+	// 不检查用户名是否存在，不存在的用户由假记录完成相同的流程
+	ke2Bytes, loginSessionID, err := h.auth.LoginInit(c.Context(), req.Username, req.KE1)
 	if err != nil {
+		attempt.Reason = services.ReasonServerError
 		log.Error().Any("ctx", c).Err(err).Msg("login init failed")
 		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "login init failed", api.StatusErrServer)
 	}
 
-	return api.Success(c, model.LoginInitResponse{KE2: ke2Bytes, MAC: clientMAC}, "login init OK")
+	attempt.Success = true
+
+	return api.Success(c, model.LoginInitResponse{KE2: ke2Bytes, LoginSessionID: loginSessionID}, "login init OK")
 }
 
 // LoginFinalize 对应 /api/auth/login-finalize
 func (h *AuthHandler) LoginFinalize(c fiber.Ctx) error {
+	attempt := newAttempt(c, services.ActionLoginFinalize)
+	defer h.audit.RecordAttempt(c.Context(), attempt)
+
 	var req model.LoginFinalizeRequest
 	if err := c.Bind().Body(&req); err != nil {
 		log.Error().Any("ctx", c).Err(err).Msg("bind request body failed")
 		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid request body", api.StatusErrInvalidBody)
 	}
-	if len(req.KE3) == 0 {
-		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "missing ke3", api.StatusErrInvalidBody)
+	if req.LoginSessionID == "" || len(req.KE3) == 0 {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "missing login_session_id or ke3", api.StatusErrInvalidBody)
+	}
+
+	// 用户名取自服务端保存的登录会话，不信任客户端
+	state, err := h.auth.TakeLoginSession(c.Context(), req.LoginSessionID)
+	if err != nil {
+		if errors.Is(err, services.ErrLoginSessionExpired) {
+			attempt.Reason = services.ReasonSessionExpired
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeLoginFailed, "login session expired", api.StatusErrLogin)
+		}
+		attempt.Reason = services.ReasonServerError
+		log.Error().Any("ctx", c).Err(err).Msg("failed to get login session")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "login finalize failed", api.StatusErrServer)
+	}
+	attempt.Username = state.Username
+
+	if err := h.guard.CheckLoginFinalize(c.Context(), state.Username); err != nil {
+		return limitError(c, attempt, err)
 	}
 
-	uid, accessToken, refreshToken, expire, err := h.auth.LoginFinalize(c.Context(), req.Username, req.KE3, req.MAC)
+	result, err := h.auth.LoginFinalize(c.Context(), state, req.KE3)
 	if err != nil {
+		if errors.Is(err, services.ErrAccountDisabled) {
+			attempt.UID = state.UID
+			return accountStatusError(c, attempt, err)
+		}
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			attempt.Reason = services.ReasonInvalidCredentials
+			h.guard.RecordFailure(c.Context(), state.Username)
+		} else {
+			attempt.Reason = services.ReasonServerError
+		}
 		log.Error().Any("ctx", c).Err(err).Msg("login finalize failed")
 		return api.Error(c, fiber.StatusUnauthorized, api.CodeLoginFailed, "login finalize failed", api.StatusErrLogin)
 	}
 
-	log.Info().Str("KE3", string(req.KE3)).Int64("uid", uid).Msg("login finalize OK")
-	return api.Success(c, model.LoginFinalizeResponse{
-		UID:          uid,
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpireAt:     time.Now().UnixMilli() + (expire * 1000),
-	}, "login finalize OK")
+	attempt.UID = result.UID
+	if result.MFASessionID != "" {
+		// 密码正确但需要两步验证，登录结果记录在 2fa/verify
+		attempt.Reason = services.ReasonMFARequired
+		log.Info().Int64("uid", result.UID).Msg("login finalize OK, two-factor required")
+		return api.Success(c, model.LoginFinalizeResponse{
+			UID:          result.UID,
+			MFARequired:  true,
+			MFASessionID: result.MFASessionID,
+		}, "two-factor authentication required")
+	}
+
+	attempt.Success = true
+	h.guard.RecordSuccess(c.Context(), state.Username)
+	log.Info().Str("KE3", string(req.KE3)).Int64("uid", result.UID).Msg("login finalize OK")
+	return api.Success(c, loginResponse(result), "login finalize OK")
+}
+
+// loginResponse 将签发的令牌转换为登录响应
+func loginResponse(result *services.LoginResult) model.LoginFinalizeResponse {
+	return model.LoginFinalizeResponse{
+		UID:          result.UID,
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		ExpireAt:     time.Now().UnixMilli() + (result.Expire * 1000),
+		RekeyTicket:  result.RekeyTicket,
+	}
 }
 
-// RefreshToken 刷新令牌
+// RefreshToken 对应 /api/auth/refresh，轮换访问令牌与刷新令牌
 func (h *AuthHandler) RefreshToken(c fiber.Ctx) error {
+	attempt := newAttempt(c, services.ActionRefresh)
+	defer h.audit.RecordAttempt(c.Context(), attempt)
+
 	var req model.RefreshTokenRequest
 	if err := c.Bind().Body(&req); err != nil {
 		log.Error().Any("ctx", c).Err(err).Msg("bind request body failed")
@@ -137,10 +233,24 @@ func (h *AuthHandler) RefreshToken(c fiber.Ctx) error {
 	}
 	uid, accessToken, refreshToken, expire, err := h.auth.RefreshToken(c.Context(), req.RefreshToken)
 	if err != nil {
-		log.Error().Any("ctx", c).Err(err).Msg("refresh token failed")
+		switch {
+		case errors.Is(err, services.ErrAccountDisabled):
+			attempt.UID = uid
+			return accountStatusError(c, attempt, err)
+		case errors.Is(err, services.ErrInvalidToken):
+			attempt.Reason = services.ReasonInvalidToken
+			log.Info().Err(err).Msg("refresh token rejected")
+		case errors.Is(err, services.ErrRefreshTokenReused):
+			attempt.UID, attempt.Reason = uid, services.ReasonTokenReused
+			log.Info().Err(err).Msg("refresh token rejected")
+		default:
+			attempt.Reason = services.ReasonServerError
+			log.Error().Any("ctx", c).Err(err).Msg("refresh token failed")
+		}
 		return api.Error(c, fiber.StatusUnauthorized, api.CodeRefreshFailed, "refresh token failed", api.StatusErrRefresh)
 	}
-	log.Info().Str("token", string(req.RefreshToken)).Int64("uid", uid).Msg("refresh token successful")
+	attempt.UID, attempt.Success = uid, true
+	log.Info().Int64("uid", uid).Msg("refresh token successful")
 	return api.Success(c, model.LoginFinalizeResponse{
 		UID:          uid,
 		AccessToken:  accessToken,
@@ -148,3 +258,120 @@ func (h *AuthHandler) RefreshToken(c fiber.Ctx) error {
 		ExpireAt:     time.Now().UnixMilli() + (expire * 1000),
 	}, "refresh token successful")
 }
+
+// Logout 对应 /api/auth/logout，吊销当前会话的令牌
+func (h *AuthHandler) Logout(c fiber.Ctx) error {
+	token := bearerToken(c)
+	if token == "" {
+		return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "missing access token", api.StatusErrUnauthorized)
+	}
+	if err := h.auth.Logout(c.Context(), token); err != nil {
+		if errors.Is(err, services.ErrInvalidToken) {
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "invalid access token", api.StatusErrUnauthorized)
+		}
+		log.Error().Any("ctx", c).Err(err).Msg("logout failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "logout failed", api.StatusErrServer)
+	}
+	return api.Success(c, model.LogoutResponse{OK: true}, "logout OK")
+}
+
+// LogoutAll 对应 /api/auth/logout-all，吊销用户的所有会话
+func (h *AuthHandler) LogoutAll(c fiber.Ctx) error {
+	token := bearerToken(c)
+	if token == "" {
+		return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "missing access token", api.StatusErrUnauthorized)
+	}
+	revoked, err := h.auth.LogoutAll(c.Context(), token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidToken) {
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "invalid access token", api.StatusErrUnauthorized)
+		}
+		log.Error().Any("ctx", c).Err(err).Msg("logout all failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "logout all failed", api.StatusErrServer)
+	}
+	return api.Success(c, model.LogoutAllResponse{Revoked: revoked}, "logout all OK")
+}
+
+// limitError 登录被限流或锁定，Retry-After 给出剩余等待秒数
+func limitError(c fiber.Ctx, attempt *model.LoginAttempt, err error) error {
+	var le *services.LimitError
+	if !errors.As(err, &le) {
+		return err
+	}
+	c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(int64(math.Ceil(le.RetryAfter.Seconds())), 10))
+	if errors.Is(le, services.ErrAccountLocked) {
+		attempt.Reason = services.ReasonAccountLocked
+		return api.Error(c, fiber.StatusLocked, api.CodeAccountLocked, "account temporarily locked", api.StatusErrAccountLocked)
+	}
+	attempt.Reason = services.ReasonRateLimited
+	return api.Error(c, fiber.StatusTooManyRequests, api.CodeRateLimited, "too many login attempts", api.StatusErrRateLimited)
+}
+
+// accountStatusError 账号被处罚或停用，返回状态、原因与到期时间
+func accountStatusError(c fiber.Ctx, attempt *model.LoginAttempt, err error) error {
+	var se *services.AccountStatusError
+	if !errors.As(err, &se) {
+		return err
+	}
+	attempt.Reason = services.ReasonAccountPrefix + strings.ToLower(se.Status)
+	payload := model.AccountStatusPayload{Status: se.Status, Reason: se.Reason}
+	if se.ExpiresAt != nil {
+		payload.ExpireAt = se.ExpiresAt.UnixMilli()
+	}
+	status := api.StatusErrAccountDisabled
+	switch se.Status {
+	case model.StatusSuspended:
+		status = api.StatusErrAccountSuspended
+	case model.StatusBanned:
+		status = api.StatusErrAccountBanned
+	}
+	return api.ErrorWithPayload(c, fiber.StatusForbidden, api.CodeAccountDisabled, "account "+strings.ToLower(se.Status), status, payload)
+}
+
+// usernameError 注册时用户名相关的错误，其他错误返回 nil 由调用方处理
+func usernameError(c fiber.Ctx, attempt *model.LoginAttempt, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidUsername):
+		attempt.Reason = services.ReasonInvalidUsername
+		return api.Error(c, fiber.StatusBadRequest, api.CodeRegisterInitFailed, err.Error(), api.StatusErrInvalidUsername)
+	case errors.Is(err, services.ErrUsernameReserved):
+		attempt.Reason = services.ReasonUsernameReserved
+		return api.Error(c, fiber.StatusBadRequest, api.CodeRegisterInitFailed, "username not available", api.StatusErrUsernameReserved)
+	case errors.Is(err, services.ErrUsernameTaken):
+		attempt.Reason = services.ReasonUsernameTaken
+		return api.Error(c, fiber.StatusBadRequest, api.CodeRegisterInitFailed, "username already exists", api.StatusErrUsernameConflict)
+	}
+	return nil
+}
+
+// bearerToken 读取 Authorization: Bearer <token>
+func bearerToken(c fiber.Ctx) string {
+	const prefix = "Bearer "
+	auth := c.Get(fiber.HeaderAuthorization)
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(auth[len(prefix):])
+}
+
+// SignIns 对应 /api/auth/sign-ins，返回当前用户最近的登录记录
+func (h *AuthHandler) SignIns(c fiber.Ctx) error {
+	token := bearerToken(c)
+	if token == "" {
+		return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "missing access token", api.StatusErrUnauthorized)
+	}
+	items, err := h.audit.RecentSignIns(c.Context(), token, fiber.Query[int](c, "limit"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidToken) {
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "invalid access token", api.StatusErrUnauthorized)
+		}
+		log.Error().Any("ctx", c).Err(err).Msg("query sign-ins failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "query sign-ins failed", api.StatusErrServer)
+	}
+	return api.Success(c, model.SignInsResponse{Items: items}, "OK")
+}
+
+// TokenKeys 对应 GET /api/auth/keys，返回签名访问令牌的验签公钥，网关据此在本地校验令牌
+func (h *AuthHandler) TokenKeys(c fiber.Ctx) error {
+	return api.Success(c, model.TokenKeysResponse{Keys: h.auth.TokenKeys()}, "OK")
+}
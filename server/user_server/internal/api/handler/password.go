@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/user/internal/api"
+	"github.com/zrurf/quiver/server/user/internal/model"
+	"github.com/zrurf/quiver/server/user/internal/services"
+)
+
+type PasswordHandler struct {
+	password *services.PasswordService
+	audit    *services.AuditService
+	guard    *services.LoginGuard
+}
+
+func NewPasswordHandler(password *services.PasswordService, audit *services.AuditService, guard *services.LoginGuard) *PasswordHandler {
+	return &PasswordHandler{
+		password: password,
+		audit:    audit,
+		guard:    guard,
+	}
+}
+
+// ChangeInit 对应 /api/auth/password/change-init
+func (h *PasswordHandler) ChangeInit(c fiber.Ctx) error {
+	token := bearerToken(c)
+	if token == "" {
+		return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "missing access token", api.StatusErrUnauthorized)
+	}
+	var req model.PasswordChangeInitRequest
+	if err := c.Bind().Body(&req); err != nil || len(req.RegistrationRequest) == 0 {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "missing registration_request", api.StatusErrInvalidBody)
+	}
+	resp, pubKey, sessionID, err := h.password.ChangeInit(c.Context(), token, req.ReauthToken, req.RekeyTicket, req.RegistrationRequest)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidToken):
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "invalid access token", api.StatusErrUnauthorized)
+		case errors.Is(err, services.ErrReauthRequired):
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeReauthFailed, "re-authentication required", api.StatusErrReauthRequired)
+		}
+		log.Error().Any("ctx", c).Err(err).Msg("password change init failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "password change init failed", api.StatusErrServer)
+	}
+	return api.Success(c, model.PasswordChangeInitResponse{
+		RegistrationResponse: resp,
+		ServerPublicKey:      pubKey,
+		ChangeSessionID:      sessionID,
+	}, "password change init OK")
+}
+
+// ChangeFinalize 对应 /api/auth/password/change-finalize，替换密码并吊销其他会话
+// 由密钥迁移凭据发起的会话只迁移到当前 OPAQUE 密钥集，不吊销其他会话
+func (h *PasswordHandler) ChangeFinalize(c fiber.Ctx) error {
+	var req model.PasswordChangeFinalizeRequest
+	bindErr := c.Bind().Body(&req)
+
+	attempt := newAttempt(c, services.ActionPasswordChange)
+	defer h.audit.RecordAttempt(c.Context(), attempt)
+
+	token := bearerToken(c)
+	if token == "" {
+		attempt.Reason = services.ReasonInvalidToken
+		return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "missing access token", api.StatusErrUnauthorized)
+	}
+	if bindErr != nil || req.ChangeSessionID == "" || len(req.RegistrationRecord) == 0 {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "missing change_session_id or registration_record", api.StatusErrInvalidBody)
+	}
+	uid, revoked, rekey, err := h.password.ChangeFinalize(c.Context(), token, req.ChangeSessionID, req.RegistrationRecord)
+	attempt.UID = uid
+	if rekey {
+		attempt.Action = services.ActionRekey
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidToken):
+			attempt.Reason = services.ReasonInvalidToken
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "invalid access token", api.StatusErrUnauthorized)
+		case errors.Is(err, services.ErrPasswordChangeExpired):
+			attempt.Reason = services.ReasonSessionExpired
+			return api.Error(c, fiber.StatusBadRequest, api.CodeReauthFailed, "password change session expired", api.StatusErrPasswordChange)
+		case errors.Is(err, services.ErrInvalidRecord):
+			return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid registration record", api.StatusErrInvalidBody)
+		case errors.Is(err, services.ErrRekeyNotRequired):
+			return api.Error(c, fiber.StatusConflict, api.CodeInvalidBody, "opaque record already uses the active key set", api.StatusErrRekeyNotRequired)
+		}
+		attempt.Reason = services.ReasonServerError
+		log.Error().Any("ctx", c).Err(err).Msg("password change finalize failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "password change failed", api.StatusErrServer)
+	}
+	attempt.Success = true
+	return api.Success(c, model.PasswordChangeFinalizeResponse{Revoked: revoked}, "password changed")
+}
+
+// RecoveryCodes 对应 GET /api/auth/recovery-codes，返回剩余恢复码数量
+func (h *PasswordHandler) RecoveryCodes(c fiber.Ctx) error {
+	token := bearerToken(c)
+	if token == "" {
+		return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "missing access token", api.StatusErrUnauthorized)
+	}
+	remaining, err := h.password.RemainingRecoveryCodes(c.Context(), token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidToken) {
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "invalid access token", api.StatusErrUnauthorized)
+		}
+		log.Error().Any("ctx", c).Err(err).Msg("query recovery codes failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "query recovery codes failed", api.StatusErrServer)
+	}
+	return api.Success(c, model.RecoveryCodesResponse{Remaining: remaining}, "OK")
+}
+
+// RegenerateRecoveryCodes 对应 POST /api/auth/recovery-codes，需要重新验证凭据，重新生成恢复码，旧恢复码作废
+func (h *PasswordHandler) RegenerateRecoveryCodes(c fiber.Ctx) error {
+	token := bearerToken(c)
+	if token == "" {
+		return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "missing access token", api.StatusErrUnauthorized)
+	}
+	var req model.RecoveryCodesRegenerateRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid request body", api.StatusErrInvalidBody)
+	}
+	codes, err := h.password.RegenerateRecoveryCodes(c.Context(), token, req.ReauthToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidToken):
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "invalid access token", api.StatusErrUnauthorized)
+		case errors.Is(err, services.ErrReauthRequired):
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeReauthFailed, "re-authentication required", api.StatusErrReauthRequired)
+		}
+		log.Error().Any("ctx", c).Err(err).Msg("regenerate recovery codes failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "regenerate recovery codes failed", api.StatusErrServer)
+	}
+	return api.Success(c, model.RecoveryCodesResponse{RecoveryCodes: codes, Remaining: len(codes)}, "recovery codes regenerated")
+}
+
+// RecoverInit 对应 /api/auth/recover-init，校验恢复码并开始重新注册
+// 与登录共用限流，错误的恢复码计为一次登录失败
+func (h *PasswordHandler) RecoverInit(c fiber.Ctx) error {
+	attempt := newAttempt(c, services.ActionRecover)
+	defer h.audit.RecordAttempt(c.Context(), attempt)
+
+	var req model.RecoverInitRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid request body", api.StatusErrInvalidBody)
+	}
+	attempt.Username = req.Username
+	if req.Username == "" || req.RecoveryCode == "" || len(req.RegistrationRequest) == 0 {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "missing username, recovery_code or registration_request", api.StatusErrInvalidBody)
+	}
+
+	if err := h.guard.CheckLoginInit(c.Context(), req.Username, attempt.IP); err != nil {
+		return limitError(c, attempt, err)
+	}
+
+	resp, pubKey, sessionID, err := h.password.RecoverInit(c.Context(), req.Username, req.RecoveryCode, req.RegistrationRequest)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRecoveryCode) {
+			attempt.Reason = services.ReasonInvalidRecovery
+			h.guard.RecordFailure(c.Context(), req.Username)
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeRecoveryFailed, "invalid username or recovery code", api.StatusErrRecovery)
+		}
+		attempt.Reason = services.ReasonServerError
+		log.Error().Any("ctx", c).Err(err).Msg("recover init failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "recover init failed", api.StatusErrServer)
+	}
+
+	// 恢复码校验通过，最终结果记录在 recover-finalize
+	attempt.Success = true
+	return api.Success(c, model.RecoverInitResponse{
+		RegistrationResponse: resp,
+		ServerPublicKey:      pubKey,
+		RecoverySessionID:    sessionID,
+	}, "recover init OK")
+}
+
+// RecoverFinalize 对应 /api/auth/recover-finalize，使用恢复码替换密码并吊销所有会话
+func (h *PasswordHandler) RecoverFinalize(c fiber.Ctx) error {
+	attempt := newAttempt(c, services.ActionRecover)
+	defer h.audit.RecordAttempt(c.Context(), attempt)
+
+	var req model.RecoverFinalizeRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid request body", api.StatusErrInvalidBody)
+	}
+	if req.RecoverySessionID == "" || len(req.RegistrationRecord) == 0 {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "missing recovery_session_id or registration_record", api.StatusErrInvalidBody)
+	}
+
+	uid, username, err := h.password.RecoverFinalize(c.Context(), req.RecoverySessionID, req.RegistrationRecord)
+	attempt.UID, attempt.Username = uid, username
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidRecoveryCode):
+			attempt.Reason = services.ReasonInvalidRecovery
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeRecoveryFailed, "recovery session expired", api.StatusErrRecovery)
+		case errors.Is(err, services.ErrInvalidRecord):
+			return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid registration record", api.StatusErrInvalidBody)
+		}
+		attempt.Reason = services.ReasonServerError
+		log.Error().Any("ctx", c).Err(err).Msg("recover finalize failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "recover finalize failed", api.StatusErrServer)
+	}
+
+	attempt.Success = true
+	// 密码已重置，清除此前的登录失败与锁定
+	h.guard.RecordSuccess(c.Context(), username)
+	return api.Success(c, model.RecoverFinalizeResponse{OK: true}, "account recovered")
+}
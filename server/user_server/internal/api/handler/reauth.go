@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/user/internal/api"
+	"github.com/zrurf/quiver/server/user/internal/model"
+	"github.com/zrurf/quiver/server/user/internal/services"
+)
+
+type ReauthHandler struct {
+	reauth *services.ReauthService
+	audit  *services.AuditService
+	guard  *services.LoginGuard
+}
+
+func NewReauthHandler(reauth *services.ReauthService, audit *services.AuditService, guard *services.LoginGuard) *ReauthHandler {
+	return &ReauthHandler{
+		reauth: reauth,
+		audit:  audit,
+		guard:  guard,
+	}
+}
+
+// Init 对应 /api/auth/reauth-init，已登录的用户重新证明密码，与 login-init 相同的 OPAQUE 流程
+func (h *ReauthHandler) Init(c fiber.Ctx) error {
+	token := bearerToken(c)
+	if token == "" {
+		return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "missing access token", api.StatusErrUnauthorized)
+	}
+	var req model.ReauthInitRequest
+	if err := c.Bind().Body(&req); err != nil || len(req.KE1) == 0 {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "missing ke1", api.StatusErrInvalidBody)
+	}
+	ke2, sessionID, mfa, err := h.reauth.Init(c.Context(), token, req.KE1)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidToken) {
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "invalid access token", api.StatusErrUnauthorized)
+		}
+		log.Error().Any("ctx", c).Err(err).Msg("reauth init failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "reauth init failed", api.StatusErrServer)
+	}
+	return api.Success(c, model.ReauthInitResponse{KE2: ke2, ReauthSessionID: sessionID, MFARequired: mfa}, "reauth init OK")
+}
+
+// Finalize 对应 /api/auth/reauth-finalize，校验 KE3 与两步验证码，返回一次性重新验证凭据
+// 与登录共用失败计数，密码或验证码错误计为一次登录失败
+func (h *ReauthHandler) Finalize(c fiber.Ctx) error {
+	attempt := newAttempt(c, services.ActionReauth)
+	defer h.audit.RecordAttempt(c.Context(), attempt)
+
+	token := bearerToken(c)
+	if token == "" {
+		attempt.Reason = services.ReasonInvalidToken
+		return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "missing access token", api.StatusErrUnauthorized)
+	}
+	var req model.ReauthFinalizeRequest
+	if err := c.Bind().Body(&req); err != nil || req.ReauthSessionID == "" || len(req.KE3) == 0 {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "missing reauth_session_id or ke3", api.StatusErrInvalidBody)
+	}
+
+	state, err := h.reauth.TakeSession(c.Context(), token, req.ReauthSessionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidToken):
+			attempt.Reason = services.ReasonInvalidToken
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "invalid access token", api.StatusErrUnauthorized)
+		case errors.Is(err, services.ErrReauthSessionExpired):
+			attempt.Reason = services.ReasonSessionExpired
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeReauthFailed, "reauth session expired", api.StatusErrReauthSession)
+		}
+		attempt.Reason = services.ReasonServerError
+		log.Error().Any("ctx", c).Err(err).Msg("failed to get reauth session")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "reauth finalize failed", api.StatusErrServer)
+	}
+	attempt.UID, attempt.Username = state.UID, state.Username
+
+	if err := h.guard.CheckLoginFinalize(c.Context(), state.Username); err != nil {
+		return limitError(c, attempt, err)
+	}
+
+	ticket, err := h.reauth.Finalize(c.Context(), state, req.KE3, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidCredentials):
+			attempt.Reason = services.ReasonInvalidCredentials
+			h.guard.RecordFailure(c.Context(), state.Username)
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeReauthFailed, "invalid password", api.StatusErrLogin)
+		case errors.Is(err, services.ErrInvalidTOTP):
+			h.guard.RecordFailure(c.Context(), state.Username)
+		}
+		if resp := twoFactorError(c, attempt, err); resp != nil {
+			return resp
+		}
+		attempt.Reason = services.ReasonServerError
+		log.Error().Any("ctx", c).Err(err).Msg("reauth finalize failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "reauth finalize failed", api.StatusErrServer)
+	}
+
+	attempt.Success = true
+	return api.Success(c, model.ReauthFinalizeResponse{ReauthToken: ticket}, "reauth OK")
+}
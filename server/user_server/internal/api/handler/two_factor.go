@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/user/internal/api"
+	"github.com/zrurf/quiver/server/user/internal/model"
+	"github.com/zrurf/quiver/server/user/internal/services"
+)
+
+type TwoFactorHandler struct {
+	twoFactor *services.TwoFactorService
+	audit     *services.AuditService
+	guard     *services.LoginGuard
+}
+
+func NewTwoFactorHandler(twoFactor *services.TwoFactorService, audit *services.AuditService, guard *services.LoginGuard) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactor: twoFactor,
+		audit:     audit,
+		guard:     guard,
+	}
+}
+
+// Status 对应 GET /api/auth/2fa，返回是否已启用两步验证
+func (h *TwoFactorHandler) Status(c fiber.Ctx) error {
+	token := bearerToken(c)
+	if token == "" {
+		return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "missing access token", api.StatusErrUnauthorized)
+	}
+	enabled, err := h.twoFactor.Status(c.Context(), token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidToken) {
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "invalid access token", api.StatusErrUnauthorized)
+		}
+		log.Error().Any("ctx", c).Err(err).Msg("query two-factor status failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "query two-factor status failed", api.StatusErrServer)
+	}
+	return api.Success(c, model.TwoFactorStatusResponse{Enabled: enabled}, "OK")
+}
+
+// Enroll 对应 /api/auth/2fa/totp/enroll，生成 TOTP 密钥，确认前不生效
+func (h *TwoFactorHandler) Enroll(c fiber.Ctx) error {
+	token := bearerToken(c)
+	if token == "" {
+		return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "missing access token", api.StatusErrUnauthorized)
+	}
+	secret, uri, err := h.twoFactor.Enroll(c.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidToken):
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "invalid access token", api.StatusErrUnauthorized)
+		case errors.Is(err, services.ErrTwoFactorEnabled):
+			return api.Error(c, fiber.StatusConflict, api.CodeTwoFactorFailed, "two-factor authentication already enabled", api.StatusErrTwoFactorEnabled)
+		}
+		log.Error().Any("ctx", c).Err(err).Msg("two-factor enroll failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "two-factor enroll failed", api.StatusErrServer)
+	}
+	return api.Success(c, model.TwoFactorEnrollResponse{Secret: secret, OTPAuthURI: uri}, "two-factor enroll OK")
+}
+
+// Confirm 对应 /api/auth/2fa/totp/confirm，校验验证码后启用两步验证并返回备用码
+func (h *TwoFactorHandler) Confirm(c fiber.Ctx) error {
+	attempt := newAttempt(c, services.ActionTwoFactorEnable)
+	defer h.audit.RecordAttempt(c.Context(), attempt)
+
+	token := bearerToken(c)
+	if token == "" {
+		attempt.Reason = services.ReasonInvalidToken
+		return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "missing access token", api.StatusErrUnauthorized)
+	}
+	var req model.TwoFactorCodeRequest
+	if err := c.Bind().Body(&req); err != nil || req.Code == "" {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "missing code", api.StatusErrInvalidBody)
+	}
+	uid, codes, err := h.twoFactor.Confirm(c.Context(), token, req.Code)
+	attempt.UID = uid
+	if err != nil {
+		if resp := twoFactorError(c, attempt, err); resp != nil {
+			return resp
+		}
+		attempt.Reason = services.ReasonServerError
+		log.Error().Any("ctx", c).Err(err).Msg("two-factor confirm failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "two-factor confirm failed", api.StatusErrServer)
+	}
+	attempt.Success = true
+	return api.Success(c, model.TwoFactorConfirmResponse{BackupCodes: codes}, "two-factor authentication enabled")
+}
+
+// Disable 对应 /api/auth/2fa/totp/disable，需要验证码或备用码
+func (h *TwoFactorHandler) Disable(c fiber.Ctx) error {
+	attempt := newAttempt(c, services.ActionTwoFactorDisable)
+	defer h.audit.RecordAttempt(c.Context(), attempt)
+
+	token := bearerToken(c)
+	if token == "" {
+		attempt.Reason = services.ReasonInvalidToken
+		return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "missing access token", api.StatusErrUnauthorized)
+	}
+	var req model.TwoFactorCodeRequest
+	if err := c.Bind().Body(&req); err != nil || req.Code == "" {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "missing code", api.StatusErrInvalidBody)
+	}
+	uid, username, err := h.twoFactor.Disable(c.Context(), token, req.Code)
+	attempt.UID, attempt.Username = uid, username
+	if err != nil {
+		if errors.Is(err, services.ErrRateLimited) || errors.Is(err, services.ErrAccountLocked) {
+			return limitError(c, attempt, err)
+		}
+		if resp := twoFactorError(c, attempt, err); resp != nil {
+			return resp
+		}
+		attempt.Reason = services.ReasonServerError
+		log.Error().Any("ctx", c).Err(err).Msg("two-factor disable failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "two-factor disable failed", api.StatusErrServer)
+	}
+	attempt.Success = true
+	return api.Success(c, nil, "two-factor authentication disabled")
+}
+
+// Verify 对应 /api/auth/2fa/verify，登录的两步验证，通过后签发令牌
+func (h *TwoFactorHandler) Verify(c fiber.Ctx) error {
+	attempt := newAttempt(c, services.ActionMFAVerify)
+	defer h.audit.RecordAttempt(c.Context(), attempt)
+
+	var req model.TwoFactorVerifyRequest
+	if err := c.Bind().Body(&req); err != nil {
+		log.Error().Any("ctx", c).Err(err).Msg("bind request body failed")
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "invalid request body", api.StatusErrInvalidBody)
+	}
+	if req.MFASessionID == "" || req.Code == "" {
+		return api.Error(c, fiber.StatusBadRequest, api.CodeInvalidBody, "missing mfa_session_id or code", api.StatusErrInvalidBody)
+	}
+
+	state, err := h.twoFactor.TakeMFASession(c.Context(), req.MFASessionID)
+	if err != nil {
+		if errors.Is(err, services.ErrMFASessionExpired) {
+			attempt.Reason = services.ReasonSessionExpired
+			return api.Error(c, fiber.StatusUnauthorized, api.CodeTwoFactorFailed, "two-factor session expired", api.StatusErrMFASession)
+		}
+		attempt.Reason = services.ReasonServerError
+		log.Error().Any("ctx", c).Err(err).Msg("failed to get mfa session")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "two-factor verify failed", api.StatusErrServer)
+	}
+	attempt.UID, attempt.Username = state.UID, state.Username
+
+	if err := h.guard.CheckLoginFinalize(c.Context(), state.Username); err != nil {
+		return limitError(c, attempt, err)
+	}
+
+	result, err := h.twoFactor.VerifyLogin(c.Context(), req.MFASessionID, state, req.Code)
+	if err != nil {
+		if errors.Is(err, services.ErrAccountDisabled) {
+			return accountStatusError(c, attempt, err)
+		}
+		if errors.Is(err, services.ErrInvalidTOTP) {
+			h.guard.RecordFailure(c.Context(), state.Username)
+		}
+		if resp := twoFactorError(c, attempt, err); resp != nil {
+			return resp
+		}
+		attempt.Reason = services.ReasonServerError
+		log.Error().Any("ctx", c).Err(err).Msg("two-factor verify failed")
+		return api.Error(c, fiber.StatusInternalServerError, api.CodeServerError, "two-factor verify failed", api.StatusErrServer)
+	}
+
+	attempt.Success = true
+	h.guard.RecordSuccess(c.Context(), state.Username)
+	log.Info().Int64("uid", result.UID).Msg("two-factor verify OK")
+	return api.Success(c, loginResponse(result), "login finalize OK")
+}
+
+// twoFactorError 两步验证的业务错误，其他错误返回 nil 由调用方处理
+func twoFactorError(c fiber.Ctx, attempt *model.LoginAttempt, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidToken):
+		attempt.Reason = services.ReasonInvalidToken
+		return api.Error(c, fiber.StatusUnauthorized, api.CodeUnauthorized, "invalid access token", api.StatusErrUnauthorized)
+	case errors.Is(err, services.ErrInvalidTOTP):
+		attempt.Reason = services.ReasonInvalidTOTP
+		return api.Error(c, fiber.StatusUnauthorized, api.CodeTwoFactorFailed, "invalid verification code", api.StatusErrTwoFactorCode)
+	case errors.Is(err, services.ErrTwoFactorEnabled):
+		return api.Error(c, fiber.StatusConflict, api.CodeTwoFactorFailed, "two-factor authentication already enabled", api.StatusErrTwoFactorEnabled)
+	case errors.Is(err, services.ErrTwoFactorNotEnabled):
+		return api.Error(c, fiber.StatusConflict, api.CodeTwoFactorFailed, "two-factor authentication not enabled", api.StatusErrTwoFactorOff)
+	}
+	return nil
+}
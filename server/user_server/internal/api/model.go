@@ -30,6 +30,14 @@ const (
 	CodeRegisterInitFailed = 601
 	CodeLoginFailed        = 602
 	CodeRefreshFailed      = 603
+	CodeUnauthorized       = 604
+	CodeRateLimited        = 605
+	CodeAccountLocked      = 606
+	CodeAccountDisabled    = 607
+	CodeUserNotFound       = 608
+	CodeRecoveryFailed     = 609
+	CodeTwoFactorFailed    = 610
+	CodeReauthFailed       = 611
 )
 
 const (
@@ -38,5 +46,24 @@ const (
 	StatusErrServer           = "ERR_SERVER_ERROR"
 	StatusErrLogin            = "ERR_LOGIN_FAILED"
 	StatusErrUsernameConflict = "ERR_USERNAME_CONFLICT"
+	StatusErrInvalidUsername  = "ERR_INVALID_USERNAME"
+	StatusErrUsernameReserved = "ERR_USERNAME_RESERVED"
+	StatusErrRegistration     = "ERR_REGISTRATION_EXPIRED"
 	StatusErrRefresh          = "ERR_REFRESH_FAILED"
+	StatusErrUnauthorized     = "ERR_UNAUTHORIZED"
+	StatusErrRateLimited      = "ERR_RATE_LIMITED"
+	StatusErrAccountLocked    = "ERR_ACCOUNT_LOCKED"
+	StatusErrAccountSuspended = "ERR_ACCOUNT_SUSPENDED"
+	StatusErrAccountBanned    = "ERR_ACCOUNT_BANNED"
+	StatusErrAccountDisabled  = "ERR_ACCOUNT_DISABLED"
+	StatusErrUserNotFound     = "ERR_USER_NOT_FOUND"
+	StatusErrRecovery         = "ERR_RECOVERY_FAILED"
+	StatusErrTwoFactorCode    = "ERR_2FA_INVALID_CODE"
+	StatusErrTwoFactorEnabled = "ERR_2FA_ALREADY_ENABLED"
+	StatusErrTwoFactorOff     = "ERR_2FA_NOT_ENABLED"
+	StatusErrMFASession       = "ERR_2FA_SESSION_EXPIRED"
+	StatusErrRekeyNotRequired = "ERR_REKEY_NOT_REQUIRED"
+	StatusErrReauthRequired   = "ERR_REAUTH_REQUIRED"
+	StatusErrReauthSession    = "ERR_REAUTH_SESSION_EXPIRED"
+	StatusErrPasswordChange   = "ERR_PASSWORD_CHANGE_EXPIRED"
 )
@@ -24,3 +24,14 @@ func Error(c fiber.Ctx, httpCode int, code int, msg string, status string) error
 		Timestamp: time.Now().UnixMilli(),
 	})
 }
+
+// ErrorWithPayload 返回错误并附带说明数据
+func ErrorWithPayload(c fiber.Ctx, httpCode int, code int, msg string, status string, payload any) error {
+	return c.Status(httpCode).JSON(ResponseModel{
+		Code:      code,
+		Message:   msg,
+		Status:    status,
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   payload,
+	})
+}
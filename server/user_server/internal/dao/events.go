@@ -0,0 +1,52 @@
+package dao
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventVersion 当前事件格式版本（与网关、游戏服务器一致）
+const EventVersion = 1
+
+// 事件类型（同时作为主题后缀，完整主题为 "<mq.subject>.<类型>"）
+const (
+	EventSessionKick = "session.kick"
+)
+
+// Event 事件信封，结构见 schema/mq/events.schema.json
+type Event struct {
+	Version int             `json:"v"`
+	Type    string          `json:"type"`
+	Source  string          `json:"source"` // 发布方实例ID
+	Time    int64           `json:"ts"`     // 毫秒时间戳
+	Data    json.RawMessage `json:"data"`
+}
+
+// SessionKickEvent 要求网关断开账号的会话
+// Family 非空时只断开该令牌族（签名令牌中的 sid）的会话，刷新轮换前认证的会话同样断开
+// TokenHash 为令牌族当前访问令牌的 SHA-256 十六进制，网关未能取得会话的令牌族时据此匹配
+// RevokedTokens 为本次吊销的签名访问令牌哈希，网关立即加入本地吊销列表，不必等待下次同步
+// Reason 为网关协议中 NoticeReason 的枚举名称
+type SessionKickEvent struct {
+	UID           int64    `json:"uid"`
+	Family        string   `json:"family,omitempty"`
+	TokenHash     string   `json:"token_hash,omitempty"`
+	RevokedTokens []string `json:"revoked_tokens,omitempty"`
+	Reason        string   `json:"reason"`
+	Message       string   `json:"message,omitempty"`
+}
+
+// encodeEvent 构造事件信封
+func encodeEvent(eventType, source string, data any) ([]byte, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Event{
+		Version: EventVersion,
+		Type:    eventType,
+		Source:  source,
+		Time:    time.Now().UnixMilli(),
+		Data:    body,
+	})
+}
@@ -0,0 +1,103 @@
+package dao
+
+import (
+	"context"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	RateLimitPrefix    = "ratelimit:"     // 滑动窗口：有序集合，成员为请求，分数为请求时间（毫秒）
+	LoginFailPrefix    = "login_fail:"    // 用户名 -> 连续登录失败次数
+	LoginBackoffPrefix = "login_backoff:" // 用户名 -> 退避标记，TTL 为剩余退避时间
+	LoginLockPrefix    = "login_lock:"    // 用户名 -> 锁定标记，TTL 为剩余锁定时间
+)
+
+type LimiterRepository struct {
+	imdb *redis.Client
+}
+
+func NewLimiterRepository(imdb *redis.Client) *LimiterRepository {
+	return &LimiterRepository{
+		imdb: imdb,
+	}
+}
+
+// Hit 在滑动窗口内记录一次请求，返回窗口内的请求数（含本次）与窗口内最早请求的时间
+func (r *LimiterRepository) Hit(ctx context.Context, key string, window time.Duration) (int64, time.Time, error) {
+	key = RateLimitPrefix + key
+	now := time.Now()
+	member := strconv.FormatInt(now.UnixNano(), 36) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+
+	var count *redis.IntCmd
+	var oldest *redis.ZSliceCmd
+	_, err := r.imdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(now.Add(-window).UnixMilli(), 10))
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.UnixMilli()), Member: member})
+		count = pipe.ZCard(ctx, key)
+		oldest = pipe.ZRangeWithScores(ctx, key, 0, 0)
+		pipe.PExpire(ctx, key, window)
+		return nil
+	})
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	first := now
+	if z := oldest.Val(); len(z) > 0 {
+		first = time.UnixMilli(int64(z[0].Score))
+	}
+	return count.Val(), first, nil
+}
+
+// AddLoginFailure 累计用户名的登录失败次数，window 内没有新的失败时计数清零
+func (r *LimiterRepository) AddLoginFailure(ctx context.Context, username string, window time.Duration) (int64, error) {
+	key := LoginFailPrefix + username
+	var incr *redis.IntCmd
+	_, err := r.imdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.PExpire(ctx, key, window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// SetLoginBackoff 设置退避时间，期间拒绝该用户名的登录
+func (r *LimiterRepository) SetLoginBackoff(ctx context.Context, username string, d time.Duration) error {
+	return r.imdb.Set(ctx, LoginBackoffPrefix+username, 1, d).Err()
+}
+
+// LockLogin 锁定用户名并清零失败次数
+func (r *LimiterRepository) LockLogin(ctx context.Context, username string, d time.Duration) error {
+	_, err := r.imdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, LoginLockPrefix+username, 1, d)
+		pipe.Del(ctx, LoginFailPrefix+username, LoginBackoffPrefix+username)
+		return nil
+	})
+	return err
+}
+
+// ClearLoginFailures 登录成功或找回账号后清除失败次数、退避与锁定
+func (r *LimiterRepository) ClearLoginFailures(ctx context.Context, username string) error {
+	return r.imdb.Del(ctx, LoginFailPrefix+username, LoginBackoffPrefix+username, LoginLockPrefix+username).Err()
+}
+
+// LoginBlocked 返回用户名剩余的锁定时间与退避时间，未被限制时为 0
+func (r *LimiterRepository) LoginBlocked(ctx context.Context, username string) (lock, backoff time.Duration, err error) {
+	var lockCmd, backoffCmd *redis.DurationCmd
+	_, err = r.imdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		lockCmd = pipe.PTTL(ctx, LoginLockPrefix+username)
+		backoffCmd = pipe.PTTL(ctx, LoginBackoffPrefix+username)
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	// 键不存在时 PTTL 为负数
+	return max(lockCmd.Val(), 0), max(backoffCmd.Val(), 0), nil
+}
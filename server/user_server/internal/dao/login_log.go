@@ -0,0 +1,83 @@
+package dao
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zrurf/quiver/server/user/internal/model"
+)
+
+type LoginLogRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewLoginLogRepository(pool *pgxpool.Pool) *LoginLogRepository {
+	return &LoginLogRepository{
+		db: pool,
+	}
+}
+
+// Insert 写入一条审计记录，uid 为 0 与 IP 无法解析时存为 NULL
+func (r *LoginLogRepository) Insert(ctx context.Context, a *model.LoginAttempt) error {
+	sql := `INSERT INTO auth_login_log (uid, username, action, success, reason, ip, user_agent)
+		VALUES (NULLIF($1::bigint, 0), $2, $3, $4, NULLIF($5, ''), NULLIF($6, '')::inet, NULLIF($7, ''))`
+	_, err := r.db.Exec(ctx, sql, a.UID, a.Username, a.Action, a.Success, a.Reason, a.IP, a.UserAgent)
+	return err
+}
+
+// Query 按条件查询审计记录，按时间倒序
+func (r *LoginLogRepository) Query(ctx context.Context, f model.LoginLogFilter) ([]model.LoginAttempt, error) {
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	switch {
+	case f.UID != 0 && f.Username != "":
+		where = append(where, "(uid = "+arg(f.UID)+" OR (uid IS NULL AND username = "+arg(f.Username)+"))")
+	case f.UID != 0:
+		where = append(where, "uid = "+arg(f.UID))
+	case f.Username != "":
+		where = append(where, "username = "+arg(f.Username))
+	}
+	if f.IP != "" {
+		where = append(where, "ip = "+arg(f.IP)+"::inet")
+	}
+	if len(f.Actions) > 0 {
+		where = append(where, "action = ANY("+arg(f.Actions)+")")
+	}
+	if !f.From.IsZero() {
+		where = append(where, "created_at >= "+arg(f.From))
+	}
+	if !f.To.IsZero() {
+		where = append(where, "created_at < "+arg(f.To))
+	}
+
+	sql := `SELECT id, COALESCE(uid, 0), username, action, success, COALESCE(reason, ''),
+		COALESCE(host(ip), ''), COALESCE(user_agent, ''), created_at FROM auth_login_log`
+	if len(where) > 0 {
+		sql += " WHERE " + strings.Join(where, " AND ")
+	}
+	sql += " ORDER BY created_at DESC, id DESC LIMIT " + arg(f.Limit)
+
+	rows, err := r.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]model.LoginAttempt, 0)
+	for rows.Next() {
+		var a model.LoginAttempt
+		if err := rows.Scan(&a.ID, &a.UID, &a.Username, &a.Action, &a.Success, &a.Reason,
+			&a.IP, &a.UserAgent, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, a)
+	}
+	return items, rows.Err()
+}
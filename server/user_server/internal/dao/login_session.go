@@ -0,0 +1,258 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	LoginSessionPrefix    = "login_session:"        // 登录会话ID -> LoginState，仅在 login-init 与 login-finalize 之间存在
+	RecoverySessionPrefix = "recovery_session:"     // 恢复会话ID -> RecoveryState，仅在 recover-init 与 recover-finalize 之间存在
+	MFASessionPrefix      = "mfa_session:"          // 两步验证会话ID -> MFAState，仅在 login-finalize 与 2fa/verify 之间存在
+	RegistrationPrefix    = "registration_session:" // 注册会话ID -> RegistrationState，仅在 register-init 与 register-finalize 之间存在
+	ReauthSessionPrefix   = "reauth_session:"       // 重新验证会话ID -> ReauthState，仅在 reauth-init 与 reauth-finalize 之间存在
+	ReauthTicketPrefix    = "reauth_ticket:"        // 重新验证凭据 -> ReauthTicket，reauth-finalize 签发，敏感操作消耗
+	RekeyTicketPrefix     = "rekey_ticket:"         // 密钥迁移凭据 -> ReauthTicket，需要迁移的登录签发，change-init 消耗
+	PasswordChangePrefix  = "password_change:"      // 修改密码会话ID -> PasswordChangeState，仅在 change-init 与 change-finalize 之间存在
+)
+
+var ErrLoginSessionNotFound = errors.New("login session not found")
+
+// RecoveryState recover-init 校验通过的恢复码，recover-finalize 时使用
+type RecoveryState struct {
+	Username   string `json:"username"`
+	UID        int64  `json:"uid"`
+	CodeID     int64  `json:"code_id"`
+	KeyVersion int    `json:"key_version"` // recover-init 时使用的 OPAQUE 密钥集版本
+	ExpireAt   int64  `json:"expire_at"`   // 毫秒时间戳
+}
+
+// LoginState login-init 生成、login-finalize 校验所需的服务端状态，不发送给客户端
+type LoginState struct {
+	Username      string `json:"username"`
+	UID           int64  `json:"uid"` // 用户不存在（假记录）时为 0
+	ClientMAC     []byte `json:"client_mac"`
+	SessionSecret []byte `json:"session_secret"`
+	KeyVersion    int    `json:"key_version"` // 注册记录绑定的 OPAQUE 密钥集版本
+	ExpireAt      int64  `json:"expire_at"`   // 毫秒时间戳
+}
+
+// RegistrationState register-init 时确定的用户名与 OPAQUE 凭据标识，register-finalize 只接受同一注册会话
+type RegistrationState struct {
+	Username             string `json:"username"`
+	NameKey              string `json:"name_key"` // 用户名折叠形式，即预留的键
+	CredentialIdentifier []byte `json:"credential_identifier"`
+	KeyVersion           int    `json:"key_version"` // register-init 时使用的 OPAQUE 密钥集版本
+	ExpireAt             int64  `json:"expire_at"`   // 毫秒时间戳
+}
+
+// MFAState 密码校验通过、等待两步验证的登录
+type MFAState struct {
+	Username string `json:"username"`
+	UID      int64  `json:"uid"`
+	Attempts int    `json:"attempts"`  // 已失败的验证次数
+	Rekey    bool   `json:"rekey"`     // 注册记录使用的不是当前密钥集，登录后需要重新注册
+	ExpireAt int64  `json:"expire_at"` // 毫秒时间戳
+}
+
+// ReauthState 已登录的用户重新证明密码：reauth-init 生成，只能由同一令牌族完成
+type ReauthState struct {
+	LoginState
+	Family string `json:"family"`
+}
+
+// ReauthTicket 重新验证密码（启用两步验证时还有验证码）后签发的一次性凭据
+type ReauthTicket struct {
+	UID      int64  `json:"uid"`
+	Family   string `json:"family"`    // 只能由签发时的令牌族使用
+	ExpireAt int64  `json:"expire_at"` // 毫秒时间戳
+}
+
+// PasswordChangeState change-init 生成，change-finalize 只接受同一令牌族、同一会话
+type PasswordChangeState struct {
+	UID        int64  `json:"uid"`
+	Family     string `json:"family"`
+	KeyVersion int    `json:"key_version"` // change-init 时使用的 OPAQUE 密钥集版本
+	Rekey      bool   `json:"rekey"`       // 由密钥迁移凭据发起：同一密码迁移到当前密钥集，不吊销其他会话
+	ExpireAt   int64  `json:"expire_at"`   // 毫秒时间戳
+}
+
+type LoginSessionRepository struct {
+	imdb *redis.Client
+}
+
+func NewLoginSessionRepository(imdb *redis.Client) *LoginSessionRepository {
+	return &LoginSessionRepository{
+		imdb: imdb,
+	}
+}
+
+func (r *LoginSessionRepository) save(ctx context.Context, key string, state any, ttl time.Duration) (bool, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return false, err
+	}
+	return r.imdb.SetNX(ctx, key, data, ttl).Result()
+}
+
+func (r *LoginSessionRepository) take(ctx context.Context, key string, state any) error {
+	data, err := r.imdb.GetDel(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return ErrLoginSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, state)
+}
+
+// Save 保存登录会话状态，ID 已存在时返回 false
+func (r *LoginSessionRepository) Save(ctx context.Context, id string, state *LoginState, ttl time.Duration) (bool, error) {
+	return r.save(ctx, LoginSessionPrefix+id, state, ttl)
+}
+
+// Take 取出并删除登录会话状态，每个登录会话只能完成一次
+func (r *LoginSessionRepository) Take(ctx context.Context, id string) (*LoginState, error) {
+	var state LoginState
+	if err := r.take(ctx, LoginSessionPrefix+id, &state); err != nil {
+		return nil, err
+	}
+	if time.Now().UnixMilli() > state.ExpireAt {
+		return nil, ErrLoginSessionNotFound
+	}
+	return &state, nil
+}
+
+// SaveReauth 保存重新验证会话状态，ID 已存在时返回 false
+func (r *LoginSessionRepository) SaveReauth(ctx context.Context, id string, state *ReauthState, ttl time.Duration) (bool, error) {
+	return r.save(ctx, ReauthSessionPrefix+id, state, ttl)
+}
+
+// TakeReauth 取出并删除重新验证会话状态
+func (r *LoginSessionRepository) TakeReauth(ctx context.Context, id string) (*ReauthState, error) {
+	var state ReauthState
+	if err := r.take(ctx, ReauthSessionPrefix+id, &state); err != nil {
+		return nil, err
+	}
+	if time.Now().UnixMilli() > state.ExpireAt {
+		return nil, ErrLoginSessionNotFound
+	}
+	return &state, nil
+}
+
+// SaveReauthTicket 保存重新验证凭据，凭据已存在时返回 false
+func (r *LoginSessionRepository) SaveReauthTicket(ctx context.Context, ticket string, state *ReauthTicket, ttl time.Duration) (bool, error) {
+	return r.save(ctx, ReauthTicketPrefix+ticket, state, ttl)
+}
+
+// TakeReauthTicket 取出并删除重新验证凭据，每个凭据只能使用一次
+func (r *LoginSessionRepository) TakeReauthTicket(ctx context.Context, ticket string) (*ReauthTicket, error) {
+	var state ReauthTicket
+	if err := r.take(ctx, ReauthTicketPrefix+ticket, &state); err != nil {
+		return nil, err
+	}
+	if time.Now().UnixMilli() > state.ExpireAt {
+		return nil, ErrLoginSessionNotFound
+	}
+	return &state, nil
+}
+
+// SaveRekeyTicket 保存密钥迁移凭据，凭据已存在时返回 false
+func (r *LoginSessionRepository) SaveRekeyTicket(ctx context.Context, ticket string, state *ReauthTicket, ttl time.Duration) (bool, error) {
+	return r.save(ctx, RekeyTicketPrefix+ticket, state, ttl)
+}
+
+// TakeRekeyTicket 取出并删除密钥迁移凭据，每个凭据只能使用一次
+func (r *LoginSessionRepository) TakeRekeyTicket(ctx context.Context, ticket string) (*ReauthTicket, error) {
+	var state ReauthTicket
+	if err := r.take(ctx, RekeyTicketPrefix+ticket, &state); err != nil {
+		return nil, err
+	}
+	if time.Now().UnixMilli() > state.ExpireAt {
+		return nil, ErrLoginSessionNotFound
+	}
+	return &state, nil
+}
+
+// SavePasswordChange 保存修改密码会话状态，ID 已存在时返回 false
+func (r *LoginSessionRepository) SavePasswordChange(ctx context.Context, id string, state *PasswordChangeState, ttl time.Duration) (bool, error) {
+	return r.save(ctx, PasswordChangePrefix+id, state, ttl)
+}
+
+// TakePasswordChange 取出并删除修改密码会话状态，每个会话只能使用一次
+func (r *LoginSessionRepository) TakePasswordChange(ctx context.Context, id string) (*PasswordChangeState, error) {
+	var state PasswordChangeState
+	if err := r.take(ctx, PasswordChangePrefix+id, &state); err != nil {
+		return nil, err
+	}
+	if time.Now().UnixMilli() > state.ExpireAt {
+		return nil, ErrLoginSessionNotFound
+	}
+	return &state, nil
+}
+
+// SaveRecovery 保存恢复会话状态，ID 已存在时返回 false
+func (r *LoginSessionRepository) SaveRecovery(ctx context.Context, id string, state *RecoveryState, ttl time.Duration) (bool, error) {
+	return r.save(ctx, RecoverySessionPrefix+id, state, ttl)
+}
+
+// TakeRecovery 取出并删除恢复会话状态
+func (r *LoginSessionRepository) TakeRecovery(ctx context.Context, id string) (*RecoveryState, error) {
+	var state RecoveryState
+	if err := r.take(ctx, RecoverySessionPrefix+id, &state); err != nil {
+		return nil, err
+	}
+	if time.Now().UnixMilli() > state.ExpireAt {
+		return nil, ErrLoginSessionNotFound
+	}
+	return &state, nil
+}
+
+// SaveMFA 保存两步验证会话状态，ID 已存在时返回 false，replace 为 true 时覆盖（更新失败次数）
+func (r *LoginSessionRepository) SaveMFA(ctx context.Context, id string, state *MFAState, replace bool) (bool, error) {
+	ttl := time.Until(time.UnixMilli(state.ExpireAt))
+	if ttl <= 0 {
+		return false, nil
+	}
+	if replace {
+		data, err := json.Marshal(state)
+		if err != nil {
+			return false, err
+		}
+		return true, r.imdb.Set(ctx, MFASessionPrefix+id, data, ttl).Err()
+	}
+	return r.save(ctx, MFASessionPrefix+id, state, ttl)
+}
+
+// TakeMFA 取出并删除两步验证会话状态
+func (r *LoginSessionRepository) TakeMFA(ctx context.Context, id string) (*MFAState, error) {
+	var state MFAState
+	if err := r.take(ctx, MFASessionPrefix+id, &state); err != nil {
+		return nil, err
+	}
+	if time.Now().UnixMilli() > state.ExpireAt {
+		return nil, ErrLoginSessionNotFound
+	}
+	return &state, nil
+}
+
+// SaveRegistration 保存注册会话状态，ID 已存在时返回 false
+func (r *LoginSessionRepository) SaveRegistration(ctx context.Context, id string, state *RegistrationState, ttl time.Duration) (bool, error) {
+	return r.save(ctx, RegistrationPrefix+id, state, ttl)
+}
+
+// TakeRegistration 取出并删除注册会话状态，每个注册会话只能使用一次
+func (r *LoginSessionRepository) TakeRegistration(ctx context.Context, id string) (*RegistrationState, error) {
+	var state RegistrationState
+	if err := r.take(ctx, RegistrationPrefix+id, &state); err != nil {
+		return nil, err
+	}
+	if time.Now().UnixMilli() > state.ExpireAt {
+		return nil, ErrLoginSessionNotFound
+	}
+	return &state, nil
+}
@@ -0,0 +1,62 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/user/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type NatsClient struct {
+	conn   *nats.Conn
+	prefix string // 主题前缀（mq.subject）
+	source string // 本实例ID
+}
+
+// NewNATSClient 连接 NATS
+func NewNATSClient(addr, prefix, source string) (*NatsClient, error) {
+	nc, err := nats.Connect(addr)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("addr", addr).Str("prefix", prefix).Msg("connected to NATS")
+	return &NatsClient{conn: nc, prefix: prefix, source: source}, nil
+}
+
+// Subject 返回带前缀的完整主题
+func (c *NatsClient) Subject(eventType string) string {
+	return c.prefix + "." + eventType
+}
+
+// publish 发布非持久事件
+func (c *NatsClient) publish(ctx context.Context, eventType string, data any) (err error) {
+	subject := c.Subject(eventType)
+	ctx, span := tracing.Start(ctx, "publish "+subject, trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
+		attribute.String("messaging.system", "nats"),
+		attribute.String("messaging.destination.name", subject),
+	))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	payload, err := encodeEvent(eventType, c.source, data)
+	if err != nil {
+		return err
+	}
+	msg := &nats.Msg{Subject: subject, Data: payload}
+	tracing.Inject(ctx, msg)
+	return c.conn.PublishMsg(msg)
+}
+
+// PublishSessionKick 通知网关断开账号的会话
+func (c *NatsClient) PublishSessionKick(ctx context.Context, ev SessionKickEvent) error {
+	return c.publish(ctx, EventSessionKick, ev)
+}
+
+func (c *NatsClient) Close() {
+	c.conn.Close()
+}
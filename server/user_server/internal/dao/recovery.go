@@ -0,0 +1,74 @@
+package dao
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrRecoveryCodeInvalid = errors.New("recovery code invalid or used")
+
+type RecoveryCodeRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewRecoveryCodeRepository(pool *pgxpool.Pool) *RecoveryCodeRepository {
+	return &RecoveryCodeRepository{
+		db: pool,
+	}
+}
+
+func insertRecoveryCodes(ctx context.Context, tx pgx.Tx, uid int64, codeHashes [][]byte) error {
+	if len(codeHashes) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx, `INSERT INTO user_recovery_codes (uid, code_hash) SELECT $1, unnest($2::bytea[])`, uid, codeHashes)
+	return err
+}
+
+// Replace 作废用户的所有恢复码并写入新的恢复码
+func (r *RecoveryCodeRepository) Replace(ctx context.Context, uid int64, codeHashes [][]byte) error {
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE uid = $1`, uid); err != nil {
+			return err
+		}
+		return insertRecoveryCodes(ctx, tx, uid, codeHashes)
+	})
+}
+
+// Find 查找用户名对应用户的未使用恢复码，返回 uid 与恢复码ID
+// 用户不存在与恢复码错误都返回 ErrRecoveryCodeInvalid
+func (r *RecoveryCodeRepository) Find(ctx context.Context, username string, codeHash []byte) (int64, int64, error) {
+	var uid, id int64
+	sql := `SELECT c.uid, c.id FROM user_recovery_codes c JOIN users u ON u.id = c.uid
+		WHERE u.name = $1 AND c.code_hash = $2 AND c.used_at IS NULL LIMIT 1`
+	err := r.db.QueryRow(ctx, sql, username, codeHash).Scan(&uid, &id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, ErrRecoveryCodeInvalid
+	}
+	return uid, id, err
+}
+
+// Redeem 在同一事务中使用恢复码并替换 Opaque Record，恢复码已被使用时返回 ErrRecoveryCodeInvalid
+func (r *RecoveryCodeRepository) Redeem(ctx context.Context, uid, codeID int64, record []byte, keyVersion int) error {
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `UPDATE user_recovery_codes SET used_at = NOW() WHERE id = $1 AND uid = $2 AND used_at IS NULL`, codeID, uid)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrRecoveryCodeInvalid
+		}
+		_, err = tx.Exec(ctx, `UPDATE users SET opaque_record = $2, opaque_key_version = $3, updated_at = NOW() WHERE id = $1`, uid, record, keyVersion)
+		return err
+	})
+}
+
+// Remaining 返回用户未使用的恢复码数量
+func (r *RecoveryCodeRepository) Remaining(ctx context.Context, uid int64) (int, error) {
+	var n int
+	err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM user_recovery_codes WHERE uid = $1 AND used_at IS NULL`, uid).Scan(&n)
+	return n, err
+}
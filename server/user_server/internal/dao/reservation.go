@@ -0,0 +1,55 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// UsernameReservationPrefix 用户名折叠形式 -> 预留ID，仅在 register-init 与 register-finalize 之间存在
+const UsernameReservationPrefix = "username_reservation:"
+
+type ReservationRepository struct {
+	imdb *redis.Client
+}
+
+func NewReservationRepository(imdb *redis.Client) *ReservationRepository {
+	return &ReservationRepository{
+		imdb: imdb,
+	}
+}
+
+// Reserve 预留用户名，已被其他人预留时返回 false
+func (r *ReservationRepository) Reserve(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	return r.imdb.SetNX(ctx, UsernameReservationPrefix+key, holder, ttl).Result()
+}
+
+// Holder 返回用户名的预留ID，没有预留时返回空字符串
+func (r *ReservationRepository) Holder(ctx context.Context, key string) (string, error) {
+	holder, err := r.imdb.Get(ctx, UsernameReservationPrefix+key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return holder, err
+}
+
+// Release 释放预留，只删除 holder 自己的预留
+func (r *ReservationRepository) Release(ctx context.Context, key, holder string) error {
+	k := UsernameReservationPrefix + key
+	return r.imdb.Watch(ctx, func(tx *redis.Tx) error {
+		cur, err := tx.Get(ctx, k).Result()
+		if errors.Is(err, redis.Nil) || (err == nil && cur != holder) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, k)
+			return nil
+		})
+		return err
+	}, k)
+}
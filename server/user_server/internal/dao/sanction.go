@@ -0,0 +1,114 @@
+package dao
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zrurf/quiver/server/user/internal/model"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+type SanctionRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewSanctionRepository(pool *pgxpool.Pool) *SanctionRepository {
+	return &SanctionRepository{
+		db: pool,
+	}
+}
+
+const sanctionColumns = `id, uid, kind, reason, expires_at, created_by, created_at, COALESCE(lifted_by, ''), lifted_at`
+
+func scanSanction(row pgx.Row, s *model.Sanction) error {
+	return row.Scan(&s.ID, &s.UID, &s.Kind, &s.Reason, &s.ExpiresAt, &s.CreatedBy, &s.CreatedAt, &s.LiftedBy, &s.LiftedAt)
+}
+
+// Apply 写入处罚并更新账号状态，durationSec 为 0 时永久生效
+func (r *SanctionRepository) Apply(ctx context.Context, uid int64, kind, reason string, durationSec int64, operator string) (*model.Sanction, error) {
+	var s model.Sanction
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `UPDATE users SET status = $2, updated_at = NOW() WHERE id = $1`, uid, kind)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrUserNotFound
+		}
+		sql := `INSERT INTO user_sanctions (uid, kind, reason, expires_at, created_by)
+			VALUES ($1, $2, $3, CASE WHEN $4::bigint > 0 THEN NOW() + make_interval(secs => $4::bigint) END, $5)
+			RETURNING ` + sanctionColumns
+		return scanSanction(tx.QueryRow(ctx, sql, uid, kind, reason, durationSec, operator), &s)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Lift 解除用户所有未解除的处罚并恢复账号状态，返回解除的处罚数量
+func (r *SanctionRepository) Lift(ctx context.Context, uid int64, operator string) (int64, error) {
+	var lifted int64
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `UPDATE user_sanctions SET lifted_at = NOW(), lifted_by = $2 WHERE uid = $1 AND lifted_at IS NULL`, uid, operator)
+		if err != nil {
+			return err
+		}
+		lifted = tag.RowsAffected()
+		_, err = tx.Exec(ctx, `UPDATE users SET status = 'ACTIVE', updated_at = NOW() WHERE id = $1 AND status IN ('SUSPENDED', 'BANNED')`, uid)
+		return err
+	})
+	return lifted, err
+}
+
+// List 返回用户的处罚记录，按时间倒序
+func (r *SanctionRepository) List(ctx context.Context, uid int64) ([]model.Sanction, error) {
+	rows, err := r.db.Query(ctx, `SELECT `+sanctionColumns+` FROM user_sanctions WHERE uid = $1 ORDER BY created_at DESC, id DESC`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]model.Sanction, 0)
+	for rows.Next() {
+		var s model.Sanction
+		if err := scanSanction(rows, &s); err != nil {
+			return nil, err
+		}
+		items = append(items, s)
+	}
+	return items, rows.Err()
+}
+
+// AccountStatus 返回账号状态与当前生效的处罚（封禁优先，其次到期最晚的暂停）
+// 处罚均已到期时将 SUSPENDED/BANNED 恢复为 ACTIVE
+func (r *SanctionRepository) AccountStatus(ctx context.Context, uid int64) (string, *model.Sanction, error) {
+	var status string
+	err := r.db.QueryRow(ctx, `SELECT status FROM users WHERE id = $1`, uid).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, ErrUserNotFound
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if status != model.StatusSuspended && status != model.StatusBanned {
+		return status, nil, nil
+	}
+
+	var s model.Sanction
+	sql := `SELECT ` + sanctionColumns + ` FROM user_sanctions
+		WHERE uid = $1 AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY kind = 'BANNED' DESC, expires_at DESC NULLS FIRST LIMIT 1`
+	err = scanSanction(r.db.QueryRow(ctx, sql, uid), &s)
+	if errors.Is(err, pgx.ErrNoRows) {
+		_, err = r.db.Exec(ctx, `UPDATE users SET status = 'ACTIVE', updated_at = NOW() WHERE id = $1 AND status IN ('SUSPENDED', 'BANNED')`, uid)
+		return model.StatusActive, nil, err
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return s.Kind, &s, nil
+}
@@ -2,56 +2,198 @@ package dao
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// 会话令牌按“令牌族”组织：一次登录产生一个令牌族，每次刷新在族内轮换访问令牌与刷新令牌
 const (
-	AccessPrefix  = "session:"
-	RefreshPrefix = "refresh:"
+	AccessPrefix       = "session:"        // 访问令牌 -> uid（网关据此认证）
+	AccessFamilyPrefix = "session_family:" // 访问令牌 -> 令牌族ID
+	RefreshPrefix      = "refresh:"        // 刷新令牌 -> RefreshRecord，轮换后保留至过期，用于检测重用
+	FamilyPrefix       = "token_family:"   // 令牌族ID -> TokenFamily
+	UserFamiliesPrefix = "user_families:"  // uid -> 令牌族ID集合
+)
+
+// RevocationKey 已吊销但未过期的签名访问令牌（有序集合，成员为令牌哈希，分数为过期时间毫秒），网关定期同步
+const RevocationKey = "token_revocations"
+
+var (
+	ErrTokenNotFound = errors.New("token not found")
+	ErrTokenReused   = errors.New("refresh token reused")
 )
 
 type SessionRepository struct {
 	imdb *redis.Client
 }
 
+// RefreshRecord 刷新令牌所属的用户与令牌族
+type RefreshRecord struct {
+	UID    int64  `json:"uid"`
+	Family string `json:"family"`
+}
+
+// TokenFamily 令牌族当前有效的令牌
+type TokenFamily struct {
+	UID     int64  `json:"uid"`
+	Access  string `json:"access"`
+	Refresh string `json:"refresh"`
+}
+
+// TokenTTL 令牌有效期
+type TokenTTL struct {
+	Access  time.Duration
+	Refresh time.Duration
+}
+
 func NewSessionRepository(imdb *redis.Client) *SessionRepository {
 	return &SessionRepository{
 		imdb: imdb,
 	}
 }
 
-// SaveAccessToken 保存访问令牌
-func (r *SessionRepository) SaveAccessToken(ctx context.Context, token string, uid int64, expireSec int) error {
-	key := AccessPrefix + token
-	return r.imdb.Set(ctx, key, uid, time.Second*time.Duration(expireSec)).Err()
+func userFamiliesKey(uid int64) string {
+	return UserFamiliesPrefix + strconv.FormatInt(uid, 10)
 }
 
-// SaveRefreshToken 保存刷新令牌
-func (r *SessionRepository) SaveRefreshToken(ctx context.Context, token string, uid int64, expireSec int) error {
-	key := RefreshPrefix + token
-	return r.imdb.Set(ctx, key, uid, time.Second*time.Duration(expireSec)).Err()
+// setTokens 在事务中写入令牌族的当前令牌
+func setTokens(ctx context.Context, pipe redis.Pipeliner, family string, fam TokenFamily, ttl TokenTTL) error {
+	famData, err := json.Marshal(fam)
+	if err != nil {
+		return err
+	}
+	refData, err := json.Marshal(RefreshRecord{UID: fam.UID, Family: family})
+	if err != nil {
+		return err
+	}
+	pipe.Set(ctx, AccessPrefix+fam.Access, fam.UID, ttl.Access)
+	pipe.Set(ctx, AccessFamilyPrefix+fam.Access, family, ttl.Access)
+	pipe.Set(ctx, RefreshPrefix+fam.Refresh, refData, ttl.Refresh)
+	pipe.Set(ctx, FamilyPrefix+family, famData, ttl.Refresh)
+	return nil
 }
 
-// GetUidByAccessToken 通过访问令牌获取用户ID
-func (r *SessionRepository) GetUidByAccessToken(ctx context.Context, token string) (int64, error) {
-	return r.imdb.Get(ctx, AccessPrefix+token).Int64()
+// delAccess 在事务中删除访问令牌
+func delAccess(ctx context.Context, pipe redis.Pipeliner, access string) {
+	pipe.Del(ctx, AccessPrefix+access, AccessFamilyPrefix+access)
 }
 
-// GetUidByRefreshToken 通过刷新令牌获取用户ID
-func (r *SessionRepository) GetUidByRefreshToken(ctx context.Context, token string) (int64, error) {
-	return r.imdb.Get(ctx, RefreshPrefix+token).Int64()
+func (r *SessionRepository) getFamily(ctx context.Context, c redis.Cmdable, family string) (*TokenFamily, error) {
+	data, err := c.Get(ctx, FamilyPrefix+family).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var fam TokenFamily
+	if err := json.Unmarshal(data, &fam); err != nil {
+		return nil, err
+	}
+	return &fam, nil
 }
 
-// DelAccessToken 删除访问令牌
-func (r *SessionRepository) DelAccessToken(ctx context.Context, token string) error {
-	return r.imdb.Del(ctx, AccessPrefix+token).Err()
+// CreateFamily 登录成功后创建令牌族
+func (r *SessionRepository) CreateFamily(ctx context.Context, family string, fam TokenFamily, ttl TokenTTL) error {
+	key := userFamiliesKey(fam.UID)
+	_, err := r.imdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if err := setTokens(ctx, pipe, family, fam, ttl); err != nil {
+			return err
+		}
+		pipe.SAdd(ctx, key, family)
+		pipe.Expire(ctx, key, ttl.Refresh)
+		return nil
+	})
+	return err
 }
 
-// DelRefreshToken 删除刷新令牌
-func (r *SessionRepository) DelRefreshToken(ctx context.Context, token string) error {
-	return r.imdb.Del(ctx, RefreshPrefix+token).Err()
+// GetRefreshRecord 查询刷新令牌（包括已轮换但未过期的旧令牌）
+func (r *SessionRepository) GetRefreshRecord(ctx context.Context, token string) (*RefreshRecord, error) {
+	data, err := r.imdb.Get(ctx, RefreshPrefix+token).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec RefreshRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// RotateFamily 用 oldRefresh 换取新令牌：旧访问令牌立即失效，旧刷新令牌保留以便检测重用
+// 返回轮换前的令牌族；oldRefresh 不是令牌族当前的刷新令牌时返回 ErrTokenReused，令牌族不做修改
+func (r *SessionRepository) RotateFamily(ctx context.Context, family, oldRefresh string, next TokenFamily, ttl TokenTTL) (*TokenFamily, error) {
+	key := FamilyPrefix + family
+	var prev *TokenFamily
+	err := r.imdb.Watch(ctx, func(tx *redis.Tx) error {
+		cur, err := r.getFamily(ctx, tx, family)
+		if err != nil {
+			return err
+		}
+		if cur.Refresh != oldRefresh {
+			return ErrTokenReused
+		}
+		next.UID = cur.UID
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			delAccess(ctx, pipe, cur.Access)
+			return setTokens(ctx, pipe, family, next, ttl)
+		})
+		prev = cur
+		return err
+	}, key)
+	return prev, err
+}
+
+// GetFamilyByAccessToken 查询访问令牌所属的令牌族
+func (r *SessionRepository) GetFamilyByAccessToken(ctx context.Context, token string) (string, error) {
+	family, err := r.imdb.Get(ctx, AccessFamilyPrefix+token).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrTokenNotFound
+	}
+	return family, err
+}
+
+// RevokeFamily 吊销令牌族：删除当前访问令牌与令牌族记录，族内所有刷新令牌随之失效
+// 返回被吊销的令牌族，令牌族不存在时返回 ErrTokenNotFound
+func (r *SessionRepository) RevokeFamily(ctx context.Context, family string) (*TokenFamily, error) {
+	fam, err := r.getFamily(ctx, r.imdb, family)
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.imdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		delAccess(ctx, pipe, fam.Access)
+		pipe.Del(ctx, FamilyPrefix+family)
+		pipe.SRem(ctx, userFamiliesKey(fam.UID), family)
+		return nil
+	})
+	return fam, err
+}
+
+// AddRevocation 记录已吊销的签名访问令牌，并清理已过期的记录
+func (r *SessionRepository) AddRevocation(ctx context.Context, tokenHash string, expireAt time.Time) error {
+	_, err := r.imdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, RevocationKey, redis.Z{Score: float64(expireAt.UnixMilli()), Member: tokenHash})
+		pipe.ZRemRangeByScore(ctx, RevocationKey, "-inf", strconv.FormatInt(time.Now().UnixMilli(), 10))
+		return nil
+	})
+	return err
+}
+
+// ListFamilies 返回用户的所有令牌族ID（可能包含已过期的）
+func (r *SessionRepository) ListFamilies(ctx context.Context, uid int64) ([]string, error) {
+	return r.imdb.SMembers(ctx, userFamiliesKey(uid)).Result()
+}
+
+// GetUidByAccessToken 通过访问令牌获取用户ID
+func (r *SessionRepository) GetUidByAccessToken(ctx context.Context, token string) (int64, error) {
+	return r.imdb.Get(ctx, AccessPrefix+token).Int64()
 }
 
 // HasAccessToken 检查访问令牌是否存在
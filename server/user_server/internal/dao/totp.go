@@ -0,0 +1,140 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+// TwoFactorPrefix uid -> 1，账号已启用两步验证（网关据此判断敏感操作是否需要两步验证）
+const TwoFactorPrefix = "user_2fa:"
+
+var ErrTOTPNotFound = errors.New("totp not enrolled")
+
+// TOTP 账号的 TOTP 配置
+type TOTP struct {
+	Secret   []byte
+	Enabled  bool
+	LastStep int64
+}
+
+type TOTPRepository struct {
+	db   *pgxpool.Pool
+	imdb *redis.Client
+}
+
+func NewTOTPRepository(pool *pgxpool.Pool, imdb *redis.Client) *TOTPRepository {
+	return &TOTPRepository{
+		db:   pool,
+		imdb: imdb,
+	}
+}
+
+func twoFactorKey(uid int64) string {
+	return TwoFactorPrefix + strconv.FormatInt(uid, 10)
+}
+
+// Get 返回账号的 TOTP 配置，未登记时返回 ErrTOTPNotFound
+func (r *TOTPRepository) Get(ctx context.Context, uid int64) (*TOTP, error) {
+	var t TOTP
+	err := r.db.QueryRow(ctx, `SELECT secret, enabled, last_step FROM user_totp WHERE uid = $1`, uid).
+		Scan(&t.Secret, &t.Enabled, &t.LastStep)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrTOTPNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Enabled 账号是否已启用两步验证
+func (r *TOTPRepository) Enabled(ctx context.Context, uid int64) (bool, error) {
+	t, err := r.Get(ctx, uid)
+	if errors.Is(err, ErrTOTPNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return t.Enabled, nil
+}
+
+// SavePending 登记尚未确认的密钥，覆盖此前未确认的登记，已启用时返回 false
+func (r *TOTPRepository) SavePending(ctx context.Context, uid int64, secret []byte) (bool, error) {
+	sql := `INSERT INTO user_totp (uid, secret) VALUES ($1, $2)
+		ON CONFLICT (uid) DO UPDATE SET secret = EXCLUDED.secret, last_step = 0, created_at = NOW()
+		WHERE user_totp.enabled = FALSE`
+	tag, err := r.db.Exec(ctx, sql, uid, secret)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseStep 记录已使用的时间步，时间步不大于上次使用的时间步（重放）时返回 false
+func (r *TOTPRepository) UseStep(ctx context.Context, uid, step int64) (bool, error) {
+	tag, err := r.db.Exec(ctx, `UPDATE user_totp SET last_step = $2 WHERE uid = $1 AND last_step < $2`, uid, step)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Enable 启用两步验证并写入备用码
+func (r *TOTPRepository) Enable(ctx context.Context, uid int64, backupHashes [][]byte) error {
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `UPDATE user_totp SET enabled = TRUE, enabled_at = NOW() WHERE uid = $1 AND enabled = FALSE`, uid)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrTOTPNotFound
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM user_totp_backup_codes WHERE uid = $1`, uid); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO user_totp_backup_codes (uid, code_hash) SELECT $1, unnest($2::bytea[])`, uid, backupHashes)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return r.imdb.Set(ctx, twoFactorKey(uid), 1, 0).Err()
+}
+
+// Disable 关闭两步验证，删除密钥与备用码
+func (r *TOTPRepository) Disable(ctx context.Context, uid int64) error {
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM user_totp_backup_codes WHERE uid = $1`, uid); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE uid = $1`, uid)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return r.imdb.Del(ctx, twoFactorKey(uid)).Err()
+}
+
+// UseBackupCode 使用一个未使用的备用码，不存在或已使用时返回 false
+func (r *TOTPRepository) UseBackupCode(ctx context.Context, uid int64, codeHash []byte) (bool, error) {
+	tag, err := r.db.Exec(ctx, `UPDATE user_totp_backup_codes SET used_at = NOW() WHERE uid = $1 AND code_hash = $2 AND used_at IS NULL`, uid, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// SyncFlag 按数据库状态修正 IMDB 中的两步验证标记
+func (r *TOTPRepository) SyncFlag(ctx context.Context, uid int64, enabled bool) error {
+	if enabled {
+		return r.imdb.Set(ctx, twoFactorKey(uid), 1, 0).Err()
+	}
+	return r.imdb.Del(ctx, twoFactorKey(uid)).Err()
+}
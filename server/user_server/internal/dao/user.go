@@ -2,11 +2,19 @@ package dao
 
 import (
 	"context"
+	"errors"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
 )
 
+var ErrUsernameTaken = errors.New("username already exists")
+
+// uniqueViolation PostgreSQL 唯一约束冲突的 SQLSTATE
+const uniqueViolation = "23505"
+
 type UserRepository struct {
 	db *pgxpool.Pool
 }
@@ -17,22 +25,74 @@ func NewUserRepository(pool *pgxpool.Pool) *UserRepository {
 	}
 }
 
-// 保存Opaque Record
-func (r *UserRepository) SaveUserRecord(ctx context.Context, username string, record []byte) error {
+// 创建用户并保存Opaque Record（及其密钥集版本）与恢复码，用户名或其折叠形式已存在时返回 ErrUsernameTaken
+func (r *UserRepository) CreateUser(ctx context.Context, username, nameKey string, record []byte, keyVersion int, codeHashes [][]byte) (int64, error) {
 	log.Debug().Str("uname", username).Any("record", record).Msg("save user record")
-	sql := `INSERT INTO users (name, opaque_record) VALUES ($1,$2) ON CONFLICT (name) DO NOTHING`
-	_, err := r.db.Exec(ctx, sql, username, record)
+	var uid int64
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		sql := `INSERT INTO users (name, name_key, opaque_record, opaque_key_version) VALUES ($1,$2,$3,$4) RETURNING id`
+		if err := tx.QueryRow(ctx, sql, username, nameKey, record, keyVersion).Scan(&uid); err != nil {
+			// 并发注册时由唯一约束（name 或 name_key）判定先后
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+				return ErrUsernameTaken
+			}
+			return err
+		}
+		return insertRecoveryCodes(ctx, tx, uid, codeHashes)
+	})
+	return uid, err
+}
+
+// 替换Opaque Record（修改密码）
+func (r *UserRepository) UpdateUserRecord(ctx context.Context, uid int64, record []byte, keyVersion int) error {
+	sql := `UPDATE users SET opaque_record = $2, opaque_key_version = $3, updated_at = NOW() WHERE id = $1`
+	tag, err := r.db.Exec(ctx, sql, uid, record, keyVersion)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
 	return err
 }
 
-// 获取Opaque Record
-func (r *UserRepository) GetUserRecord(ctx context.Context, username string) (int64, []byte, error) {
+// 获取Opaque Record及其密钥集版本
+func (r *UserRepository) GetUserRecord(ctx context.Context, username string) (int64, []byte, int, error) {
 	var id int64
 	var record []byte
-	sql := `SELECT id, opaque_record FROM users WHERE name = $1 LIMIT 1`
-	err := r.db.QueryRow(ctx, sql, username).Scan(&id, &record)
-	log.Debug().Str("uname", username).Any("record", record).Msg("read user record")
-	return id, record, err
+	var keyVersion int
+	sql := `SELECT id, opaque_record, opaque_key_version FROM users WHERE name = $1 LIMIT 1`
+	err := r.db.QueryRow(ctx, sql, username).Scan(&id, &record, &keyVersion)
+	log.Debug().Str("uname", username).Any("record", record).Int("key_version", keyVersion).Msg("read user record")
+	return id, record, keyVersion, err
+}
+
+// 获取用户注册记录绑定的密钥集版本
+func (r *UserRepository) GetKeyVersion(ctx context.Context, uid int64) (int, error) {
+	var keyVersion int
+	sql := `SELECT opaque_key_version FROM users WHERE id = $1 LIMIT 1`
+	err := r.db.QueryRow(ctx, sql, uid).Scan(&keyVersion)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrUserNotFound
+	}
+	return keyVersion, err
+}
+
+// 按密钥集版本统计用户数，用于判断旧密钥集能否停用
+func (r *UserRepository) CountByKeyVersion(ctx context.Context) (map[int]int64, error) {
+	rows, err := r.db.Query(ctx, `SELECT opaque_key_version, COUNT(*) FROM users GROUP BY opaque_key_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[int]int64)
+	for rows.Next() {
+		var version int
+		var n int64
+		if err := rows.Scan(&version, &n); err != nil {
+			return nil, err
+		}
+		counts[version] = n
+	}
+	return counts, rows.Err()
 }
 
 // 更新用户最后登录时间
@@ -42,10 +102,18 @@ func (r *UserRepository) UpdateLastLogin(ctx context.Context, uid int64) error {
 	return err
 }
 
-// 检查用户名是否存在
-func (r *UserRepository) UsernameExists(ctx context.Context, username string) (bool, error) {
+// 检查折叠形式相同的用户名是否存在
+func (r *UserRepository) NameKeyExists(ctx context.Context, nameKey string) (bool, error) {
 	var exists bool
-	sql := `SELECT EXISTS(SELECT 1 FROM users WHERE name = $1 LIMIT 1)`
-	err := r.db.QueryRow(ctx, sql, username).Scan(&exists)
+	sql := `SELECT EXISTS(SELECT 1 FROM users WHERE name_key = $1 LIMIT 1)`
+	err := r.db.QueryRow(ctx, sql, nameKey).Scan(&exists)
 	return exists, err
 }
+
+// 通过UID获取用户名
+func (r *UserRepository) GetUsername(ctx context.Context, uid int64) (string, error) {
+	var name string
+	sql := `SELECT name FROM users WHERE id = $1 LIMIT 1`
+	err := r.db.QueryRow(ctx, sql, uid).Scan(&name)
+	return name, err
+}
@@ -10,16 +10,21 @@ type RegisterInitResponse struct {
 	RegistrationResponse []byte `json:"registration_response"` // 服务端返回的 RegistrationResponse
 	ServerPublicKey      []byte `json:"server_public_key"`     // 服务器 AKE 公钥
 	CredentialIdentifier []byte `json:"credential_identifier,omitempty"`
+	RegistrationSession  string `json:"registration_session_id,omitempty"` // 注册会话ID，注册阶段 2 提交
 }
 
 // 注册阶段 2
+// 用户名取自注册会话，不信任客户端
 type RegisterFinalizeRequest struct {
-	Username           string `json:"username"`
-	RegistrationRecord []byte `json:"registration_record"` // 客户端计算并发来的完整注册记录
+	RegistrationSessionID string `json:"registration_session_id"`
+	RegistrationRecord    []byte `json:"registration_record"` // 客户端计算并发来的完整注册记录
 }
 
 type RegisterFinalizeResponse struct {
-	OK bool `json:"ok"`
+	OK            bool     `json:"ok"`
+	UID           int64    `json:"uid"`
+	Username      string   `json:"username"`
+	RecoveryCodes []string `json:"recovery_codes"` // 一次性恢复码，只在此时返回
 }
 
 // 登录阶段 1
@@ -29,24 +34,165 @@ type LoginInitRequest struct {
 }
 
 type LoginInitResponse struct {
-	KE2 []byte `json:"ke2"` // 服务端 KE2
-	MAC []byte `json:"mac"` // 登录阶段 2 验证
+	KE2            []byte `json:"ke2"`              // 服务端 KE2
+	LoginSessionID string `json:"login_session_id"` // 登录会话ID，登录阶段 2 提交
 }
 
 // 登录阶段 2
 type LoginFinalizeRequest struct {
-	KE3      []byte `json:"ke3"`      // 客户端 KE3
-	MAC      []byte `json:"mac"`      // 登录阶段 1 的 MAC
-	Username string `json:"username"` // 用户名
+	LoginSessionID string `json:"login_session_id"` // 登录阶段 1 返回的登录会话ID
+	KE3            []byte `json:"ke3"`              // 客户端 KE3
 }
 
 type LoginFinalizeResponse struct {
 	UID          int64  `json:"uid"`
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	ExpireAt     int64  `json:"expire_at"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpireAt     int64  `json:"expire_at,omitempty"`
+	MFARequired  bool   `json:"mfa_required,omitempty"`   // 需要两步验证，此时没有令牌
+	MFASessionID string `json:"mfa_session_id,omitempty"` // 提交给 /api/auth/2fa/verify
+	RekeyTicket  string `json:"rekey_ticket,omitempty"`   // 注册记录使用旧的 OPAQUE 密钥集，客户端凭此一次性凭据以同一密码重新注册
 }
 
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token"`
 }
+
+type LogoutResponse struct {
+	OK bool `json:"ok"`
+}
+
+type LogoutAllResponse struct {
+	Revoked int `json:"revoked"` // 吊销的会话（令牌族）数量
+}
+
+// 重新验证阶段 1（需要访问令牌）：修改密码等敏感操作前重新证明密码
+type ReauthInitRequest struct {
+	KE1 []byte `json:"ke1"`
+}
+
+type ReauthInitResponse struct {
+	KE2             []byte `json:"ke2"`
+	ReauthSessionID string `json:"reauth_session_id"` // 重新验证阶段 2 提交
+	MFARequired     bool   `json:"mfa_required"`      // 阶段 2 需要提交验证码或备用码
+}
+
+// 重新验证阶段 2（需要访问令牌）
+type ReauthFinalizeRequest struct {
+	ReauthSessionID string `json:"reauth_session_id"`
+	KE3             []byte `json:"ke3"`
+	Code            string `json:"code,omitempty"` // 启用两步验证时的验证码或备用码
+}
+
+type ReauthFinalizeResponse struct {
+	ReauthToken string `json:"reauth_token"` // 一次性凭据，5 分钟内由同一会话提交
+}
+
+// 修改密码阶段 1（需要访问令牌与重新验证凭据）
+// 携带登录响应中的 rekey_ticket 时为密钥迁移，不需要 reauth_token
+type PasswordChangeInitRequest struct {
+	ReauthToken         string `json:"reauth_token,omitempty"`
+	RekeyTicket         string `json:"rekey_ticket,omitempty"`
+	RegistrationRequest []byte `json:"registration_request"`
+}
+
+type PasswordChangeInitResponse struct {
+	RegistrationResponse []byte `json:"registration_response"`
+	ServerPublicKey      []byte `json:"server_public_key"`
+	ChangeSessionID      string `json:"change_session_id"` // 修改密码阶段 2 提交
+}
+
+// 修改密码阶段 2（需要访问令牌）
+type PasswordChangeFinalizeRequest struct {
+	ChangeSessionID    string `json:"change_session_id"`
+	RegistrationRecord []byte `json:"registration_record"`
+}
+
+type PasswordChangeFinalizeResponse struct {
+	Revoked int `json:"revoked"` // 吊销的其他会话（令牌族）数量
+}
+
+// 重新生成恢复码（需要访问令牌与重新验证凭据）
+type RecoveryCodesRegenerateRequest struct {
+	ReauthToken string `json:"reauth_token"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	Remaining     int      `json:"remaining"` // 未使用的恢复码数量
+}
+
+// 找回阶段 1
+type RecoverInitRequest struct {
+	Username            string `json:"username"`
+	RecoveryCode        string `json:"recovery_code"`
+	RegistrationRequest []byte `json:"registration_request"`
+}
+
+type RecoverInitResponse struct {
+	RegistrationResponse []byte `json:"registration_response"`
+	ServerPublicKey      []byte `json:"server_public_key"`
+	RecoverySessionID    string `json:"recovery_session_id"` // 找回阶段 2 提交
+}
+
+// 找回阶段 2
+type RecoverFinalizeRequest struct {
+	RecoverySessionID  string `json:"recovery_session_id"`
+	RegistrationRecord []byte `json:"registration_record"`
+}
+
+type RecoverFinalizeResponse struct {
+	OK bool `json:"ok"`
+}
+
+// KeySetUsage OPAQUE 密钥集版本的使用情况
+type KeySetUsage struct {
+	Version int   `json:"version"`
+	Active  bool  `json:"active"` // 新注册使用的版本
+	Loaded  bool  `json:"loaded"` // 未加载（已停用）的版本上的用户无法登录，只能凭恢复码找回
+	Users   int64 `json:"users"`
+}
+
+type KeySetUsageResponse struct {
+	Active  int           `json:"active"`
+	KeySets []KeySetUsage `json:"key_sets"`
+}
+
+// TokenKey 签名访问令牌的验签公钥（JWK，kty=OKP, crv=Ed25519）
+type TokenKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	X   string `json:"x"` // base64url 编码的公钥
+}
+
+// TokenKeysResponse 验签公钥集合（JWKS），网关定期拉取
+type TokenKeysResponse struct {
+	Keys []TokenKey `json:"keys"`
+}
+
+type TwoFactorStatusResponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Secret     string `json:"secret"`      // base32 密钥，无法扫码时手动输入
+	OTPAuthURI string `json:"otpauth_uri"` // 生成二维码供验证器扫描
+}
+
+// 确认登记或关闭两步验证（需要访问令牌）
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"` // TOTP 验证码，关闭时也可以使用备用码
+}
+
+type TwoFactorConfirmResponse struct {
+	BackupCodes []string `json:"backup_codes"` // 仅返回一次
+}
+
+// 登录的两步验证
+type TwoFactorVerifyRequest struct {
+	MFASessionID string `json:"mfa_session_id"`
+	Code         string `json:"code"` // TOTP 验证码或备用码
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// LoginAttempt 认证请求的审计记录（auth_login_log）
+type LoginAttempt struct {
+	ID        int64     `json:"id"`
+	UID       int64     `json:"uid,omitempty"` // 未识别出用户时为 0
+	Username  string    `json:"username"`
+	Action    string    `json:"action"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"` // 失败原因
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginLogFilter 审计日志查询条件，零值字段不参与过滤
+type LoginLogFilter struct {
+	UID      int64
+	Username string // 与 UID 同时指定时匹配 uid 或（未识别用户的）用户名
+	IP       string
+	Actions  []string
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+type SignInsResponse struct {
+	Items []LoginAttempt `json:"items"`
+}
+
+type LoginLogResponse struct {
+	Items []LoginAttempt `json:"items"`
+}
@@ -0,0 +1,57 @@
+package model
+
+import "time"
+
+// 账号状态（user_status 枚举）
+const (
+	StatusActive    = "ACTIVE"
+	StatusInactive  = "INACTIVE"
+	StatusSuspended = "SUSPENDED"
+	StatusBanned    = "BANNED"
+	StatusArchived  = "ARCHIVED"
+)
+
+// Sanction 处罚记录（user_sanctions）
+type Sanction struct {
+	ID        int64      `json:"id"`
+	UID       int64      `json:"uid"`
+	Kind      string     `json:"kind"` // SUSPENDED 或 BANNED
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // 为空表示永久
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	LiftedBy  string     `json:"lifted_by,omitempty"`
+	LiftedAt  *time.Time `json:"lifted_at,omitempty"`
+}
+
+type ApplySanctionRequest struct {
+	Kind     string `json:"kind"`     // SUSPENDED 或 BANNED
+	Reason   string `json:"reason"`   // 处罚原因，会展示给用户
+	Duration int64  `json:"duration"` // 持续秒数，0 表示永久（暂停必须指定）
+	Operator string `json:"operator"` // 操作者
+}
+
+type LiftSanctionRequest struct {
+	Operator string `json:"operator"`
+}
+
+type SanctionResponse struct {
+	Sanction *Sanction `json:"sanction"`
+	Revoked  int       `json:"revoked"` // 吊销的会话（令牌族）数量
+}
+
+type SanctionsResponse struct {
+	Status string     `json:"status"` // 当前账号状态
+	Items  []Sanction `json:"items"`
+}
+
+type LiftSanctionsResponse struct {
+	Lifted int64 `json:"lifted"`
+}
+
+// AccountStatusPayload 账号不可用时随错误返回
+type AccountStatusPayload struct {
+	Status   string `json:"status"`
+	Reason   string `json:"reason,omitempty"`
+	ExpireAt int64  `json:"expire_at,omitempty"` // 毫秒时间戳，0 表示永久
+}
@@ -9,12 +9,22 @@ import (
 )
 
 type RouteDependencies struct {
-	AuthSvc *services.AuthService
+	AuthSvc      *services.AuthService
+	AuditSvc     *services.AuditService
+	AccountSvc   *services.AccountService
+	PasswordSvc  *services.PasswordService
+	TwoFactorSvc *services.TwoFactorService
+	ReauthSvc    *services.ReauthService
+	LoginGuard   *services.LoginGuard
+	AdminToken   string // 为空时不开放管理接口
 }
 
 func ConfigRoute(app *fiber.App, dep *RouteDependencies) {
 
-	authHandler := handler.NewAuthHandler(dep.AuthSvc)
+	authHandler := handler.NewAuthHandler(dep.AuthSvc, dep.AuditSvc, dep.LoginGuard)
+	passwordHandler := handler.NewPasswordHandler(dep.PasswordSvc, dep.AuditSvc, dep.LoginGuard)
+	twoFactorHandler := handler.NewTwoFactorHandler(dep.TwoFactorSvc, dep.AuditSvc, dep.LoginGuard)
+	reauthHandler := handler.NewReauthHandler(dep.ReauthSvc, dep.AuditSvc, dep.LoginGuard)
 
 	app.Use("/assets", static.New("/etc/web/static/auth/assets"))
 	app.Use("/page/login", static.New("/etc/web/auth/index.html"))
@@ -29,4 +39,41 @@ func ConfigRoute(app *fiber.App, dep *RouteDependencies) {
 	// 登录接口
 	app.Post("/api/auth/login-init", authHandler.LoginInit)
 	app.Post("/api/auth/login-finalize", authHandler.LoginFinalize)
+	app.Post("/api/auth/2fa/verify", twoFactorHandler.Verify)
+
+	// 会话接口
+	app.Post("/api/auth/refresh", authHandler.RefreshToken)
+	app.Post("/api/auth/logout", authHandler.Logout)
+	app.Post("/api/auth/logout-all", authHandler.LogoutAll)
+	app.Get("/api/auth/sign-ins", authHandler.SignIns)
+	app.Get("/api/auth/keys", authHandler.TokenKeys)
+
+	// 重新验证接口（修改密码、重新生成恢复码前）
+	app.Post("/api/auth/reauth-init", reauthHandler.Init)
+	app.Post("/api/auth/reauth-finalize", reauthHandler.Finalize)
+
+	// 密码接口
+	app.Post("/api/auth/password/change-init", passwordHandler.ChangeInit)
+	app.Post("/api/auth/password/change-finalize", passwordHandler.ChangeFinalize)
+	app.Get("/api/auth/recovery-codes", passwordHandler.RecoveryCodes)
+	app.Post("/api/auth/recovery-codes", passwordHandler.RegenerateRecoveryCodes)
+	app.Post("/api/auth/recover-init", passwordHandler.RecoverInit)
+	app.Post("/api/auth/recover-finalize", passwordHandler.RecoverFinalize)
+
+	// 两步验证接口
+	app.Get("/api/auth/2fa", twoFactorHandler.Status)
+	app.Post("/api/auth/2fa/totp/enroll", twoFactorHandler.Enroll)
+	app.Post("/api/auth/2fa/totp/confirm", twoFactorHandler.Confirm)
+	app.Post("/api/auth/2fa/totp/disable", twoFactorHandler.Disable)
+
+	// 管理接口
+	if dep.AdminToken != "" {
+		adminHandler := handler.NewAdminHandler(dep.AuditSvc, dep.AccountSvc, dep.AuthSvc)
+		admin := app.Group("/admin", handler.AdminAuth(dep.AdminToken))
+		admin.Get("/login-log", adminHandler.LoginLog)
+		admin.Get("/users/:uid/sanctions", adminHandler.Sanctions)
+		admin.Post("/users/:uid/sanctions", adminHandler.ApplySanction)
+		admin.Post("/users/:uid/sanctions/lift", adminHandler.LiftSanctions)
+		admin.Get("/opaque-keys", adminHandler.OpaqueKeys)
+	}
 }
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/user/internal/dao"
+	"github.com/zrurf/quiver/server/user/internal/model"
+	"github.com/zrurf/quiver/server/user/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// kickReasonBanned 处罚时网关断线通知的原因（网关协议 NoticeReason 枚举名称）
+const kickReasonBanned = "Banned"
+
+var ErrInvalidSanction = errors.New("invalid sanction")
+
+// AccountService 账号处罚管理
+type AccountService struct {
+	sanctionDao *dao.SanctionRepository
+	auth        *AuthService
+}
+
+func NewAccountService(sanctionDao *dao.SanctionRepository, auth *AuthService) *AccountService {
+	return &AccountService{
+		sanctionDao: sanctionDao,
+		auth:        auth,
+	}
+}
+
+// ApplySanction 封禁或暂停账号，立即吊销其所有令牌并断开游戏会话
+func (s *AccountService) ApplySanction(ctx context.Context, uid int64, req *model.ApplySanctionRequest) (_ *model.Sanction, _ int, err error) {
+	ctx, span := tracing.Start(ctx, "account.ApplySanction", trace.WithAttributes(
+		attribute.Int64("user.id", uid), attribute.String("sanction.kind", req.Kind)))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	switch {
+	case req.Kind != model.StatusSuspended && req.Kind != model.StatusBanned:
+		return nil, 0, fmt.Errorf("%w: kind must be SUSPENDED or BANNED", ErrInvalidSanction)
+	case req.Reason == "" || req.Operator == "":
+		return nil, 0, fmt.Errorf("%w: reason and operator are required", ErrInvalidSanction)
+	case req.Duration < 0 || (req.Kind == model.StatusSuspended && req.Duration == 0):
+		return nil, 0, fmt.Errorf("%w: suspension requires a positive duration", ErrInvalidSanction)
+	}
+
+	sanction, err := s.sanctionDao.Apply(ctx, uid, req.Kind, req.Reason, req.Duration, req.Operator)
+	if err != nil {
+		return nil, 0, err
+	}
+	log.Warn().Int64("uid", uid).Str("kind", req.Kind).Str("operator", req.Operator).Str("reason", req.Reason).Msg("sanction applied")
+
+	revoked, err := s.auth.RevokeUserSessions(ctx, dao.SessionKickEvent{
+		UID:     uid,
+		Reason:  kickReasonBanned,
+		Message: sanctionMessage(sanction),
+	})
+	if err != nil {
+		return sanction, revoked, fmt.Errorf("sanction applied but failed to revoke sessions: %w", err)
+	}
+	return sanction, revoked, nil
+}
+
+// LiftSanctions 解除用户所有未解除的处罚
+func (s *AccountService) LiftSanctions(ctx context.Context, uid int64, operator string) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "account.LiftSanctions", trace.WithAttributes(attribute.Int64("user.id", uid)))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	if operator == "" {
+		return 0, fmt.Errorf("%w: operator is required", ErrInvalidSanction)
+	}
+	lifted, err := s.sanctionDao.Lift(ctx, uid, operator)
+	if err != nil {
+		return 0, err
+	}
+	log.Info().Int64("uid", uid).Str("operator", operator).Int64("lifted", lifted).Msg("sanctions lifted")
+	return lifted, nil
+}
+
+// ListSanctions 返回账号当前状态与处罚记录
+func (s *AccountService) ListSanctions(ctx context.Context, uid int64) (_ string, _ []model.Sanction, err error) {
+	ctx, span := tracing.Start(ctx, "account.ListSanctions", trace.WithAttributes(attribute.Int64("user.id", uid)))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	status, _, err := s.sanctionDao.AccountStatus(ctx, uid)
+	if err != nil {
+		return "", nil, err
+	}
+	items, err := s.sanctionDao.List(ctx, uid)
+	return status, items, err
+}
+
+// sanctionMessage 网关断线通知中展示给玩家的说明
+func sanctionMessage(sanction *model.Sanction) string {
+	if sanction.ExpiresAt == nil {
+		return sanction.Reason
+	}
+	return sanction.Reason + " (until " + sanction.ExpiresAt.UTC().Format(time.RFC3339) + ")"
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/user/internal/dao"
+	"github.com/zrurf/quiver/server/user/internal/model"
+	"github.com/zrurf/quiver/server/user/internal/tracing"
+)
+
+// 审计日志中的操作
+const (
+	ActionRegisterInit     = "register-init"
+	ActionRegisterFinalize = "register-finalize"
+	ActionLoginInit        = "login-init"
+	ActionLoginFinalize    = "login-finalize"
+	ActionRefresh          = "refresh"
+	ActionPasswordChange   = "password-change"
+	ActionRecover          = "recover"
+	ActionMFAVerify        = "mfa-verify"
+	ActionTwoFactorEnable  = "2fa-enable"
+	ActionTwoFactorDisable = "2fa-disable"
+	ActionRekey            = "rekey"  // 登录后用同一密码迁移到当前 OPAQUE 密钥集
+	ActionReauth           = "reauth" // 已登录的用户在敏感操作前重新验证密码
+)
+
+// 审计日志中的失败原因
+const (
+	ReasonInvalidRequest     = "invalid_request"
+	ReasonUsernameTaken      = "username_taken"
+	ReasonInvalidUsername    = "invalid_username"
+	ReasonUsernameReserved   = "username_reserved"
+	ReasonInvalidCredentials = "invalid_credentials"
+	ReasonInvalidToken       = "invalid_token"
+	ReasonTokenReused        = "token_reused"
+	ReasonSessionExpired     = "session_expired"
+	ReasonInvalidRecovery    = "invalid_recovery_code"
+	ReasonMFARequired        = "mfa_required" // 密码正确，等待两步验证
+	ReasonInvalidTOTP        = "invalid_totp"
+	ReasonAccountPrefix      = "account_" // 账号被处罚或停用：account_suspended、account_banned 等
+	ReasonRateLimited        = "rate_limited"
+	ReasonAccountLocked      = "account_locked"
+	ReasonServerError        = "server_error"
+)
+
+const (
+	auditWriteTimeout  = 3 * time.Second
+	defaultAuditLimit  = 20
+	maxAuditLimit      = 200
+	maxUserAgentLength = 512
+	maxAuditNameLength = 64
+)
+
+// signInActions 用户可见的“最近登录”包含登录、刷新与账号安全设置的变更
+var signInActions = []string{
+	ActionLoginInit, ActionLoginFinalize, ActionMFAVerify, ActionRefresh,
+	ActionPasswordChange, ActionRecover, ActionTwoFactorEnable, ActionTwoFactorDisable, ActionReauth,
+}
+
+type AuditService struct {
+	loginLogDao *dao.LoginLogRepository
+	userDao     *dao.UserRepository
+	sessionDao  *dao.SessionRepository
+}
+
+func NewAuditService(
+	loginLogDao *dao.LoginLogRepository,
+	userDao *dao.UserRepository,
+	sessionDao *dao.SessionRepository,
+) *AuditService {
+	return &AuditService{
+		loginLogDao: loginLogDao,
+		userDao:     userDao,
+		sessionDao:  sessionDao,
+	}
+}
+
+// RecordAttempt 异步写入审计记录，写入失败只记录日志，不影响请求
+// a 中的字符串可能引用请求缓冲区，在返回前复制
+func (s *AuditService) RecordAttempt(ctx context.Context, a *model.LoginAttempt) {
+	rec := *a
+	rec.Username = truncate(strings.Clone(rec.Username), maxAuditNameLength)
+	rec.Reason = strings.Clone(rec.Reason)
+	rec.UserAgent = truncate(strings.Clone(rec.UserAgent), maxUserAgentLength)
+	if net.ParseIP(rec.IP) == nil {
+		rec.IP = ""
+	} else {
+		rec.IP = strings.Clone(rec.IP)
+	}
+	if rec.Success {
+		rec.Reason = ""
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, auditWriteTimeout)
+		defer cancel()
+		ctx, span := tracing.Start(ctx, "audit.RecordAttempt")
+		defer span.End()
+		if err := s.loginLogDao.Insert(ctx, &rec); err != nil {
+			tracing.RecordError(span, err)
+			log.Error().Err(err).Str("action", rec.Action).Str("username", rec.Username).Msg("failed to write login log")
+		}
+	}()
+}
+
+// RecentSignIns 返回访问令牌所属用户最近的登录记录，包括针对其用户名的失败尝试
+func (s *AuditService) RecentSignIns(ctx context.Context, accessToken string, limit int) (_ []model.LoginAttempt, err error) {
+	ctx, span := tracing.Start(ctx, "audit.RecentSignIns")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	uid, err := s.sessionDao.GetUidByAccessToken(ctx, accessToken)
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get uid by access token: %w", err)
+	}
+	username, err := s.userDao.GetUsername(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get username: %w", err)
+	}
+	return s.loginLogDao.Query(ctx, model.LoginLogFilter{
+		UID:      uid,
+		Username: username,
+		Actions:  signInActions,
+		Limit:    clampLimit(limit),
+	})
+}
+
+// QueryLoginLog 管理接口：按 uid、IP 与时间范围查询审计记录
+func (s *AuditService) QueryLoginLog(ctx context.Context, f model.LoginLogFilter) (_ []model.LoginAttempt, err error) {
+	ctx, span := tracing.Start(ctx, "audit.QueryLoginLog")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	f.Limit = clampLimit(f.Limit)
+	return s.loginLogDao.Query(ctx, f)
+}
+
+func clampLimit(limit int) int {
+	if limit <= 0 {
+		return defaultAuditLimit
+	}
+	return min(limit, maxAuditLimit)
+}
+
+// truncate 按字节截断，不切断 UTF-8 字符
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
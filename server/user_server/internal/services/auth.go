@@ -1,15 +1,26 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/bytemare/opaque"
-	"github.com/bytemare/opaque/message"
+	"github.com/jackc/pgx/v5"
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
 	"github.com/zrurf/quiver/server/user/internal/dao"
+	"github.com/zrurf/quiver/server/user/internal/model"
+	"github.com/zrurf/quiver/server/user/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -17,26 +28,77 @@ const (
 	refreshTokenExpireSeconds = 86400 * 7 // 7d有效期
 	maxTokenRetries           = 3         // 最大token生成重试次数
 	sessionTokenLength        = 32        // token长度
+	tokenFamilyIDLength       = 16        // 令牌族ID长度
+	loginSessionExpireSeconds = 120       // 登录会话（login-init 到 login-finalize）有效期
+	loginSessionIDLength      = 32        // 登录会话ID长度
+	mfaSessionExpireSeconds   = 300       // 两步验证会话（login-finalize 到 2fa/verify）有效期
 )
 
+// kickReasonTokenRevoked 网关断线通知的原因（网关协议 NoticeReason 枚举名称）
+const kickReasonTokenRevoked = "TokenRevoked"
+
+var (
+	ErrInvalidToken        = errors.New("invalid or expired token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrLoginSessionExpired = errors.New("login session not found or expired")
+	ErrAccountDisabled     = errors.New("account disabled")
+	ErrUsernameTaken       = errors.New("username already exists")
+	ErrInvalidRecord       = errors.New("invalid registration record")
+	ErrRegistrationExpired = errors.New("registration session not found or expired")
+)
+
+// AccountStatusError 账号被处罚或停用，Reason 与 ExpiresAt 来自当前生效的处罚
+type AccountStatusError struct {
+	Status    string
+	Reason    string
+	ExpiresAt *time.Time
+}
+
+func (e *AccountStatusError) Error() string {
+	return "account " + strings.ToLower(e.Status)
+}
+
+func (e *AccountStatusError) Unwrap() error {
+	return ErrAccountDisabled
+}
+
 type AuthService struct {
-	userDao    *dao.UserRepository
-	sessionDao *dao.SessionRepository
-	imdb       *redis.Client
-	opaque     *OpaqueService
+	userDao         *dao.UserRepository
+	sessionDao      *dao.SessionRepository
+	loginSessionDao *dao.LoginSessionRepository
+	sanctionDao     *dao.SanctionRepository
+	totpDao         *dao.TOTPRepository
+	usernames       *UsernameService
+	imdb            *redis.Client
+	opaque          *OpaqueService
+	events          *dao.NatsClient // 可为 nil
+	signer          *TokenSigner    // 未配置签名密钥时为 nil，签发随机令牌
 }
 
 func NewAuthService(
 	userDao *dao.UserRepository,
 	sessionDao *dao.SessionRepository,
+	loginSessionDao *dao.LoginSessionRepository,
+	sanctionDao *dao.SanctionRepository,
+	totpDao *dao.TOTPRepository,
+	usernames *UsernameService,
 	imdb *redis.Client,
 	opaque *OpaqueService,
+	events *dao.NatsClient,
+	signer *TokenSigner,
 ) *AuthService {
 	return &AuthService{
-		userDao:    userDao,
-		sessionDao: sessionDao,
-		imdb:       imdb,
-		opaque:     opaque,
+		userDao:         userDao,
+		sessionDao:      sessionDao,
+		loginSessionDao: loginSessionDao,
+		sanctionDao:     sanctionDao,
+		totpDao:         totpDao,
+		usernames:       usernames,
+		imdb:            imdb,
+		opaque:          opaque,
+		events:          events,
+		signer:          signer,
 	}
 }
 
@@ -45,149 +107,677 @@ func (s *AuthService) credentialIdentifierFromUsername(username string) []byte {
 	return []byte(username)
 }
 
-// UsernameExists 检测用户名是否存在
-func (s *AuthService) UsernameExists(ctx context.Context, username string) (bool, error) {
-	return s.userDao.UsernameExists(ctx, username)
+// RegisterInit 处理注册第一步：校验并预留用户名，接收 RegistrationRequest，返回 RegistrationResponse + serverPublicKey + 注册会话ID
+// 用户名不符合规则时返回 ErrInvalidUsername 或 ErrUsernameReserved，已被注册或正被他人注册时返回 ErrUsernameTaken
+func (s *AuthService) RegisterInit(ctx context.Context, username string, registrationRequest []byte) (_ []byte, _ []byte, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "auth.RegisterInit")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	// 注册会话ID同时作为用户名预留的持有者，直到 register-finalize 或过期
+	sessionID := s.opaque.GenerateToken(loginSessionIDLength)
+	key, err := s.usernames.Reserve(ctx, username, sessionID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	respBytes, serverPubKey, keyVersion, err := s.registrationResponse(ctx, username, registrationRequest)
+	if err != nil {
+		_ = s.usernames.Release(ctx, key, sessionID)
+		return nil, nil, "", err
+	}
+
+	ttl := s.usernames.ReservationTTL()
+	ok, err := s.loginSessionDao.SaveRegistration(ctx, sessionID, &dao.RegistrationState{
+		Username:             username,
+		NameKey:              key,
+		CredentialIdentifier: s.credentialIdentifierFromUsername(username),
+		KeyVersion:           keyVersion,
+		ExpireAt:             time.Now().Add(ttl).UnixMilli(),
+	}, ttl)
+	if err == nil && !ok {
+		err = fmt.Errorf("registration session id collision")
+	}
+	if err != nil {
+		_ = s.usernames.Release(ctx, key, sessionID)
+		return nil, nil, "", fmt.Errorf("failed to save registration session: %w", err)
+	}
+	return respBytes, serverPubKey, sessionID, nil
 }
 
-// RegisterInit 处理注册第一步：接收 RegistrationRequest，返回 RegistrationResponse + serverPublicKey
-func (s *AuthService) RegisterInit(ctx context.Context, username string, registrationRequest []byte) ([]byte, []byte, error) {
+// registrationResponse 用当前密钥集为用户名生成 RegistrationResponse，返回响应、服务器公钥与密钥集版本
+// 注册、修改密码与找回账号共用，第二步保存记录时必须使用同一版本
+func (s *AuthService) registrationResponse(ctx context.Context, username string, registrationRequest []byte) ([]byte, []byte, int, error) {
+	keyVersion := s.opaque.ActiveVersion()
+	server, err := s.opaque.GetServerFor(keyVersion)
+	if err != nil {
+		return nil, nil, 0, err
+	}
 	// 反序列化客户端发来的 RegistrationRequest
-	req, err := s.opaque.GetServer().Deserialize.RegistrationRequest(registrationRequest)
+	req, err := server.Deserialize.RegistrationRequest(registrationRequest)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to deserialize registration request: %w", err)
+		return nil, nil, 0, fmt.Errorf("failed to deserialize registration request: %w", err)
 	}
 
 	credId := s.credentialIdentifierFromUsername(username)
 
-	serverPubKey := s.opaque.GetServerPublicKey()
+	serverPubKey, err := s.opaque.GetServerPublicKey(keyVersion)
+	if err != nil {
+		return nil, nil, 0, err
+	}
 
-	resp, err := s.opaque.GetServer().RegistrationResponse(req, credId, nil)
+	_, opSpan := tracing.Start(ctx, "opaque.RegistrationResponse")
+	resp, err := server.RegistrationResponse(req, credId, nil)
+	opSpan.End()
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to create registration response: %w", err)
+	}
 
 	// 序列化并返回
 	respBytes := resp.Serialize()
-	return respBytes, serverPubKey, nil
+	return respBytes, serverPubKey, keyVersion, nil
 }
 
-// RegisterFinalize 处理注册第二步：接收 RegistrationRecord，存储到数据库
-func (s *AuthService) RegisterFinalize(ctx context.Context, username string, registrationRecord []byte) error {
+// RegisterFinalize 处理注册第二步：取出注册会话，接收 RegistrationRecord，存储到数据库，返回 uid、用户名与一次性恢复码
+// 注册会话只能使用一次，不存在或已过期时返回 ErrRegistrationExpired；用户名已被他人注册时返回 ErrUsernameTaken
+func (s *AuthService) RegisterFinalize(ctx context.Context, sessionID string, registrationRecord []byte) (_ int64, _ string, _ []string, err error) {
+	ctx, span := tracing.Start(ctx, "auth.RegisterFinalize")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	state, err := s.loginSessionDao.TakeRegistration(ctx, sessionID)
+	if errors.Is(err, dao.ErrLoginSessionNotFound) {
+		return 0, "", nil, ErrRegistrationExpired
+	}
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("failed to get registration session: %w", err)
+	}
+	username := state.Username
+	// 注册会话已使用，无论结果如何都释放预留，失败后需要重新 register-init
+	defer func() {
+		if err := s.usernames.Release(ctx, state.NameKey, sessionID); err != nil {
+			log.Warn().Err(err).Str("username", username).Msg("failed to release username reservation")
+		}
+	}()
+
+	// 凭据标识与 register-init 时不一致说明用户名规则或标识的生成方式已变更；密钥集已停用时同样需要重新注册
+	if !bytes.Equal(state.CredentialIdentifier, s.credentialIdentifierFromUsername(username)) || !s.opaque.HasVersion(state.KeyVersion) {
+		return 0, username, nil, ErrRegistrationExpired
+	}
 	// 反序列化验证格式，提前发现客户端错误
-	record, err := s.opaque.GetServer().Deserialize.RegistrationRecord(registrationRecord)
+	if err := s.validateRegistrationRecord(registrationRecord); err != nil {
+		return 0, username, nil, err
+	}
+	// 预留过期后可能已被他人重新预留
+	if other, err := s.usernames.ReservedByOther(ctx, state.NameKey, sessionID); err != nil {
+		return 0, username, nil, err
+	} else if other {
+		return 0, username, nil, ErrUsernameTaken
+	}
+	codes, hashes, err := generateRecoveryCodes()
 	if err != nil {
-		return fmt.Errorf("failed to deserialize registration record: %w", err)
+		return 0, username, nil, fmt.Errorf("failed to generate recovery codes: %w", err)
 	}
-	_ = record // 回收
 	// 将注册记录存到数据库 opaque_record 字段
-	if err := s.userDao.SaveUserRecord(ctx, username, registrationRecord); err != nil {
-		return fmt.Errorf("failed to save user opaque record: %w", err)
+	uid, err := s.userDao.CreateUser(ctx, username, state.NameKey, registrationRecord, state.KeyVersion, hashes)
+	if err != nil {
+		if errors.Is(err, dao.ErrUsernameTaken) {
+			return 0, username, nil, ErrUsernameTaken
+		}
+		return 0, username, nil, fmt.Errorf("failed to save user opaque record: %w", err)
+	}
+	span.SetAttributes(attribute.Int64("user.id", uid))
+	return uid, username, codes, nil
+}
+
+// validateRegistrationRecord 反序列化 RegistrationRecord 校验格式
+func (s *AuthService) validateRegistrationRecord(registrationRecord []byte) error {
+	if _, err := s.opaque.GetServer().Deserialize.RegistrationRecord(registrationRecord); err != nil {
+		return fmt.Errorf("%w: failed to deserialize registration record: %v", ErrInvalidRecord, err)
 	}
 	return nil
 }
 
-// LoginInit 处理登录第一步：接收 KE1，读取用户 record，返回 KE2
-func (s *AuthService) LoginInit(ctx context.Context, username string, ke1Bytes []byte) ([]byte, []byte, []byte, error) {
+// LoginInit 处理登录第一步：接收 KE1，读取用户 record，返回 KE2 与登录会话ID
+// 期望的 ClientMAC 与会话密钥只保存在服务端，用户不存在时使用假记录，响应与存在的用户一致
+func (s *AuthService) LoginInit(ctx context.Context, username string, ke1Bytes []byte) (_ []byte, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "auth.LoginInit")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	ke2, state, err := s.generateKE2(ctx, username, ke1Bytes)
+	if err != nil {
+		return nil, "", err
+	}
+	loginSessionID, err := s.saveLoginState(ctx, state)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to save login session: %w", err)
+	}
+	return ke2, loginSessionID, nil
+}
+
+// generateKE2 用用户的注册记录（不存在时为假记录）生成 KE2，返回 KE2 与 KE3 校验所需的状态
+// 登录与已登录用户的重新验证共用
+func (s *AuthService) generateKE2(ctx context.Context, username string, ke1Bytes []byte) ([]byte, *dao.LoginState, error) {
 	// 反序列化 KE1
 	ke1, err := s.opaque.GetServer().Deserialize.KE1(ke1Bytes)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to deserialize KE1: %w", err)
+		return nil, nil, fmt.Errorf("failed to deserialize KE1: %w", err)
 	}
 
-	// 获取用户的 RegistrationRecord（opaque_record）
-	_, recordBytes, err := s.userDao.GetUserRecord(ctx, username)
-	if err != nil {
-		// 为避免用户枚举，调用 conf.GetFakeRecord 构造假 record，继续返回 KE2
-		log.Warn().Err(err).Msg("user not found")
-		return s.fakeLoginInit(username, ke1)
+	// 获取用户的 RegistrationRecord（opaque_record）及其密钥集版本
+	credId := s.credentialIdentifierFromUsername(username)
+	uid, recordBytes, keyVersion, err := s.userDao.GetUserRecord(ctx, username)
+	if err == nil && !s.opaque.HasVersion(keyVersion) {
+		// 记录绑定的密钥集已停用，只能凭恢复码找回，按用户不存在处理
+		log.Warn().Int64("uid", uid).Int("key_version", keyVersion).Msg("opaque key set of user record retired")
+		err = pgx.ErrNoRows
+	}
+	var clientRecord *opaque.ClientRecord
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		// 为避免用户枚举，使用假 record 继续生成 KE2，客户端无法据此区分用户是否存在
+		uid, keyVersion = 0, s.opaque.ActiveVersion()
+		clientRecord, err = s.opaque.conf.GetFakeRecord(credId)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get fake record: %w", err)
+		}
+	case err != nil:
+		return nil, nil, fmt.Errorf("failed to get user record: %w", err)
+	default:
+		// 反序列化 RegistrationRecord
+		regRecord, err := s.opaque.GetServer().Deserialize.RegistrationRecord(recordBytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to deserialize registration record: %w", err)
+		}
+		clientRecord = &opaque.ClientRecord{
+			CredentialIdentifier: credId,
+			ClientIdentity:       credId,
+			RegistrationRecord:   regRecord,
+		}
 	}
 
-	// 反序列化 RegistrationRecord
-	regRecord, err := s.opaque.GetServer().Deserialize.RegistrationRecord(recordBytes)
+	server, err := s.opaque.GetServerFor(keyVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 调用 GenerateKE2 得到 KE2，span 名称与假记录一致，避免通过追踪数据区分用户是否存在
+	_, keSpan := tracing.Start(ctx, "opaque.GenerateKE2")
+	ke2, output, err := server.GenerateKE2(ke1, clientRecord)
+	keSpan.End()
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to deserialize registration record: %w", err)
+		return nil, nil, fmt.Errorf("server login init failed: %w", err)
 	}
+	log.Debug().Any("ke1", base64.StdEncoding.EncodeToString(ke1.Serialize())).Any("ke2", base64.StdEncoding.EncodeToString(ke2.Serialize())).Msg("KE1 and KE2 generated")
 
-	credId := s.credentialIdentifierFromUsername(username)
+	return ke2.Serialize(), &dao.LoginState{
+		Username:      username,
+		UID:           uid,
+		ClientMAC:     output.ClientMAC,
+		SessionSecret: output.SessionSecret,
+		KeyVersion:    keyVersion,
+		ExpireAt:      time.Now().Add(loginSessionExpireSeconds * time.Second).UnixMilli(),
+	}, nil
+}
 
-	// 构造 ClientRecord
-	clientRecord := &opaque.ClientRecord{
-		CredentialIdentifier: credId,
-		ClientIdentity:       credId,
-		RegistrationRecord:   regRecord,
+// saveLoginState 生成登录会话ID并保存登录状态
+func (s *AuthService) saveLoginState(ctx context.Context, state *dao.LoginState) (string, error) {
+	for attempt := 0; attempt < maxTokenRetries; attempt++ {
+		id := s.opaque.GenerateToken(loginSessionIDLength)
+		ok, err := s.loginSessionDao.Save(ctx, id, state, loginSessionExpireSeconds*time.Second)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return id, nil
+		}
 	}
+	return "", fmt.Errorf("failed to generate unique login session id")
+}
 
-	// 4. 调用 LoginInit 得到 KE2
-	ke2, output, err := s.opaque.GetServer().GenerateKE2(ke1, clientRecord)
+// TakeLoginSession 取出登录会话状态，登录会话只能使用一次，不存在或已过期时返回 ErrLoginSessionExpired
+func (s *AuthService) TakeLoginSession(ctx context.Context, loginSessionID string) (*dao.LoginState, error) {
+	state, err := s.loginSessionDao.Take(ctx, loginSessionID)
+	if errors.Is(err, dao.ErrLoginSessionNotFound) {
+		return nil, ErrLoginSessionExpired
+	}
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("server login init failed: %w", err)
+		return nil, fmt.Errorf("failed to get login session: %w", err)
 	}
-	log.Debug().Any("ke1", base64.StdEncoding.EncodeToString(ke1.Serialize())).Any("ke2", base64.StdEncoding.EncodeToString(ke2.Serialize())).Msg("KE1 and KE2 generated")
-	return ke2.Serialize(), output.SessionSecret, output.ClientMAC, nil
+	return state, nil
+}
+
+// LoginResult 登录结果：MFASessionID 不为空时需要两步验证，此时没有令牌
+// RekeyTicket 不为空时注册记录使用的不是当前密钥集，客户端凭它以同一密码重新注册（见 PasswordService.ChangeInit）
+type LoginResult struct {
+	UID          int64
+	AccessToken  string
+	RefreshToken string
+	Expire       int64 // 访问令牌有效期（秒）
+	MFASessionID string
+	RekeyTicket  string
 }
 
-// 构造fake record
-func (s *AuthService) fakeLoginInit(username string, ke1 *message.KE1) ([]byte, []byte, []byte, error) {
-	record, err := s.opaque.conf.GetFakeRecord(s.credentialIdentifierFromUsername(username))
+// LoginFinalize 处理登录第二步：用登录会话中保存的 ClientMAC 校验 KE3，创建会话并返回 token + uid
+// 账号启用了两步验证时不签发令牌，返回两步验证会话ID
+func (s *AuthService) LoginFinalize(ctx context.Context, state *dao.LoginState, ke3Bytes []byte) (_ *LoginResult, err error) {
+	ctx, span := tracing.Start(ctx, "auth.LoginFinalize")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	if err := s.verifyKE3(ctx, state, ke3Bytes); err != nil {
+		return nil, err
+	}
+
+	// 认证通过
+	uid := state.UID
+	span.SetAttributes(attribute.Int64("user.id", uid))
+
+	// 检查账号状态，处罚中的账号不能登录
+	if err := s.CheckAccountStatus(ctx, uid); err != nil {
+		return nil, err
+	}
+
+	// 启用两步验证的账号需要再提交验证码
+	mfa, err := s.totpDao.Enabled(ctx, uid)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to get fake record: %w", err)
+		return nil, fmt.Errorf("failed to get two-factor status: %w", err)
+	}
+	// 以数据库为准修正网关读取的两步验证标记（IMDB 可能被清空）
+	if err := s.totpDao.SyncFlag(ctx, uid, mfa); err != nil {
+		log.Warn().Err(err).Int64("uid", uid).Msg("failed to sync two-factor flag")
+	}
+	rekey := state.KeyVersion != s.opaque.ActiveVersion()
+	if mfa {
+		id, err := s.saveMFAState(ctx, &dao.MFAState{
+			Username: state.Username,
+			UID:      uid,
+			Rekey:    rekey,
+			ExpireAt: time.Now().Add(mfaSessionExpireSeconds * time.Second).UnixMilli(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to save mfa session: %w", err)
+		}
+		return &LoginResult{UID: uid, MFASessionID: id}, nil
 	}
-	ke2, output, err := s.opaque.GetServer().GenerateKE2(ke1, record)
-	return ke2.Serialize(), output.SessionSecret, output.ClientMAC, err
+	return s.completeLogin(ctx, uid, rekey)
 }
 
-// LoginFinalize 处理登录第二步：接收 KE3，校验 MAC，创建会话并返回 token + uid
-func (s *AuthService) LoginFinalize(ctx context.Context, username string, ke3Bytes []byte, mac []byte) (int64, string, string, int64, error) {
+// verifyKE3 用登录状态中的 ClientMAC 校验 KE3，密码错误或用户不存在时返回 ErrInvalidCredentials
+func (s *AuthService) verifyKE3(ctx context.Context, state *dao.LoginState, ke3Bytes []byte) error {
 	// 反序列化 KE3
 	ke3, err := s.opaque.GetServer().Deserialize.KE3(ke3Bytes)
 	if err != nil {
-		return -1, "", "", -1, fmt.Errorf("failed to deserialize KE3: %w", err)
+		return fmt.Errorf("%w: failed to deserialize KE3: %v", ErrInvalidCredentials, err)
 	}
 
 	// 调用 LoginFinish 校验 MAC
-	if err := s.opaque.GetServer().LoginFinish(ke3, mac); err != nil {
-		return -1, "", "", -1, fmt.Errorf("login finish failed (invalid MAC): %w", err)
+	_, finSpan := tracing.Start(ctx, "opaque.LoginFinish")
+	err = s.opaque.GetServer().LoginFinish(ke3, state.ClientMAC)
+	finSpan.End()
+	if err != nil {
+		return fmt.Errorf("%w: login finish failed (invalid MAC): %v", ErrInvalidCredentials, err)
 	}
+	// 假记录不可能通过校验，防御性检查
+	if state.UID == 0 {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
 
-	// 认证通过，获取用户 ID
-	uid, _, err := s.userDao.GetUserRecord(ctx, username)
-	if err != nil {
-		return -1, "", "", -1, fmt.Errorf("failed to get user id: %w", err)
+// saveMFAState 生成两步验证会话ID并保存状态
+func (s *AuthService) saveMFAState(ctx context.Context, state *dao.MFAState) (string, error) {
+	for attempt := 0; attempt < maxTokenRetries; attempt++ {
+		id := s.opaque.GenerateToken(loginSessionIDLength)
+		ok, err := s.loginSessionDao.SaveMFA(ctx, id, state, false)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return id, nil
+		}
 	}
+	return "", fmt.Errorf("failed to generate unique mfa session id")
+}
 
+// completeLogin 认证完成，签发令牌并更新最后登录时间
+// rekey 为 true 时额外签发只能由本次登录的令牌族使用一次的密钥迁移凭据
+func (s *AuthService) completeLogin(ctx context.Context, uid int64, rekey bool) (*LoginResult, error) {
 	// 生成会话 token 并写入内存数据库
-	accessToken, refreshToken, err := s.generateAndSaveToken(ctx, uid)
+	family, accessToken, refreshToken, err := s.generateAndSaveToken(ctx, uid)
 	if err != nil {
-		return -1, "", "", -1, fmt.Errorf("failed to generate session token: %w", err)
+		return nil, fmt.Errorf("failed to generate session token: %w", err)
 	}
 
 	// 更新最后登录时间
 	_ = s.userDao.UpdateLastLogin(ctx, uid)
 
-	return uid, accessToken, refreshToken, accessTokenExpireSeconds, nil
+	result := &LoginResult{
+		UID:          uid,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		Expire:       accessTokenExpireSeconds,
+	}
+	if rekey {
+		// 签发失败不影响登录，下次登录时再迁移
+		if result.RekeyTicket, err = s.issueRekeyTicket(ctx, uid, family); err != nil {
+			log.Error().Err(err).Int64("uid", uid).Msg("failed to issue rekey ticket")
+		}
+	}
+	return result, nil
+}
+
+// issueRekeyTicket 签发密钥迁移凭据，刚完成的登录已证明密码（与两步验证码），可直接用于 change-init
+func (s *AuthService) issueRekeyTicket(ctx context.Context, uid int64, family string) (string, error) {
+	ticket := &dao.ReauthTicket{
+		UID:      uid,
+		Family:   family,
+		ExpireAt: time.Now().Add(reauthTicketExpireSeconds * time.Second).UnixMilli(),
+	}
+	for attempt := 0; attempt < maxTokenRetries; attempt++ {
+		id := s.opaque.GenerateToken(reauthTicketLength)
+		ok, err := s.loginSessionDao.SaveRekeyTicket(ctx, id, ticket, reauthTicketExpireSeconds*time.Second)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("failed to generate unique rekey ticket")
 }
 
-// 刷新token
-func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (int64, string, string, int64, error) {
-	if res, err := s.sessionDao.HasRefreshToken(ctx, refreshToken); err != nil || !res {
-		return -1, "", "", -1, fmt.Errorf("refresh token not found")
+// RefreshToken 用刷新令牌换取新的访问令牌与刷新令牌（轮换）
+// 已轮换过的刷新令牌再次出现说明令牌可能泄露，吊销整个令牌族，此时返回令牌所属的 uid 与 ErrRefreshTokenReused
+func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (_ int64, _ string, _ string, _ int64, err error) {
+	ctx, span := tracing.Start(ctx, "auth.RefreshToken")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	rec, err := s.sessionDao.GetRefreshRecord(ctx, refreshToken)
+	if errors.Is(err, dao.ErrTokenNotFound) {
+		return -1, "", "", -1, ErrInvalidToken
 	}
-	uid, err := s.sessionDao.GetUidByRefreshToken(ctx, refreshToken)
 	if err != nil {
-		return -1, "", "", -1, fmt.Errorf("failed to get uid by refresh token: %w", err)
+		return -1, "", "", -1, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	span.SetAttributes(attribute.Int64("user.id", rec.UID))
+
+	// 处罚中的账号不能刷新，吊销令牌族
+	if err := s.CheckAccountStatus(ctx, rec.UID); err != nil {
+		if errors.Is(err, ErrAccountDisabled) {
+			if err := s.revokeFamily(ctx, rec.Family); err != nil {
+				log.Error().Err(err).Int64("uid", rec.UID).Msg("failed to revoke token family")
+			}
+		}
+		return rec.UID, "", "", -1, err
 	}
-	newAccessToken, newRefreshToken, err := s.generateAndSaveToken(ctx, uid)
+
+	accessToken, newRefreshToken, err := s.generateTokenPair(ctx, rec.UID, rec.Family)
 	if err != nil {
 		return -1, "", "", -1, fmt.Errorf("failed to generate new tokens: %w", err)
 	}
-	s.sessionDao.DelRefreshToken(ctx, refreshToken)
-	return uid, newAccessToken, newRefreshToken, accessTokenExpireSeconds, nil
+	prev, err := s.sessionDao.RotateFamily(ctx, rec.Family, refreshToken, dao.TokenFamily{
+		Access:  accessToken,
+		Refresh: newRefreshToken,
+	}, s.tokenTTL())
+	switch {
+	case errors.Is(err, dao.ErrTokenReused):
+		log.Warn().Int64("uid", rec.UID).Msg("refresh token reused, revoking token family")
+		if err := s.revokeFamily(ctx, rec.Family); err != nil {
+			log.Error().Err(err).Int64("uid", rec.UID).Msg("failed to revoke token family")
+		}
+		return rec.UID, "", "", -1, ErrRefreshTokenReused
+	case errors.Is(err, dao.ErrTokenNotFound):
+		return -1, "", "", -1, ErrInvalidToken
+	case err != nil:
+		return -1, "", "", -1, fmt.Errorf("failed to rotate tokens: %w", err)
+	}
+	// 轮换前的签名访问令牌在过期前仍能通过验签，需要加入吊销列表
+	s.revokeAccessToken(ctx, prev.Access)
+	return rec.UID, accessToken, newRefreshToken, accessTokenExpireSeconds, nil
+}
+
+// Logout 吊销访问令牌所属的令牌族（当前会话）
+func (s *AuthService) Logout(ctx context.Context, accessToken string) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.Logout")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	family, err := s.sessionDao.GetFamilyByAccessToken(ctx, accessToken)
+	if errors.Is(err, dao.ErrTokenNotFound) {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get token family: %w", err)
+	}
+	return s.revokeFamily(ctx, family)
+}
+
+// ResolveAccessToken 返回访问令牌所属的用户与令牌族
+func (s *AuthService) ResolveAccessToken(ctx context.Context, accessToken string) (int64, string, error) {
+	family, err := s.sessionDao.GetFamilyByAccessToken(ctx, accessToken)
+	if errors.Is(err, dao.ErrTokenNotFound) {
+		return 0, "", ErrInvalidToken
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get token family: %w", err)
+	}
+	uid, err := s.sessionDao.GetUidByAccessToken(ctx, accessToken)
+	if errors.Is(err, redis.Nil) {
+		return 0, "", ErrInvalidToken
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get uid by access token: %w", err)
+	}
+	return uid, family, nil
+}
+
+// RevokeOtherSessions 吊销用户除 keepFamily 以外的令牌族，并断开使用这些令牌的游戏会话
+func (s *AuthService) RevokeOtherSessions(ctx context.Context, uid int64, keepFamily string) (int, error) {
+	families, err := s.sessionDao.ListFamilies(ctx, uid)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list token families: %w", err)
+	}
+	revoked := 0
+	for _, family := range families {
+		if family == keepFamily {
+			continue
+		}
+		fam, err := s.sessionDao.RevokeFamily(ctx, family)
+		if errors.Is(err, dao.ErrTokenNotFound) {
+			continue
+		}
+		if err != nil {
+			return revoked, fmt.Errorf("failed to revoke token family: %w", err)
+		}
+		revoked++
+		s.kickSessions(ctx, dao.SessionKickEvent{
+			UID:           uid,
+			Family:        family,
+			TokenHash:     HashToken(fam.Access),
+			RevokedTokens: s.revokeAccessToken(ctx, fam.Access),
+			Reason:        kickReasonTokenRevoked,
+		})
+	}
+	return revoked, nil
+}
+
+// LogoutAll 吊销用户的所有令牌族并断开其所有游戏会话，返回吊销的令牌族数量
+func (s *AuthService) LogoutAll(ctx context.Context, accessToken string) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "auth.LogoutAll")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	uid, err := s.sessionDao.GetUidByAccessToken(ctx, accessToken)
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get uid by access token: %w", err)
+	}
+	span.SetAttributes(attribute.Int64("user.id", uid))
+
+	return s.RevokeUserSessions(ctx, dao.SessionKickEvent{UID: uid, Reason: kickReasonTokenRevoked})
+}
+
+// RevokeUserSessions 吊销用户的所有令牌族，并按 ev 通知网关断开其所有游戏会话，返回吊销的令牌族数量
+func (s *AuthService) RevokeUserSessions(ctx context.Context, ev dao.SessionKickEvent) (int, error) {
+	families, err := s.sessionDao.ListFamilies(ctx, ev.UID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list token families: %w", err)
+	}
+	revoked := 0
+	for _, family := range families {
+		fam, err := s.sessionDao.RevokeFamily(ctx, family)
+		if errors.Is(err, dao.ErrTokenNotFound) {
+			continue
+		}
+		if err != nil {
+			return revoked, fmt.Errorf("failed to revoke token family: %w", err)
+		}
+		revoked++
+		ev.RevokedTokens = append(ev.RevokedTokens, s.revokeAccessToken(ctx, fam.Access)...)
+	}
+	s.kickSessions(ctx, ev)
+	return revoked, nil
+}
+
+// KeySetUsage 返回各 OPAQUE 密钥集版本的用户数，包括已停用但仍有用户的版本
+func (s *AuthService) KeySetUsage(ctx context.Context) (*model.KeySetUsageResponse, error) {
+	counts, err := s.userDao.CountByKeyVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count users by key version: %w", err)
+	}
+	versions := s.opaque.Versions()
+	for v := range counts {
+		if !s.opaque.HasVersion(v) {
+			versions = append(versions, v)
+		}
+	}
+	slices.Sort(versions)
+	resp := &model.KeySetUsageResponse{Active: s.opaque.ActiveVersion(), KeySets: make([]model.KeySetUsage, 0, len(versions))}
+	for _, v := range versions {
+		resp.KeySets = append(resp.KeySets, model.KeySetUsage{
+			Version: v,
+			Active:  v == resp.Active,
+			Loaded:  s.opaque.HasVersion(v),
+			Users:   counts[v],
+		})
+	}
+	return resp, nil
+}
+
+// TokenKeys 返回签名访问令牌的验签公钥
+func (s *AuthService) TokenKeys() []model.TokenKey {
+	return s.signer.Keys()
 }
 
-func (s *AuthService) generateAndSaveToken(ctx context.Context, uid int64) (string, string, error) {
+// CheckAccountStatus 账号不是 ACTIVE 时返回 *AccountStatusError
+func (s *AuthService) CheckAccountStatus(ctx context.Context, uid int64) error {
+	status, sanction, err := s.sanctionDao.AccountStatus(ctx, uid)
+	if errors.Is(err, dao.ErrUserNotFound) {
+		return &AccountStatusError{Status: model.StatusArchived}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get account status: %w", err)
+	}
+	if status == model.StatusActive {
+		return nil
+	}
+	e := &AccountStatusError{Status: status}
+	if sanction != nil {
+		e.Reason, e.ExpiresAt = sanction.Reason, sanction.ExpiresAt
+	}
+	return e
+}
+
+// revokeFamily 吊销令牌族，并通知网关断开该令牌族的会话
+func (s *AuthService) revokeFamily(ctx context.Context, family string) error {
+	fam, err := s.sessionDao.RevokeFamily(ctx, family)
+	if errors.Is(err, dao.ErrTokenNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.kickSessions(ctx, dao.SessionKickEvent{
+		UID:           fam.UID,
+		Family:        family,
+		TokenHash:     HashToken(fam.Access),
+		RevokedTokens: s.revokeAccessToken(ctx, fam.Access),
+		Reason:        kickReasonTokenRevoked,
+	})
+	return nil
+}
+
+// revokeAccessToken 签名访问令牌在过期前仍能通过网关的本地校验，吊销时记录到吊销列表
+// 返回需要网关立即吊销的令牌哈希，随机令牌删除后即失效，返回 nil
+func (s *AuthService) revokeAccessToken(ctx context.Context, accessToken string) []string {
+	if s.signer == nil {
+		return nil
+	}
+	claims, err := s.signer.Parse(accessToken)
+	if err != nil {
+		return nil
+	}
+	expireAt := time.Unix(claims.ExpiresAt, 0)
+	if !expireAt.After(time.Now()) {
+		return nil
+	}
+	hash := HashToken(accessToken)
+	if err := s.sessionDao.AddRevocation(ctx, hash, expireAt); err != nil {
+		log.Error().Err(err).Int64("uid", claims.UID).Msg("failed to record token revocation")
+	}
+	return []string{hash}
+}
+
+// kickSessions 通知网关断开会话，消息队列不可用时会话在访问令牌过期前保持连接
+func (s *AuthService) kickSessions(ctx context.Context, ev dao.SessionKickEvent) {
+	if s.events == nil {
+		return
+	}
+	if err := s.events.PublishSessionKick(ctx, ev); err != nil {
+		log.Error().Err(err).Int64("uid", ev.UID).Msg("publish session.kick failed")
+	}
+}
+
+// HashToken 令牌的 SHA-256 十六进制，用于在事件中标识令牌而不暴露令牌本身
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *AuthService) tokenTTL() dao.TokenTTL {
+	return dao.TokenTTL{
+		Access:  accessTokenExpireSeconds * time.Second,
+		Refresh: refreshTokenExpireSeconds * time.Second,
+	}
+}
+
+// generateTokenPair 为令牌族生成未被占用的访问令牌与刷新令牌
+func (s *AuthService) generateTokenPair(ctx context.Context, uid int64, family string) (string, string, error) {
 	var accessToken, refreshToken string
 	var accessOK = false
 	var refreshOK = false
 	for attempt := 0; attempt < maxTokenRetries; attempt++ {
-		accessToken = s.opaque.GenerateToken(sessionTokenLength)
+		var err error
+		if accessToken, err = s.newAccessToken(ctx, uid, family); err != nil {
+			return "", "", err
+		}
 		if res, err := s.sessionDao.HasAccessToken(ctx, accessToken); err == nil && !res {
 			accessOK = true
 			break
@@ -202,21 +792,48 @@ func (s *AuthService) generateAndSaveToken(ctx context.Context, uid int64) (stri
 		}
 	}
 
-	if accessOK && refreshOK {
-		err := s.sessionDao.SaveAccessToken(ctx, accessToken, uid, accessTokenExpireSeconds)
-		if err != nil {
-			log.Err(err).Msg("failed to save access token")
-			return "", "", err
-		}
-		err = s.sessionDao.SaveRefreshToken(ctx, refreshToken, uid, refreshTokenExpireSeconds)
-		if err != nil {
-			s.sessionDao.DelAccessToken(ctx, accessToken)
-			log.Err(err).Msg("failed to save refresh token")
-			return "", "", err
-		}
-		return refreshToken, accessToken, nil
-	} else {
+	if !accessOK || !refreshOK {
 		log.Warn().Msg("failed to generate unique tokens")
 		return "", "", fmt.Errorf("failed to generate unique tokens")
 	}
+	return accessToken, refreshToken, nil
+}
+
+// newAccessToken 生成访问令牌：签发签名令牌时载荷包含令牌族ID，否则为随机字符串
+// 签名令牌同样写入 IMDB，用户服务器的接口不区分令牌格式
+func (s *AuthService) newAccessToken(ctx context.Context, uid int64, family string) (string, error) {
+	if !s.signer.Issuing() {
+		return s.opaque.GenerateToken(sessionTokenLength), nil
+	}
+	mfa, err := s.totpDao.Enabled(ctx, uid)
+	if err != nil {
+		return "", fmt.Errorf("failed to get two-factor status: %w", err)
+	}
+	claims := newTokenClaims(uid, family, s.opaque.GenerateToken(tokenIDLength), mfa, accessTokenExpireSeconds*time.Second)
+	token, err := s.signer.Sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign access token: %w", err)
+	}
+	return token, nil
+}
+
+// generateAndSaveToken 生成令牌并创建新的令牌族，返回令牌族ID、访问令牌与刷新令牌
+func (s *AuthService) generateAndSaveToken(ctx context.Context, uid int64) (string, string, string, error) {
+	ctx, span := tracing.Start(ctx, "auth.generateTokens", trace.WithAttributes(attribute.Int64("user.id", uid)))
+	defer span.End()
+
+	family := s.opaque.GenerateToken(tokenFamilyIDLength)
+	accessToken, refreshToken, err := s.generateTokenPair(ctx, uid, family)
+	if err != nil {
+		return "", "", "", err
+	}
+	if err := s.sessionDao.CreateFamily(ctx, family, dao.TokenFamily{
+		UID:     uid,
+		Access:  accessToken,
+		Refresh: refreshToken,
+	}, s.tokenTTL()); err != nil {
+		log.Err(err).Msg("failed to save tokens")
+		return "", "", "", err
+	}
+	return family, accessToken, refreshToken, nil
 }
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/user/internal/dao"
+	"github.com/zrurf/quiver/server/user/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrRateLimited   = errors.New("too many login attempts")
+	ErrAccountLocked = errors.New("account temporarily locked")
+)
+
+// LimitError 登录被限制，RetryAfter 为建议的重试等待时间
+type LimitError struct {
+	Err        error // ErrRateLimited 或 ErrAccountLocked
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v, retry after %v", e.Err, e.RetryAfter)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// LoginLimitConfig 登录限流配置
+type LoginLimitConfig struct {
+	UserLimit       int // 每个用户名在 UserWindow 内允许的登录请求数
+	UserWindow      time.Duration
+	IPLimit         int // 每个 IP 在 IPWindow 内允许的登录请求数
+	IPWindow        time.Duration
+	BackoffAfter    int           // 连续失败达到该次数后开始指数退避
+	BackoffBase     time.Duration // 首次退避时间，此后每次失败翻倍
+	BackoffMax      time.Duration
+	LockoutAfter    int // 连续失败达到该次数后锁定
+	LockoutDuration time.Duration
+	FailureWindow   time.Duration // 失败次数在最后一次失败后保留的时间
+}
+
+// LoginGuard 登录暴力破解与撞库防护
+// 限制只以请求中的用户名为键，不查询用户是否存在，不存在的用户名受到相同的限制，无法据此枚举用户
+// IMDB 不可用时放行请求，避免登录整体不可用
+type LoginGuard struct {
+	limiter *dao.LimiterRepository
+	conf    LoginLimitConfig
+}
+
+func NewLoginGuard(limiter *dao.LimiterRepository, conf LoginLimitConfig) *LoginGuard {
+	return &LoginGuard{
+		limiter: limiter,
+		conf:    conf,
+	}
+}
+
+// CheckLoginInit 登录第一步前调用：检查锁定与退避，并计入用户名与 IP 的滑动窗口
+func (g *LoginGuard) CheckLoginInit(ctx context.Context, username, ip string) (err error) {
+	ctx, span := tracing.Start(ctx, "guard.CheckLoginInit")
+	defer func() {
+		span.SetAttributes(attribute.Bool("guard.limited", err != nil))
+		span.End()
+	}()
+
+	if err := g.checkBlocked(ctx, username); err != nil {
+		return err
+	}
+	if err := g.hit(ctx, "login:ip:"+ip, g.conf.IPLimit, g.conf.IPWindow); err != nil {
+		return err
+	}
+	return g.hit(ctx, "login:user:"+username, g.conf.UserLimit, g.conf.UserWindow)
+}
+
+// CheckLoginFinalize 登录第二步前调用：两步之间被锁定的用户名不能完成登录
+func (g *LoginGuard) CheckLoginFinalize(ctx context.Context, username string) error {
+	return g.checkBlocked(ctx, username)
+}
+
+// RecordFailure 记录一次凭据校验失败，按失败次数设置退避或锁定
+func (g *LoginGuard) RecordFailure(ctx context.Context, username string) {
+	ctx = context.WithoutCancel(ctx)
+	n, err := g.limiter.AddLoginFailure(ctx, username, g.conf.FailureWindow)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to record login failure")
+		return
+	}
+	switch {
+	case g.conf.LockoutAfter > 0 && n >= int64(g.conf.LockoutAfter):
+		log.Warn().Str("username", username).Int64("failures", n).Dur("duration", g.conf.LockoutDuration).Msg("login locked")
+		err = g.limiter.LockLogin(ctx, username, g.conf.LockoutDuration)
+	case g.conf.BackoffAfter > 0 && n >= int64(g.conf.BackoffAfter):
+		err = g.limiter.SetLoginBackoff(ctx, username, g.backoff(n))
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("failed to apply login backoff")
+	}
+}
+
+// RecordSuccess 登录成功或找回账号后清除失败次数与锁定
+func (g *LoginGuard) RecordSuccess(ctx context.Context, username string) {
+	if err := g.limiter.ClearLoginFailures(context.WithoutCancel(ctx), username); err != nil {
+		log.Error().Err(err).Msg("failed to clear login failures")
+	}
+}
+
+// backoff 第 n 次连续失败后的退避时间：BackoffBase * 2^(n-BackoffAfter)，不超过 BackoffMax
+func (g *LoginGuard) backoff(n int64) time.Duration {
+	d := g.conf.BackoffBase
+	for i := int64(g.conf.BackoffAfter); i < n && d < g.conf.BackoffMax; i++ {
+		d *= 2
+	}
+	return min(d, g.conf.BackoffMax)
+}
+
+func (g *LoginGuard) checkBlocked(ctx context.Context, username string) error {
+	lock, backoff, err := g.limiter.LoginBlocked(ctx, username)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to check login lock")
+		return nil
+	}
+	if lock > 0 {
+		return &LimitError{Err: ErrAccountLocked, RetryAfter: lock}
+	}
+	if backoff > 0 {
+		return &LimitError{Err: ErrRateLimited, RetryAfter: backoff}
+	}
+	return nil
+}
+
+func (g *LoginGuard) hit(ctx context.Context, key string, limit int, window time.Duration) error {
+	if limit <= 0 {
+		return nil
+	}
+	count, oldest, err := g.limiter.Hit(ctx, key, window)
+	if err != nil {
+		log.Error().Err(err).Str("key", key).Msg("failed to update rate limit")
+		return nil
+	}
+	if count > int64(limit) {
+		return &LimitError{Err: ErrRateLimited, RetryAfter: max(time.Until(oldest.Add(window)), time.Second)}
+	}
+	return nil
+}
@@ -3,42 +3,81 @@ package services
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/bytemare/ecc"
 	"github.com/bytemare/opaque"
 )
 
+var ErrKeySetUnavailable = errors.New("opaque key set not loaded")
+
+// OpaqueService 持有一个或多个 OPAQUE 密钥集（OPRF 种子与 AKE 密钥对）
+// 用户的注册记录绑定注册时的密钥集版本，轮换密钥后旧版本继续用于登录，新注册与修改密码使用当前版本
 type OpaqueService struct {
-	conf         *opaque.Configuration
+	conf    *opaque.Configuration
+	keySets map[int]*opaqueKeySet
+	active  int
+}
+
+type opaqueKeySet struct {
 	server       *opaque.Server
 	serverPubKey []byte // AKE public key
-	oprfSeed     []byte
 }
 
-type OpaqueConfig struct {
-	Config          *opaque.Configuration
+// OpaqueKeySet 一个版本的密钥材料
+type OpaqueKeySet struct {
+	Version         int
 	OprfSeed        []byte
 	ServerPublicKey []byte
 	ServerSecretKey []byte
 }
 
+type OpaqueConfig struct {
+	Config        *opaque.Configuration
+	KeySets       []OpaqueKeySet
+	ActiveVersion int // 新注册使用的密钥集版本
+}
+
 // NewOpaqueService 创建并初始化 OpaqueService。
 func NewOpaqueService(config *OpaqueConfig) (*OpaqueService, error) {
-	server, err := opaque.NewServer(config.Config)
+	s := &OpaqueService{
+		conf:    config.Config,
+		keySets: make(map[int]*opaqueKeySet, len(config.KeySets)),
+		active:  config.ActiveVersion,
+	}
+	for _, ks := range config.KeySets {
+		if _, ok := s.keySets[ks.Version]; ok {
+			return nil, fmt.Errorf("duplicate OPAQUE key set version %d", ks.Version)
+		}
+		loaded, err := newOpaqueKeySet(config.Config, ks)
+		if err != nil {
+			return nil, fmt.Errorf("key set %d: %w", ks.Version, err)
+		}
+		s.keySets[ks.Version] = loaded
+	}
+	if _, ok := s.keySets[s.active]; !ok {
+		return nil, fmt.Errorf("active OPAQUE key set %d not loaded", s.active)
+	}
+	return s, nil
+}
+
+func newOpaqueKeySet(conf *opaque.Configuration, ks OpaqueKeySet) (*opaqueKeySet, error) {
+	server, err := opaque.NewServer(conf)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create OPAQUE server: %w", err)
 	}
 
-	privateKey, err := opaque.DeserializeScalar(ecc.Ristretto255Sha512, config.ServerSecretKey)
+	privateKey, err := opaque.DeserializeScalar(ecc.Ristretto255Sha512, ks.ServerSecretKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to deserialize server secret key: %w", err)
 	}
 
 	err = server.SetKeyMaterial(&opaque.ServerKeyMaterial{
 		PrivateKey:     privateKey,
-		PublicKeyBytes: config.ServerPublicKey,
-		OPRFGlobalSeed: config.OprfSeed,
+		PublicKeyBytes: ks.ServerPublicKey,
+		OPRFGlobalSeed: ks.OprfSeed,
 		Identity:       []byte("quiver"),
 	})
 
@@ -46,22 +85,49 @@ func NewOpaqueService(config *OpaqueConfig) (*OpaqueService, error) {
 		return nil, fmt.Errorf("failed to set OPAQUE key material: %w", err)
 	}
 
-	return &OpaqueService{
-		conf:         config.Config,
+	return &opaqueKeySet{
 		server:       server,
-		serverPubKey: config.ServerPublicKey,
-		oprfSeed:     config.OprfSeed,
+		serverPubKey: ks.ServerPublicKey,
 	}, nil
 }
 
-// GetServerPublicKey 返回服务器 AKE 公钥（发往客户端，用于注册与登录）。
-func (s *OpaqueService) GetServerPublicKey() []byte {
-	return s.serverPubKey
+// ActiveVersion 返回当前密钥集版本（新注册、修改密码与找回账号使用）。
+func (s *OpaqueService) ActiveVersion() int {
+	return s.active
+}
+
+// Versions 返回已加载的密钥集版本，升序。
+func (s *OpaqueService) Versions() []int {
+	versions := make([]int, 0, len(s.keySets))
+	for v := range s.keySets {
+		versions = append(versions, v)
+	}
+	slices.Sort(versions)
+	return versions
+}
+
+// HasVersion 密钥集版本是否已加载。
+func (s *OpaqueService) HasVersion(version int) bool {
+	_, ok := s.keySets[version]
+	return ok
 }
 
-// GetOPRFSeed 返回 OPRF 种子（供 Register/Login 流程中按用户名/credentialIdentifier 派生 OPRF key）。
-func (s *OpaqueService) GetOPRFSeed() []byte {
-	return s.oprfSeed
+// GetServerPublicKey 返回指定版本的服务器 AKE 公钥（发往客户端，用于注册与登录）。
+func (s *OpaqueService) GetServerPublicKey(version int) ([]byte, error) {
+	ks, ok := s.keySets[version]
+	if !ok {
+		return nil, ErrKeySetUnavailable
+	}
+	return ks.serverPubKey, nil
+}
+
+// GetServerFor 返回指定版本的 opaque.Server，用户的注册与登录必须使用记录所绑定的版本。
+func (s *OpaqueService) GetServerFor(version int) (*opaque.Server, error) {
+	ks, ok := s.keySets[version]
+	if !ok {
+		return nil, ErrKeySetUnavailable
+	}
+	return ks.server, nil
 }
 
 // GetConfig 返回配置对象，方便构造反序列化器（如需要自行解析客户端消息）。
@@ -69,9 +135,9 @@ func (s *OpaqueService) GetConfig() *opaque.Configuration {
 	return s.conf
 }
 
-// GetServer 返回底层的 opaque.Server，供 AuthOpaqueService 调用 RegisterResponse / LoginInit / LoginFinish。
+// GetServer 返回当前版本的 opaque.Server，用于反序列化客户端消息与 LoginFinish（与密钥无关）。
 func (s *OpaqueService) GetServer() *opaque.Server {
-	return s.server
+	return s.keySets[s.active].server
 }
 
 // GenerateToken 生成指定长度随机token
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/user/internal/dao"
+	"github.com/zrurf/quiver/server/user/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	recoveryCodeCount            = 10  // 每次生成的恢复码数量
+	recoveryCodeBytes            = 10  // 恢复码熵（80 bit，16 个 base32 字符）
+	recoverySessionExpireSeconds = 300 // 恢复会话（recover-init 到 recover-finalize）有效期
+	passwordChangeExpireSeconds  = 300 // 修改密码会话（change-init 到 change-finalize）有效期
+)
+
+var (
+	ErrInvalidRecoveryCode   = errors.New("invalid recovery code")
+	ErrRekeyNotRequired      = errors.New("opaque record already uses the active key set")
+	ErrPasswordChangeExpired = errors.New("password change session not found or expired")
+)
+
+var codeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes 生成恢复码（XXXX-XXXX-XXXX-XXXX）与其哈希，数据库只保存哈希
+func generateRecoveryCodes() ([]string, [][]byte, error) {
+	return generateOneTimeCodes(recoveryCodeCount, recoveryCodeBytes)
+}
+
+// generateOneTimeCodes 生成 count 个 nbytes 熵的一次性码（base32，每 4 个字符以 - 分隔）与其哈希
+func generateOneTimeCodes(count, nbytes int) ([]string, [][]byte, error) {
+	codes := make([]string, count)
+	hashes := make([][]byte, count)
+	buf := make([]byte, nbytes)
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := codeEncoding.EncodeToString(buf)
+		var b strings.Builder
+		for j := 0; j < len(raw); j += 4 {
+			if j > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteString(raw[j:min(j+4, len(raw))])
+		}
+		codes[i] = b.String()
+		hashes[i] = hashOneTimeCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashOneTimeCode 忽略大小写、空白与分隔符后计算 SHA-256，一次性码熵足够高，无需慢哈希
+func hashOneTimeCode(code string) []byte {
+	sum := sha256.Sum256([]byte(normalizeCode(code)))
+	return sum[:]
+}
+
+// normalizeCode 去掉空白与分隔符并转为大写
+func normalizeCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
+
+// PasswordService 修改密码与凭恢复码找回账号，两者都是一次新的 OPAQUE 注册
+type PasswordService struct {
+	userDao         *dao.UserRepository
+	recoveryDao     *dao.RecoveryCodeRepository
+	loginSessionDao *dao.LoginSessionRepository
+	opaque          *OpaqueService
+	auth            *AuthService
+	reauth          *ReauthService
+}
+
+func NewPasswordService(
+	userDao *dao.UserRepository,
+	recoveryDao *dao.RecoveryCodeRepository,
+	loginSessionDao *dao.LoginSessionRepository,
+	opaque *OpaqueService,
+	auth *AuthService,
+	reauth *ReauthService,
+) *PasswordService {
+	return &PasswordService{
+		userDao:         userDao,
+		recoveryDao:     recoveryDao,
+		loginSessionDao: loginSessionDao,
+		opaque:          opaque,
+		auth:            auth,
+		reauth:          reauth,
+	}
+}
+
+// ChangeInit 修改密码第一步：消耗重新验证凭据，为访问令牌所属用户生成 RegistrationResponse
+// 返回响应、服务器公钥与修改密码会话ID，密钥集版本保存在会话中
+// rekeyTicket 不为空时改为消耗登录签发的密钥迁移凭据（LoginResult.RekeyTicket），会话标记为密钥迁移
+func (s *PasswordService) ChangeInit(ctx context.Context, accessToken, reauthTicket, rekeyTicket string, registrationRequest []byte) (_ []byte, _ []byte, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "password.ChangeInit")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	uid, family, err := s.auth.ResolveAccessToken(ctx, accessToken)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	span.SetAttributes(attribute.Int64("user.id", uid))
+	rekey := rekeyTicket != ""
+	if rekey {
+		err = s.reauth.ConsumeRekey(ctx, rekeyTicket, uid, family)
+	} else {
+		err = s.reauth.Consume(ctx, reauthTicket, uid, family)
+	}
+	if err != nil {
+		return nil, nil, "", err
+	}
+	username, err := s.userDao.GetUsername(ctx, uid)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to get username: %w", err)
+	}
+	resp, pubKey, keyVersion, err := s.auth.registrationResponse(ctx, username, registrationRequest)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	state := &dao.PasswordChangeState{
+		UID:        uid,
+		Family:     family,
+		KeyVersion: keyVersion,
+		Rekey:      rekey,
+		ExpireAt:   time.Now().Add(passwordChangeExpireSeconds * time.Second).UnixMilli(),
+	}
+	for attempt := 0; attempt < maxTokenRetries; attempt++ {
+		id := s.opaque.GenerateToken(loginSessionIDLength)
+		ok, err := s.loginSessionDao.SavePasswordChange(ctx, id, state, passwordChangeExpireSeconds*time.Second)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("failed to save password change session: %w", err)
+		}
+		if ok {
+			return resp, pubKey, id, nil
+		}
+	}
+	return nil, nil, "", fmt.Errorf("failed to generate unique password change session id")
+}
+
+// ChangeFinalize 修改密码第二步：取出修改密码会话，替换 opaque_record，吊销当前会话以外的所有会话
+// 返回 uid、吊销的令牌族数量与是否为密钥迁移
+// 会话只能由发起 change-init 的令牌族使用一次，不存在、已过期或密钥集已停用时返回 ErrPasswordChangeExpired
+// 由密钥迁移凭据发起的会话只在记录仍使用旧密钥集时接受，不吊销其他会话
+func (s *PasswordService) ChangeFinalize(ctx context.Context, accessToken, changeSessionID string, registrationRecord []byte) (_ int64, _ int, _ bool, err error) {
+	ctx, span := tracing.Start(ctx, "password.ChangeFinalize")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	uid, family, err := s.auth.ResolveAccessToken(ctx, accessToken)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	span.SetAttributes(attribute.Int64("user.id", uid))
+	state, err := s.loginSessionDao.TakePasswordChange(ctx, changeSessionID)
+	if errors.Is(err, dao.ErrLoginSessionNotFound) {
+		return uid, 0, false, ErrPasswordChangeExpired
+	}
+	if err != nil {
+		return uid, 0, false, fmt.Errorf("failed to get password change session: %w", err)
+	}
+	if state.UID != uid || state.Family != family || !s.opaque.HasVersion(state.KeyVersion) {
+		return uid, 0, false, ErrPasswordChangeExpired
+	}
+	if err := s.auth.validateRegistrationRecord(registrationRecord); err != nil {
+		return uid, 0, false, err
+	}
+	keyVersion := state.KeyVersion
+	if state.Rekey {
+		current, err := s.userDao.GetKeyVersion(ctx, uid)
+		if err != nil {
+			return uid, 0, false, fmt.Errorf("failed to get user key version: %w", err)
+		}
+		if current == s.opaque.ActiveVersion() {
+			return uid, 0, false, ErrRekeyNotRequired
+		}
+	}
+	if err := s.userDao.UpdateUserRecord(ctx, uid, registrationRecord, keyVersion); err != nil {
+		return uid, 0, state.Rekey, fmt.Errorf("failed to update user opaque record: %w", err)
+	}
+	if state.Rekey {
+		log.Info().Int64("uid", uid).Int("key_version", keyVersion).Msg("opaque record rekeyed")
+		return uid, 0, true, nil
+	}
+	log.Info().Int64("uid", uid).Msg("password changed")
+
+	revoked, err := s.auth.RevokeOtherSessions(ctx, uid, family)
+	if err != nil {
+		return uid, revoked, false, fmt.Errorf("password changed but failed to revoke sessions: %w", err)
+	}
+	return uid, revoked, false, nil
+}
+
+// RegenerateRecoveryCodes 消耗重新验证凭据，为访问令牌所属用户重新生成恢复码，旧恢复码全部作废
+func (s *PasswordService) RegenerateRecoveryCodes(ctx context.Context, accessToken, reauthTicket string) (_ []string, err error) {
+	ctx, span := tracing.Start(ctx, "password.RegenerateRecoveryCodes")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	uid, family, err := s.auth.ResolveAccessToken(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int64("user.id", uid))
+	if err := s.reauth.Consume(ctx, reauthTicket, uid, family); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate recovery codes: %w", err)
+	}
+	if err := s.recoveryDao.Replace(ctx, uid, hashes); err != nil {
+		return nil, fmt.Errorf("failed to save recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// RemainingRecoveryCodes 返回访问令牌所属用户未使用的恢复码数量
+func (s *PasswordService) RemainingRecoveryCodes(ctx context.Context, accessToken string) (int, error) {
+	uid, _, err := s.auth.ResolveAccessToken(ctx, accessToken)
+	if err != nil {
+		return 0, err
+	}
+	return s.recoveryDao.Remaining(ctx, uid)
+}
+
+// RecoverInit 找回第一步：校验恢复码，返回 RegistrationResponse 与恢复会话ID
+// 用户不存在与恢复码错误返回相同的 ErrInvalidRecoveryCode
+func (s *PasswordService) RecoverInit(ctx context.Context, username, code string, registrationRequest []byte) (_ []byte, _ []byte, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "password.RecoverInit")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	uid, codeID, err := s.recoveryDao.Find(ctx, username, hashOneTimeCode(code))
+	if errors.Is(err, dao.ErrRecoveryCodeInvalid) {
+		return nil, nil, "", ErrInvalidRecoveryCode
+	}
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to find recovery code: %w", err)
+	}
+	span.SetAttributes(attribute.Int64("user.id", uid))
+
+	resp, pubKey, keyVersion, err := s.auth.registrationResponse(ctx, username, registrationRequest)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	state := &dao.RecoveryState{
+		Username:   username,
+		UID:        uid,
+		CodeID:     codeID,
+		KeyVersion: keyVersion,
+		ExpireAt:   time.Now().Add(recoverySessionExpireSeconds * time.Second).UnixMilli(),
+	}
+	for attempt := 0; attempt < maxTokenRetries; attempt++ {
+		id := s.opaque.GenerateToken(loginSessionIDLength)
+		ok, err := s.loginSessionDao.SaveRecovery(ctx, id, state, recoverySessionExpireSeconds*time.Second)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("failed to save recovery session: %w", err)
+		}
+		if ok {
+			return resp, pubKey, id, nil
+		}
+	}
+	return nil, nil, "", fmt.Errorf("failed to generate unique recovery session id")
+}
+
+// RecoverFinalize 找回第二步：使用恢复码并替换 opaque_record，吊销该用户的所有会话
+// 返回 uid 与用户名，恢复会话过期或恢复码已被使用时返回 ErrInvalidRecoveryCode
+func (s *PasswordService) RecoverFinalize(ctx context.Context, recoverySessionID string, registrationRecord []byte) (_ int64, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "password.RecoverFinalize")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	state, err := s.loginSessionDao.TakeRecovery(ctx, recoverySessionID)
+	if errors.Is(err, dao.ErrLoginSessionNotFound) {
+		return 0, "", ErrInvalidRecoveryCode
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get recovery session: %w", err)
+	}
+	span.SetAttributes(attribute.Int64("user.id", state.UID))
+
+	if err := s.auth.validateRegistrationRecord(registrationRecord); err != nil {
+		return state.UID, state.Username, err
+	}
+	if !s.opaque.HasVersion(state.KeyVersion) {
+		return state.UID, state.Username, ErrInvalidRecoveryCode
+	}
+	err = s.recoveryDao.Redeem(ctx, state.UID, state.CodeID, registrationRecord, state.KeyVersion)
+	if errors.Is(err, dao.ErrRecoveryCodeInvalid) {
+		return state.UID, state.Username, ErrInvalidRecoveryCode
+	}
+	if err != nil {
+		return state.UID, state.Username, fmt.Errorf("failed to redeem recovery code: %w", err)
+	}
+	log.Warn().Int64("uid", state.UID).Msg("account recovered with recovery code")
+
+	if _, err := s.auth.RevokeUserSessions(ctx, dao.SessionKickEvent{UID: state.UID, Reason: kickReasonTokenRevoked}); err != nil {
+		return state.UID, state.Username, fmt.Errorf("password reset but failed to revoke sessions: %w", err)
+	}
+	return state.UID, state.Username, nil
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/user/internal/dao"
+	"github.com/zrurf/quiver/server/user/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	reauthTicketExpireSeconds = 300 // 重新验证凭据有效期
+	reauthTicketLength        = 32
+)
+
+var (
+	ErrReauthRequired       = errors.New("re-authentication required")
+	ErrReauthSessionExpired = errors.New("re-authentication session not found or expired")
+)
+
+// ReauthService 已登录的用户重新证明密码（启用两步验证时还需要验证码），换取一次性凭据
+// 访问令牌泄露时，没有密码的人无法修改密码或重新生成恢复码
+type ReauthService struct {
+	auth            *AuthService
+	twoFactor       *TwoFactorService
+	userDao         *dao.UserRepository
+	totpDao         *dao.TOTPRepository
+	loginSessionDao *dao.LoginSessionRepository
+}
+
+func NewReauthService(
+	auth *AuthService,
+	twoFactor *TwoFactorService,
+	userDao *dao.UserRepository,
+	totpDao *dao.TOTPRepository,
+	loginSessionDao *dao.LoginSessionRepository,
+) *ReauthService {
+	return &ReauthService{
+		auth:            auth,
+		twoFactor:       twoFactor,
+		userDao:         userDao,
+		totpDao:         totpDao,
+		loginSessionDao: loginSessionDao,
+	}
+}
+
+// Init 重新验证第一步：为访问令牌所属用户生成 KE2，返回 KE2、重新验证会话ID与是否需要两步验证码
+func (s *ReauthService) Init(ctx context.Context, accessToken string, ke1 []byte) (_ []byte, _ string, _ bool, err error) {
+	ctx, span := tracing.Start(ctx, "reauth.Init")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	uid, family, err := s.auth.ResolveAccessToken(ctx, accessToken)
+	if err != nil {
+		return nil, "", false, err
+	}
+	span.SetAttributes(attribute.Int64("user.id", uid))
+	username, err := s.userDao.GetUsername(ctx, uid)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("failed to get username: %w", err)
+	}
+	mfa, err := s.totpDao.Enabled(ctx, uid)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("failed to get two-factor status: %w", err)
+	}
+	ke2, state, err := s.auth.generateKE2(ctx, username, ke1)
+	if err != nil {
+		return nil, "", false, err
+	}
+	reauth := &dao.ReauthState{LoginState: *state, Family: family}
+	for attempt := 0; attempt < maxTokenRetries; attempt++ {
+		id := s.auth.opaque.GenerateToken(loginSessionIDLength)
+		ok, err := s.loginSessionDao.SaveReauth(ctx, id, reauth, loginSessionExpireSeconds*time.Second)
+		if err != nil {
+			return nil, "", false, fmt.Errorf("failed to save reauth session: %w", err)
+		}
+		if ok {
+			return ke2, id, mfa, nil
+		}
+	}
+	return nil, "", false, fmt.Errorf("failed to generate unique reauth session id")
+}
+
+// TakeSession 取出重新验证会话，只接受发起 reauth-init 的令牌族，否则返回 ErrReauthSessionExpired
+func (s *ReauthService) TakeSession(ctx context.Context, accessToken, sessionID string) (*dao.ReauthState, error) {
+	uid, family, err := s.auth.ResolveAccessToken(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	state, err := s.loginSessionDao.TakeReauth(ctx, sessionID)
+	if errors.Is(err, dao.ErrLoginSessionNotFound) {
+		return nil, ErrReauthSessionExpired
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reauth session: %w", err)
+	}
+	if state.Family != family || state.UID != uid {
+		return nil, ErrReauthSessionExpired
+	}
+	return state, nil
+}
+
+// Finalize 重新验证第二步：校验 KE3，启用两步验证时还校验验证码或备用码，返回一次性凭据
+func (s *ReauthService) Finalize(ctx context.Context, state *dao.ReauthState, ke3 []byte, code string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "reauth.Finalize")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+	span.SetAttributes(attribute.Int64("user.id", state.UID))
+
+	if err := s.auth.verifyKE3(ctx, &state.LoginState, ke3); err != nil {
+		return "", err
+	}
+	mfa, err := s.totpDao.Enabled(ctx, state.UID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get two-factor status: %w", err)
+	}
+	if mfa {
+		if code == "" {
+			return "", ErrInvalidTOTP
+		}
+		ok, err := s.twoFactor.checkCode(ctx, state.UID, code)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", ErrInvalidTOTP
+		}
+	}
+	return s.issueTicket(ctx, state.UID, state.Family)
+}
+
+// issueTicket 签发只能由令牌族 family 使用一次的重新验证凭据
+func (s *ReauthService) issueTicket(ctx context.Context, uid int64, family string) (string, error) {
+	ticket := &dao.ReauthTicket{
+		UID:      uid,
+		Family:   family,
+		ExpireAt: time.Now().Add(reauthTicketExpireSeconds * time.Second).UnixMilli(),
+	}
+	for attempt := 0; attempt < maxTokenRetries; attempt++ {
+		id := s.auth.opaque.GenerateToken(reauthTicketLength)
+		ok, err := s.loginSessionDao.SaveReauthTicket(ctx, id, ticket, reauthTicketExpireSeconds*time.Second)
+		if err != nil {
+			return "", fmt.Errorf("failed to save reauth ticket: %w", err)
+		}
+		if ok {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("failed to generate unique reauth ticket")
+}
+
+// ConsumeRekey 使用登录时签发的密钥迁移凭据，凭据不存在、已使用或不属于该令牌族时返回 ErrReauthRequired
+func (s *ReauthService) ConsumeRekey(ctx context.Context, ticket string, uid int64, family string) error {
+	state, err := s.loginSessionDao.TakeRekeyTicket(ctx, ticket)
+	if errors.Is(err, dao.ErrLoginSessionNotFound) {
+		return ErrReauthRequired
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get rekey ticket: %w", err)
+	}
+	if state.UID != uid || state.Family != family {
+		log.Warn().Int64("uid", uid).Msg("rekey ticket used by another session")
+		return ErrReauthRequired
+	}
+	return nil
+}
+
+// Consume 使用重新验证凭据，凭据不存在、已使用或不属于该令牌族时返回 ErrReauthRequired
+func (s *ReauthService) Consume(ctx context.Context, ticket string, uid int64, family string) error {
+	if ticket == "" {
+		return ErrReauthRequired
+	}
+	state, err := s.loginSessionDao.TakeReauthTicket(ctx, ticket)
+	if errors.Is(err, dao.ErrLoginSessionNotFound) {
+		return ErrReauthRequired
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get reauth ticket: %w", err)
+	}
+	if state.UID != uid || state.Family != family {
+		log.Warn().Int64("uid", uid).Msg("reauth ticket used by another session")
+		return ErrReauthRequired
+	}
+	return nil
+}
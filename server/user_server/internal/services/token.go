@@ -0,0 +1,204 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zrurf/quiver/server/user/internal/model"
+)
+
+// 访问令牌格式
+const (
+	TokenFormatOpaque = "opaque" // 随机字符串，网关通过 IMDB 查询
+	TokenFormatSigned = "signed" // Ed25519 签名令牌，网关用公钥在本地校验
+)
+
+const (
+	signedTokenAlg  = "EdDSA"
+	signedTokenType = "JWT"
+	tokenKeyIDBytes = 8 // 密钥ID：公钥 SHA-256 的前 8 字节
+	tokenIDLength   = 16
+)
+
+// tokenScopes 访问令牌的权限范围：game 连接网关，account 调用用户服务器的账号接口
+var tokenScopes = []string{"game", "account"}
+
+var ErrInvalidSignedToken = errors.New("invalid signed token")
+
+// TokenClaims 签名令牌的载荷
+type TokenClaims struct {
+	UID       int64  `json:"uid"`
+	SessionID string `json:"sid"` // 令牌族ID，吊销以令牌族为单位
+	Scope     string `json:"scope"`
+	MFA       bool   `json:"mfa,omitempty"` // 账号启用了两步验证
+	ID        string `json:"jti"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+type signingKey struct {
+	id      string
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+// TokenSigner 签发与解析签名访问令牌
+// 第一个密钥用于签名，其余密钥只用于验签，轮换时先把新密钥加到列表末尾，等网关拉取后再移到首位
+type TokenSigner struct {
+	keys  []signingKey
+	issue bool // format 为 signed 时签发签名令牌，否则只用于公开公钥与吊销已签发的令牌
+}
+
+// NewTokenSigner 从 PEM（PKCS#8）文件加载 Ed25519 私钥，可用 openssl genpkey -algorithm ed25519 生成
+func NewTokenSigner(files []string, format string) (*TokenSigner, error) {
+	switch format {
+	case TokenFormatOpaque, TokenFormatSigned:
+	default:
+		return nil, fmt.Errorf("unknown token format %q", format)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no token signing key configured")
+	}
+	s := &TokenSigner{issue: format == TokenFormatSigned}
+	for _, file := range files {
+		key, err := loadSigningKey(file)
+		if err != nil {
+			return nil, err
+		}
+		s.keys = append(s.keys, key)
+	}
+	return s, nil
+}
+
+func loadSigningKey(file string) (signingKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("failed to read token signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return signingKey{}, fmt.Errorf("token signing key %s is not PEM encoded", file)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("failed to parse token signing key %s: %w", file, err)
+	}
+	private, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return signingKey{}, fmt.Errorf("token signing key %s is not an Ed25519 key", file)
+	}
+	public := private.Public().(ed25519.PublicKey)
+	sum := sha256.Sum256(public)
+	return signingKey{
+		id:      base64.RawURLEncoding.EncodeToString(sum[:tokenKeyIDBytes]),
+		private: private,
+		public:  public,
+	}, nil
+}
+
+// Issuing 是否签发签名令牌
+func (s *TokenSigner) Issuing() bool {
+	return s != nil && s.issue
+}
+
+// Sign 用当前签名密钥签发令牌，格式为 base64url(header).base64url(claims).base64url(signature)
+func (s *TokenSigner) Sign(claims *TokenClaims) (string, error) {
+	key := s.keys[0]
+	header, err := json.Marshal(tokenHeader{Alg: signedTokenAlg, Typ: signedTokenType, Kid: key.id})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sig := ed25519.Sign(key.private, []byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// Parse 校验签名并返回载荷，不检查是否过期
+func (s *TokenSigner) Parse(token string) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidSignedToken
+	}
+	headerData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidSignedToken
+	}
+	var header tokenHeader
+	if err := json.Unmarshal(headerData, &header); err != nil || header.Alg != signedTokenAlg {
+		return nil, ErrInvalidSignedToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidSignedToken
+	}
+	for _, key := range s.keys {
+		if key.id != header.Kid {
+			continue
+		}
+		if !ed25519.Verify(key.public, []byte(parts[0]+"."+parts[1]), sig) {
+			return nil, ErrInvalidSignedToken
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, ErrInvalidSignedToken
+		}
+		var claims TokenClaims
+		if err := json.Unmarshal(payload, &claims); err != nil {
+			return nil, ErrInvalidSignedToken
+		}
+		return &claims, nil
+	}
+	return nil, ErrInvalidSignedToken
+}
+
+// Keys 返回所有验签公钥，供网关拉取；未配置签名密钥时为空
+func (s *TokenSigner) Keys() []model.TokenKey {
+	if s == nil {
+		return []model.TokenKey{}
+	}
+	keys := make([]model.TokenKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, model.TokenKey{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			Alg: signedTokenAlg,
+			Use: "sig",
+			Kid: key.id,
+			X:   base64.RawURLEncoding.EncodeToString(key.public),
+		})
+	}
+	return keys
+}
+
+// newTokenClaims 构造访问令牌载荷
+func newTokenClaims(uid int64, family, id string, mfa bool, ttl time.Duration) *TokenClaims {
+	now := time.Now()
+	return &TokenClaims{
+		UID:       uid,
+		SessionID: family,
+		Scope:     strings.Join(tokenScopes, " "),
+		MFA:       mfa,
+		ID:        id,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+}
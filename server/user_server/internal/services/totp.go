@@ -0,0 +1,302 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zrurf/quiver/server/user/internal/dao"
+	"github.com/zrurf/quiver/server/user/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TOTP 参数（RFC 6238 默认值，主流验证器均支持）
+const (
+	totpIssuer      = "Quiver"
+	totpPeriod      = 30 // 时间步长（秒）
+	totpDigits      = 6
+	totpModulo      = 1_000_000 // 10^totpDigits
+	totpSkew        = 1         // 允许前后各 1 个时间步的时钟偏差
+	totpSecretBytes = 20        // 160 bit 密钥
+	backupCodeCount = 10
+	backupCodeBytes = 5 // 备用码熵（40 bit，8 个 base32 字符）
+	maxMFAAttempts  = 5 // 每个两步验证会话允许的失败次数
+)
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication not enabled")
+	ErrInvalidTOTP         = errors.New("invalid verification code")
+	ErrMFASessionExpired   = errors.New("mfa session not found or expired")
+)
+
+// hotp RFC 4226 HOTP（HMAC-SHA1，动态截断）
+func hotp(secret []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%totpModulo)
+}
+
+// matchTOTP 在允许的时钟偏差内匹配验证码，返回匹配的时间步
+func matchTOTP(secret []byte, code string, now time.Time) (int64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	cur := now.Unix() / totpPeriod
+	for step := cur - totpSkew; step <= cur+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(secret, uint64(step))), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// otpauthURI 生成验证器导入用的 otpauth:// URI
+func otpauthURI(username, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", totpIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(totpIssuer+":"+username) + "?" + q.Encode()
+}
+
+// TwoFactorService TOTP 两步验证
+type TwoFactorService struct {
+	totpDao         *dao.TOTPRepository
+	userDao         *dao.UserRepository
+	loginSessionDao *dao.LoginSessionRepository
+	auth            *AuthService
+	guard           *LoginGuard
+}
+
+func NewTwoFactorService(
+	totpDao *dao.TOTPRepository,
+	userDao *dao.UserRepository,
+	loginSessionDao *dao.LoginSessionRepository,
+	auth *AuthService,
+	guard *LoginGuard,
+) *TwoFactorService {
+	return &TwoFactorService{
+		totpDao:         totpDao,
+		userDao:         userDao,
+		loginSessionDao: loginSessionDao,
+		auth:            auth,
+		guard:           guard,
+	}
+}
+
+// Status 访问令牌所属账号是否已启用两步验证
+func (s *TwoFactorService) Status(ctx context.Context, accessToken string) (bool, error) {
+	uid, _, err := s.auth.ResolveAccessToken(ctx, accessToken)
+	if err != nil {
+		return false, err
+	}
+	return s.totpDao.Enabled(ctx, uid)
+}
+
+// Enroll 生成新的 TOTP 密钥，确认前不生效，返回 base32 密钥与 otpauth URI
+func (s *TwoFactorService) Enroll(ctx context.Context, accessToken string) (_ string, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "2fa.Enroll")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	uid, _, err := s.auth.ResolveAccessToken(ctx, accessToken)
+	if err != nil {
+		return "", "", err
+	}
+	span.SetAttributes(attribute.Int64("user.id", uid))
+	username, err := s.userDao.GetUsername(ctx, uid)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get username: %w", err)
+	}
+
+	secret := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+	ok, err := s.totpDao.SavePending(ctx, uid, secret)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to save totp secret: %w", err)
+	}
+	if !ok {
+		return "", "", ErrTwoFactorEnabled
+	}
+	encoded := codeEncoding.EncodeToString(secret)
+	return encoded, otpauthURI(username, encoded), nil
+}
+
+// Confirm 用验证器生成的验证码确认登记，启用两步验证并返回 uid 与备用码
+func (s *TwoFactorService) Confirm(ctx context.Context, accessToken, code string) (_ int64, _ []string, err error) {
+	ctx, span := tracing.Start(ctx, "2fa.Confirm")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	uid, _, err := s.auth.ResolveAccessToken(ctx, accessToken)
+	if err != nil {
+		return 0, nil, err
+	}
+	span.SetAttributes(attribute.Int64("user.id", uid))
+	t, err := s.totpDao.Get(ctx, uid)
+	if errors.Is(err, dao.ErrTOTPNotFound) {
+		return uid, nil, ErrTwoFactorNotEnabled
+	}
+	if err != nil {
+		return uid, nil, fmt.Errorf("failed to get totp: %w", err)
+	}
+	if t.Enabled {
+		return uid, nil, ErrTwoFactorEnabled
+	}
+	// 确认时只接受 TOTP 验证码
+	ok, err := s.useTOTP(ctx, uid, t, code)
+	if err != nil {
+		return uid, nil, err
+	}
+	if !ok {
+		return uid, nil, ErrInvalidTOTP
+	}
+
+	codes, hashes, err := generateOneTimeCodes(backupCodeCount, backupCodeBytes)
+	if err != nil {
+		return uid, nil, fmt.Errorf("failed to generate backup codes: %w", err)
+	}
+	if err := s.totpDao.Enable(ctx, uid, hashes); err != nil {
+		return uid, nil, fmt.Errorf("failed to enable totp: %w", err)
+	}
+	log.Info().Int64("uid", uid).Msg("two-factor authentication enabled")
+	return uid, codes, nil
+}
+
+// Disable 用验证码或备用码关闭两步验证，返回 uid 与用户名
+// 与登录共用失败计数，防止持有访问令牌的人暴力猜测验证码
+func (s *TwoFactorService) Disable(ctx context.Context, accessToken, code string) (_ int64, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "2fa.Disable")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	uid, _, err := s.auth.ResolveAccessToken(ctx, accessToken)
+	if err != nil {
+		return 0, "", err
+	}
+	span.SetAttributes(attribute.Int64("user.id", uid))
+	username, err := s.userDao.GetUsername(ctx, uid)
+	if err != nil {
+		return uid, "", fmt.Errorf("failed to get username: %w", err)
+	}
+	if err := s.guard.CheckLoginFinalize(ctx, username); err != nil {
+		return uid, username, err
+	}
+	ok, err := s.checkCode(ctx, uid, code)
+	if err != nil {
+		return uid, username, err
+	}
+	if !ok {
+		s.guard.RecordFailure(ctx, username)
+		return uid, username, ErrInvalidTOTP
+	}
+	if err := s.totpDao.Disable(ctx, uid); err != nil {
+		return uid, username, fmt.Errorf("failed to disable totp: %w", err)
+	}
+	log.Info().Int64("uid", uid).Msg("two-factor authentication disabled")
+	return uid, username, nil
+}
+
+// TakeMFASession 取出两步验证会话，不存在或已过期时返回 ErrMFASessionExpired
+func (s *TwoFactorService) TakeMFASession(ctx context.Context, mfaSessionID string) (*dao.MFAState, error) {
+	state, err := s.loginSessionDao.TakeMFA(ctx, mfaSessionID)
+	if errors.Is(err, dao.ErrLoginSessionNotFound) {
+		return nil, ErrMFASessionExpired
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mfa session: %w", err)
+	}
+	return state, nil
+}
+
+// VerifyLogin 登录的两步验证：验证码或备用码正确时签发令牌
+// 验证码错误且未超过失败次数时保留两步验证会话，可以重新提交
+func (s *TwoFactorService) VerifyLogin(ctx context.Context, mfaSessionID string, state *dao.MFAState, code string) (_ *LoginResult, err error) {
+	ctx, span := tracing.Start(ctx, "2fa.VerifyLogin")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+	span.SetAttributes(attribute.Int64("user.id", state.UID))
+
+	ok, err := s.checkCode(ctx, state.UID, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		state.Attempts++
+		if state.Attempts < maxMFAAttempts {
+			if _, err := s.loginSessionDao.SaveMFA(ctx, mfaSessionID, state, true); err != nil {
+				log.Error().Err(err).Int64("uid", state.UID).Msg("failed to keep mfa session")
+			}
+		}
+		return nil, ErrInvalidTOTP
+	}
+	// 两步验证期间账号可能被处罚
+	if err := s.auth.CheckAccountStatus(ctx, state.UID); err != nil {
+		return nil, err
+	}
+	return s.auth.completeLogin(ctx, state.UID, state.Rekey)
+}
+
+// checkCode 校验 TOTP 验证码或备用码，账号未启用两步验证时返回 ErrTwoFactorNotEnabled
+func (s *TwoFactorService) checkCode(ctx context.Context, uid int64, code string) (bool, error) {
+	t, err := s.totpDao.Get(ctx, uid)
+	if errors.Is(err, dao.ErrTOTPNotFound) {
+		return false, ErrTwoFactorNotEnabled
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get totp: %w", err)
+	}
+	if !t.Enabled {
+		return false, ErrTwoFactorNotEnabled
+	}
+	if code = normalizeCode(code); len(code) == totpDigits {
+		return s.useTOTP(ctx, uid, t, code)
+	}
+	ok, err := s.totpDao.UseBackupCode(ctx, uid, hashOneTimeCode(code))
+	if err != nil {
+		return false, fmt.Errorf("failed to use backup code: %w", err)
+	}
+	if ok {
+		log.Warn().Int64("uid", uid).Msg("two-factor backup code used")
+	}
+	return ok, nil
+}
+
+// useTOTP 校验 TOTP 验证码，同一时间步的验证码只能使用一次
+func (s *TwoFactorService) useTOTP(ctx context.Context, uid int64, t *dao.TOTP, code string) (bool, error) {
+	step, ok := matchTOTP(t.Secret, normalizeCode(code), time.Now())
+	if !ok || step <= t.LastStep {
+		return false, nil
+	}
+	ok, err := s.totpDao.UseStep(ctx, uid, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record totp step: %w", err)
+	}
+	return ok, nil
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/zrurf/quiver/server/user/internal/dao"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	maxUsernameLength       = 64 // users.name 为 VARCHAR(64)
+	maxConsecutiveMarks     = 2  // 允许连续的组合符号数（泰文等需要），防止叠加大量变音符号
+	defaultReservationTTL   = 5 * time.Minute
+	reservedContainsWrapper = "*" // 保留名单中 *word* 表示包含匹配
+)
+
+var (
+	ErrInvalidUsername  = errors.New("invalid username")
+	ErrUsernameReserved = errors.New("username reserved")
+)
+
+// UsernameError 用户名不符合规则，消息说明具体原因
+type UsernameError struct {
+	msg string
+}
+
+func (e *UsernameError) Error() string {
+	return e.msg
+}
+
+func (e *UsernameError) Unwrap() error {
+	return ErrInvalidUsername
+}
+
+// confusables 形近字符折叠表（Unicode TR39 的常用子集），在转小写之后映射，因此只包含小写字符
+// i、l、1、ı 及其西里尔/希腊形近字符统一折叠为 l；希腊字母大小写字形不同时按大写字形折叠（如 ν 折叠为 n）
+var confusables = map[rune]rune{
+	// 数字与拉丁字母
+	'0': 'o', '1': 'l', 'i': 'l', 'ı': 'l', '-': '_',
+	// 西里尔字母
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'l', 'ј': 'j',
+	'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ү': 'y', 'һ': 'h', 'ӏ': 'l',
+	// 希腊字母
+	'α': 'a', 'β': 'b', 'ε': 'e', 'ζ': 'z', 'η': 'h', 'ι': 'l', 'κ': 'k', 'μ': 'm',
+	'ν': 'n', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'y', 'χ': 'x',
+}
+
+// foldMarkScripts 去掉这些文字上的变音符号（泰文、天城文等的元音符号有区别意义，保留）
+var foldMarkScripts = []*unicode.RangeTable{unicode.Latin, unicode.Greek, unicode.Cyrillic}
+
+// usernameKey 用户名的折叠形式：兼容分解、去掉拉丁/希腊/西里尔字母的变音符号、转为小写后折叠形近字符
+// 折叠形式相同的用户名不能同时存在（如 "Gopher" 与西里尔字母 о 的 "Gоpher"，"Ivan" 与 "lvan"）
+func usernameKey(username string) string {
+	var b strings.Builder
+	foldMarks := false
+	for _, r := range norm.NFKD.String(username) {
+		if unicode.Is(unicode.Mn, r) {
+			if foldMarks {
+				continue
+			}
+		} else {
+			foldMarks = unicode.In(r, foldMarkScripts...)
+		}
+		r = unicode.ToLower(r)
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		b.WriteRune(r)
+	}
+	return norm.NFKC.String(b.String())
+}
+
+type UsernameConfig struct {
+	MinLength      int           // 最短字符数
+	MaxLength      int           // 最长字符数，不超过 64
+	ReservedFile   string        // 保留名单文件，为空时不使用
+	ReservationTTL time.Duration // register-init 预留用户名的时间
+}
+
+// UsernameService 用户名规则校验与注册期间的预留
+type UsernameService struct {
+	userDao        *dao.UserRepository
+	reservationDao *dao.ReservationRepository
+	conf           UsernameConfig
+	reserved       map[string]struct{} // 精确匹配（折叠形式）
+	blocked        []string            // 包含匹配（折叠形式）
+}
+
+func NewUsernameService(
+	userDao *dao.UserRepository,
+	reservationDao *dao.ReservationRepository,
+	conf UsernameConfig,
+) (*UsernameService, error) {
+	if conf.MinLength < 1 {
+		conf.MinLength = 1
+	}
+	if conf.MaxLength <= 0 || conf.MaxLength > maxUsernameLength {
+		conf.MaxLength = maxUsernameLength
+	}
+	if conf.MinLength > conf.MaxLength {
+		return nil, fmt.Errorf("username min length %d exceeds max length %d", conf.MinLength, conf.MaxLength)
+	}
+	if conf.ReservationTTL <= 0 {
+		conf.ReservationTTL = defaultReservationTTL
+	}
+	s := &UsernameService{
+		userDao:        userDao,
+		reservationDao: reservationDao,
+		conf:           conf,
+		reserved:       make(map[string]struct{}),
+	}
+	if conf.ReservedFile != "" {
+		if err := s.loadReserved(conf.ReservedFile); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// loadReserved 读取保留名单：每行一个用户名，*word* 表示包含该词的用户名都不可用，# 开头为注释
+func (s *UsernameService) loadReserved(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open reserved username file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if len(line) > 2 && strings.HasPrefix(line, reservedContainsWrapper) && strings.HasSuffix(line, reservedContainsWrapper) {
+			s.blocked = append(s.blocked, usernameKey(strings.Trim(line, reservedContainsWrapper)))
+			continue
+		}
+		s.reserved[usernameKey(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read reserved username file: %w", err)
+	}
+	return nil
+}
+
+// Check 校验用户名规则与保留名单，返回折叠形式
+func (s *UsernameService) Check(username string) (string, error) {
+	if !norm.NFKC.IsNormalString(username) {
+		return "", &UsernameError{"username must be NFKC normalized"}
+	}
+	length, marks, hasLetter := 0, 0, false
+	for _, r := range username {
+		length++
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter, marks = true, 0
+		case unicode.IsDigit(r):
+			marks = 0
+		case r == '_' || r == '-':
+			if length == 1 {
+				return "", &UsernameError{"username must start with a letter or digit"}
+			}
+			marks = 0
+		case unicode.In(r, unicode.Mn, unicode.Mc):
+			if marks++; length == 1 || marks > maxConsecutiveMarks {
+				return "", &UsernameError{"username contains invalid combining marks"}
+			}
+		default:
+			return "", &UsernameError{"username may only contain letters, digits, '_' and '-'"}
+		}
+	}
+	if length < s.conf.MinLength || length > s.conf.MaxLength {
+		return "", &UsernameError{fmt.Sprintf("username must be %d to %d characters", s.conf.MinLength, s.conf.MaxLength)}
+	}
+	if !hasLetter {
+		return "", &UsernameError{"username must contain a letter"}
+	}
+
+	key := usernameKey(username)
+	if _, ok := s.reserved[key]; ok {
+		return "", ErrUsernameReserved
+	}
+	for _, word := range s.blocked {
+		if strings.Contains(key, word) {
+			return "", ErrUsernameReserved
+		}
+	}
+	return key, nil
+}
+
+// Reserve 校验用户名并在 IMDB 中为 holder（注册会话ID）预留，返回折叠形式
+// 已注册或正被他人注册（折叠形式相同）时返回 ErrUsernameTaken
+func (s *UsernameService) Reserve(ctx context.Context, username, holder string) (string, error) {
+	key, err := s.Check(username)
+	if err != nil {
+		return "", err
+	}
+	exists, err := s.userDao.NameKeyExists(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to check username exists: %w", err)
+	}
+	if exists {
+		return "", ErrUsernameTaken
+	}
+	ok, err := s.reservationDao.Reserve(ctx, key, holder, s.conf.ReservationTTL)
+	if err != nil {
+		return "", fmt.Errorf("failed to reserve username: %w", err)
+	}
+	if !ok {
+		return "", ErrUsernameTaken
+	}
+	return key, nil
+}
+
+// ReservedByOther 预留是否已被其他注册会话占用（预留过期后可能被他人重新预留）
+func (s *UsernameService) ReservedByOther(ctx context.Context, key, holder string) (bool, error) {
+	cur, err := s.reservationDao.Holder(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to get username reservation: %w", err)
+	}
+	return cur != "" && cur != holder, nil
+}
+
+// ReservationTTL 预留时长，注册会话与预留同时过期
+func (s *UsernameService) ReservationTTL() time.Duration {
+	return s.conf.ReservationTTL
+}
+
+// Release 释放预留，未释放的预留到期后自动失效
+func (s *UsernameService) Release(ctx context.Context, key, holder string) error {
+	return s.reservationDao.Release(ctx, key, holder)
+}
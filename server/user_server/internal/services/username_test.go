@@ -0,0 +1,54 @@
+package services
+
+import "testing"
+
+func TestUsernameKeyCollisions(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"case", "Gopher", "gopher"},
+		{"upper I and lower l", "Ivan", "lvan"},
+		{"upper I and lower i", "Ivan", "ivan"},
+		{"digit one", "1van", "ivan"},
+		{"dotless i", "ıvan", "Ivan"},
+		{"upper L", "Lvan", "ivan"},
+		{"dotted capital I", "İvan", "ivan"},
+		{"cyrillic i", "іvan", "ivan"},
+		{"cyrillic capital I", "Іvan", "ivan"},
+		{"greek iota", "ιvan", "Ivan"},
+		{"greek capital iota", "Ιvan", "ivan"},
+		{"cyrillic palochka", "Ӏvan", "lvan"},
+		{"cyrillic o", "Gоpher", "gopher"},
+		{"digit zero", "G0pher", "GOPHER"},
+		{"greek capital nu", "Νick", "nick"},
+		{"diacritics", "Gophér", "gopher"},
+		{"hyphen", "go-pher", "go_pher"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ka, kb := usernameKey(tt.a), usernameKey(tt.b)
+			if ka != kb {
+				t.Errorf("usernameKey(%q) = %q, usernameKey(%q) = %q, want equal", tt.a, ka, tt.b, kb)
+			}
+		})
+	}
+}
+
+func TestUsernameKeyDistinct(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"different letters", "ivan", "evan"},
+		{"thai vowels kept", "กิน", "กน"},
+		{"extra character", "gopher", "gopher1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ka, kb := usernameKey(tt.a), usernameKey(tt.b); ka == kb {
+				t.Errorf("usernameKey(%q) = usernameKey(%q) = %q, want different", tt.a, tt.b, ka)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestCarrier 适配 fiber 请求头，用于提取上游的追踪上下文
+type requestCarrier struct {
+	c fiber.Ctx
+}
+
+func (r requestCarrier) Get(key string) string { return r.c.Get(key) }
+
+func (r requestCarrier) Set(key, value string) { r.c.Request().Header.Set(key, value) }
+
+func (r requestCarrier) Keys() []string {
+	headers := r.c.GetReqHeaders()
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Middleware 为每个 HTTP 请求创建服务端 span，并写入请求上下文供后续处理使用
+// skipPrefixes 中的路径（静态资源、健康检查等）不记录
+func Middleware(skipPrefixes ...string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		for _, p := range skipPrefixes {
+			if strings.HasPrefix(c.Path(), p) {
+				return c.Next()
+			}
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(c.Context(), requestCarrier{c})
+		ctx, span := Start(ctx, c.Method()+" "+c.Path(), trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.request.method", c.Method()),
+			attribute.String("url.path", c.Path()),
+			attribute.String("client.address", c.IP()),
+		))
+		defer span.End()
+		c.SetContext(ctx)
+
+		err := c.Next()
+
+		route := c.FullPath()
+		span.SetName(c.Method() + " " + route)
+		status := c.Response().StatusCode()
+		if fe, ok := err.(*fiber.Error); ok {
+			status = fe.Code
+		}
+		span.SetAttributes(
+			attribute.String("http.route", route),
+			attribute.Int("http.response.status_code", status),
+		)
+		if err != nil {
+			RecordError(span, err)
+		} else if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, "")
+		}
+		return err
+	}
+}
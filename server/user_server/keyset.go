@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/zrurf/quiver/server/user/internal/services"
+)
+
+// legacyKeyVersion 未使用密钥集目录时，单独配置的三个密钥文件视为版本 1
+const legacyKeyVersion = 1
+
+// keySetManifest 密钥集目录中的 keyset.json，由 opaque_tool 维护
+type keySetManifest struct {
+	Active  int `json:"active"`
+	KeySets []struct {
+		Version   int        `json:"version"`
+		CreatedAt time.Time  `json:"created_at"`
+		RetiredAt *time.Time `json:"retired_at,omitempty"`
+	} `json:"keysets"`
+}
+
+// loadOpaqueKeySets 读取 OPAQUE 密钥集，返回所有未停用的密钥集与当前版本
+// 密钥集目录结构为 <dir>/keyset.json 与 <dir>/v<N>/{oprf_seed.bin,server_public.bin,server_secret.bin}
+func loadOpaqueKeySets(config *Config) ([]services.OpaqueKeySet, int, error) {
+	dir := config.Opaque.KeysetDir
+	if dir == "" {
+		ks, err := readOpaqueKeySet(legacyKeyVersion,
+			config.Opaque.OPRFSeedFile, config.Opaque.ServerPublicKeyFile, config.Opaque.ServerSecretKeyFile)
+		if err != nil {
+			return nil, 0, err
+		}
+		return []services.OpaqueKeySet{ks}, legacyKeyVersion, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "keyset.json"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read key set manifest: %w", err)
+	}
+	var manifest keySetManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse key set manifest: %w", err)
+	}
+	var keySets []services.OpaqueKeySet
+	for _, entry := range manifest.KeySets {
+		// 已停用的密钥集不再加载，其上的用户只能凭恢复码找回账号
+		if entry.RetiredAt != nil {
+			continue
+		}
+		sub := filepath.Join(dir, fmt.Sprintf("v%d", entry.Version))
+		ks, err := readOpaqueKeySet(entry.Version,
+			filepath.Join(sub, "oprf_seed.bin"), filepath.Join(sub, "server_public.bin"), filepath.Join(sub, "server_secret.bin"))
+		if err != nil {
+			return nil, 0, err
+		}
+		keySets = append(keySets, ks)
+	}
+	return keySets, manifest.Active, nil
+}
+
+func readOpaqueKeySet(version int, seedFile, publicFile, secretFile string) (services.OpaqueKeySet, error) {
+	ks := services.OpaqueKeySet{Version: version}
+	var err error
+	if ks.OprfSeed, err = os.ReadFile(seedFile); err != nil {
+		return ks, fmt.Errorf("failed to read opaque seed of key set %d: %w", version, err)
+	}
+	if ks.ServerPublicKey, err = os.ReadFile(publicFile); err != nil {
+		return ks, fmt.Errorf("failed to read opaque public key of key set %d: %w", version, err)
+	}
+	if ks.ServerSecretKey, err = os.ReadFile(secretFile); err != nil {
+		return ks, fmt.Errorf("failed to read opaque secret key of key set %d: %w", version, err)
+	}
+	return ks, nil
+}
@@ -6,14 +6,17 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/bytemare/ksf"
 	"github.com/bytemare/opaque"
+	"github.com/exaring/otelpgx"
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/compress"
 	"github.com/gofiber/fiber/v3/middleware/cors"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -22,6 +25,7 @@ import (
 	"github.com/zrurf/quiver/server/user/internal"
 	"github.com/zrurf/quiver/server/user/internal/dao"
 	"github.com/zrurf/quiver/server/user/internal/services"
+	"github.com/zrurf/quiver/server/user/internal/tracing"
 )
 
 func main() {
@@ -36,7 +40,20 @@ func main() {
 	// 初始化logger
 	initLogger(strings.ToLower(config.Logger.Level))
 
-	log.Info().Any("config", config).Msg("Config body")
+	log.Info().Any("config", config.Redacted()).Msg("Config body")
+
+	// 初始化链路追踪
+	hostname, _ := os.Hostname()
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Options{
+		Enabled:     config.Tracing.Enabled,
+		Endpoint:    config.Tracing.Endpoint,
+		Insecure:    config.Tracing.Insecure,
+		SampleRatio: config.Tracing.SampleRatio,
+	}, "quiver-user-server", hostname)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Fatal to init tracing.")
+	}
+	defer shutdownTracing(context.Background())
 
 	// 初始化基础设施
 	dbPool, err := initDB(config)
@@ -51,24 +68,30 @@ func main() {
 	}
 	defer imdb.Close()
 
+	// 消息队列不可用时仍可登录，只是吊销令牌后网关不会立即断开会话
+	natsClient, err := dao.NewNATSClient(config.Mq.Addr, config.Mq.Subject, "user-server-"+hostname)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to connect to NATS, session revocation will not reach gateways")
+		natsClient = nil
+	} else {
+		defer natsClient.Close()
+	}
+
 	// 初始化数据访问层
 	userDao := dao.NewUserRepository(dbPool)
 	sessionDao := dao.NewSessionRepository(imdb)
-
-	// 读取OPAQUE密钥
-	oprfSeed, err := os.ReadFile(config.Opaque.OPRFSeedFile)
+	loginLogDao := dao.NewLoginLogRepository(dbPool)
+	limiterDao := dao.NewLimiterRepository(imdb)
+	loginSessionDao := dao.NewLoginSessionRepository(imdb)
+	sanctionDao := dao.NewSanctionRepository(dbPool)
+	recoveryDao := dao.NewRecoveryCodeRepository(dbPool)
+	totpDao := dao.NewTOTPRepository(dbPool, imdb)
+	reservationDao := dao.NewReservationRepository(imdb)
+
+	// 读取OPAQUE密钥集
+	keySets, activeKeySet, err := loadOpaqueKeySets(config)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Fatal to read opaque seed.")
-		panic(2)
-	}
-	pubKey, err := os.ReadFile(config.Opaque.ServerPublicKeyFile)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Fatal to read opaque public key.")
-		panic(2)
-	}
-	priKey, err := os.ReadFile(config.Opaque.ServerSecretKeyFile)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Fatal to read opaque secret key.")
+		log.Fatal().Err(err).Msg("Fatal to read opaque key sets.")
 		panic(2)
 	}
 
@@ -83,19 +106,64 @@ func main() {
 			AKE:     opaque.RistrettoSha512,
 			Context: nil,
 		},
-		OprfSeed:        oprfSeed,
-		ServerPublicKey: pubKey,
-		ServerSecretKey: priKey,
+		KeySets:       keySets,
+		ActiveVersion: activeKeySet,
 	})
 	if err != nil {
 		log.Fatal().Err(err).Msg("Fatal to init opaque service.")
 		panic(2)
 	}
+	log.Info().Ints("versions", opaqueSvc.Versions()).Int("active", opaqueSvc.ActiveVersion()).Msg("OPAQUE key sets loaded")
+
+	// 用户名规则与保留名单
+	usernameSvc, err := services.NewUsernameService(userDao, reservationDao, services.UsernameConfig{
+		MinLength:      config.Username.MinLength,
+		MaxLength:      config.Username.MaxLength,
+		ReservedFile:   config.Username.ReservedFile,
+		ReservationTTL: config.Username.ReservationTTL,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Fatal to init username policy.")
+		panic(2)
+	}
+
+	// 访问令牌签名密钥，未配置时签发随机令牌
+	var tokenSigner *services.TokenSigner
+	if len(config.Token.SigningKeys) > 0 {
+		tokenSigner, err = services.NewTokenSigner(config.Token.SigningKeys, config.Token.Format)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Fatal to init token signer.")
+			panic(2)
+		}
+	} else if config.Token.Format == services.TokenFormatSigned {
+		log.Fatal().Msg("Signed token format requires token.signing-keys.")
+		panic(2)
+	}
+
+	// 登录限流
+	loginGuard := services.NewLoginGuard(limiterDao, services.LoginLimitConfig{
+		UserLimit:       config.LoginLimit.UserLimit,
+		UserWindow:      config.LoginLimit.UserWindow,
+		IPLimit:         config.LoginLimit.IPLimit,
+		IPWindow:        config.LoginLimit.IPWindow,
+		BackoffAfter:    config.LoginLimit.BackoffAfter,
+		BackoffBase:     config.LoginLimit.BackoffBase,
+		BackoffMax:      config.LoginLimit.BackoffMax,
+		LockoutAfter:    config.LoginLimit.LockoutAfter,
+		LockoutDuration: config.LoginLimit.LockoutDuration,
+		FailureWindow:   config.LoginLimit.FailureWindow,
+	})
 
 	// 初始化fiber
 	var app = fiber.New(fiber.Config{
 		JSONEncoder: sonic.Marshal,
 		JSONDecoder: sonic.Unmarshal,
+		// 经 HAProxy 转发时从 X-Forwarded-For 读取客户端 IP，仅信任来自受信代理的请求头
+		ProxyHeader: config.Server.ProxyHeader,
+		TrustProxy:  config.Server.ProxyHeader != "",
+		TrustProxyConfig: fiber.TrustProxyConfig{
+			Proxies: config.Server.TrustedProxies,
+		},
 	})
 
 	app.Use(compress.New(compress.Config{
@@ -104,8 +172,20 @@ func main() {
 
 	app.Use(cors.New())
 
+	app.Use(tracing.Middleware("/assets", "/page", "/health"))
+
+	authSvc := services.NewAuthService(userDao, sessionDao, loginSessionDao, sanctionDao, totpDao, usernameSvc, imdb, opaqueSvc, natsClient, tokenSigner)
+	twoFactorSvc := services.NewTwoFactorService(totpDao, userDao, loginSessionDao, authSvc, loginGuard)
+	reauthSvc := services.NewReauthService(authSvc, twoFactorSvc, userDao, totpDao, loginSessionDao)
 	internal.ConfigRoute(app, &internal.RouteDependencies{
-		AuthSvc: services.NewAuthService(userDao, sessionDao, imdb, opaqueSvc),
+		AuthSvc:      authSvc,
+		AuditSvc:     services.NewAuditService(loginLogDao, userDao, sessionDao),
+		AccountSvc:   services.NewAccountService(sanctionDao, authSvc),
+		PasswordSvc:  services.NewPasswordService(userDao, recoveryDao, loginSessionDao, opaqueSvc, authSvc, reauthSvc),
+		TwoFactorSvc: twoFactorSvc,
+		ReauthSvc:    reauthSvc,
+		LoginGuard:   loginGuard,
+		AdminToken:   config.Admin.Token,
 	})
 
 	app.Listen(config.Server.Listen)
@@ -130,7 +210,7 @@ func initConfig() (*Config, error) {
 	}
 
 	v.SetEnvPrefix("QUIVER")
-	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
 	v.AutomaticEnv()
 
 	pflag.CommandLine.VisitAll(func(f *pflag.Flag) {
@@ -160,10 +240,21 @@ func initFlag() {
 
 	// Server
 	pflag.String("server.listen", ":80", "Server listen address (e.g., :80 or 127.0.0.1:8080)")
+	pflag.String("server.proxy-header", "X-Forwarded-For", "Header carrying the client IP set by the reverse proxy (empty to disable)")
+	pflag.StringSlice("server.trusted-proxies", []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}, "Proxy IPs or CIDRs whose proxy header is trusted")
+
+	// Admin
+	pflag.String("admin.token", "", "Bearer token for the /admin API (empty to disable)")
 
 	// Logger
 	pflag.String("logger.level", "info", "Log level (debug, info, warn, error, fatal)")
 
+	// Tracing
+	pflag.Bool("tracing.enabled", false, "Export OpenTelemetry traces")
+	pflag.String("tracing.endpoint", "otel-collector:4318", "OTLP/HTTP collector endpoint (host:port)")
+	pflag.Bool("tracing.insecure", true, "Use plain HTTP to the collector")
+	pflag.Float64("tracing.sample-ratio", 1.0, "Sampling ratio for root spans (0-1)")
+
 	// Database
 	pflag.String("database.host", "localhost", "Database host")
 	pflag.String("database.port", "5432", "Database port")
@@ -176,12 +267,35 @@ func initFlag() {
 
 	// Mq
 	pflag.String("mq.addr", "nats://localhost:4222", "Message queue address")
-	pflag.String("mq.subject", "default", "Message queue subject/topic")
+	pflag.String("mq.subject", "quiver.events", "Subject prefix shared by all services for events")
+
+	// Login limit
+	pflag.Int("login-limit.user-limit", 10, "Login attempts allowed per username within user-window (0 to disable)")
+	pflag.Duration("login-limit.user-window", 5*time.Minute, "Sliding window of the per-username limit")
+	pflag.Int("login-limit.ip-limit", 30, "Login attempts allowed per IP within ip-window (0 to disable)")
+	pflag.Duration("login-limit.ip-window", time.Minute, "Sliding window of the per-IP limit")
+	pflag.Int("login-limit.backoff-after", 3, "Consecutive failures before exponential backoff starts (0 to disable)")
+	pflag.Duration("login-limit.backoff-base", time.Second, "First backoff delay, doubled on every further failure")
+	pflag.Duration("login-limit.backoff-max", 5*time.Minute, "Maximum backoff delay")
+	pflag.Int("login-limit.lockout-after", 10, "Consecutive failures before the username is locked (0 to disable)")
+	pflag.Duration("login-limit.lockout-duration", 15*time.Minute, "How long a locked username stays locked")
+	pflag.Duration("login-limit.failure-window", time.Hour, "Failures are forgotten after this long without a new failure")
+
+	// Username
+	pflag.Int("username.min-length", 3, "Minimum username length in characters")
+	pflag.Int("username.max-length", 20, "Maximum username length in characters (at most 64)")
+	pflag.String("username.reserved-file", "", "Reserved and blocked username list, one per line, *word* blocks names containing word (empty to disable)")
+	pflag.Duration("username.reservation-ttl", 5*time.Minute, "How long register-init holds a username and its registration session")
+
+	// Token
+	pflag.String("token.format", "opaque", "Access token format (opaque, signed)")
+	pflag.StringSlice("token.signing-keys", []string{}, "Ed25519 PKCS#8 PEM private key files, the first signs and the rest only verify")
 
 	// Opaque
 	pflag.String("opaque.oprf-seed-file", "./oprf_seed.bin", "OPRF seed file path")
 	pflag.String("opaque.server-public-key-file", "./server_public.key", "Server public key file path")
 	pflag.String("opaque.server-secret-key-file", "./server_secret.key", "Server secret key file path")
+	pflag.String("opaque.keyset-dir", "", "Versioned key set directory managed by opaque_tool, overrides the single key files (empty to disable)")
 	pflag.Parse()
 }
 
@@ -208,11 +322,16 @@ func initLogger(level_str string) {
 }
 
 func initDB(config *Config) (*pgxpool.Pool, error) {
-	dbPool, err := pgxpool.New(context.Background(), fmt.Sprintf(
+	poolConfig, err := pgxpool.ParseConfig(fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s",
 		config.Database.Host, config.Database.Port, config.Database.User,
 		config.Database.Password, config.Database.Name,
 	))
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid database config")
+	}
+	poolConfig.ConnConfig.Tracer = otelpgx.NewTracer()
+	dbPool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to connect to user db")
 	}
@@ -223,6 +342,9 @@ func initIMDB(config *Config) (*redis.Client, error) {
 	imdb := redis.NewClient(&redis.Options{
 		Addr: config.Imdb.Addr,
 	})
+	if err := redisotel.InstrumentTracing(imdb); err != nil {
+		log.Error().Err(err).Msg("failed to instrument imdb tracing")
+	}
 	_, err := imdb.Ping(context.Background()).Result()
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to connect to imdb")
@@ -5,27 +5,50 @@ export const ENDPOINTS = {
   get REGISTER_INIT() { return `${SERVER_URL}/api/auth/register-init`; },
   get REGISTER_FINALIZE() { return `${SERVER_URL}/api/auth/register-finalize`; },
   get LOGIN_INIT() { return `${SERVER_URL}/api/auth/login-init`; },
-  get LOGIN_FINALIZE() { return `${SERVER_URL}/api/auth/login-finalize`; }
+  get LOGIN_FINALIZE() { return `${SERVER_URL}/api/auth/login-finalize`; },
+  get TWO_FACTOR_VERIFY() { return `${SERVER_URL}/api/auth/2fa/verify`; },
+  get REAUTH_INIT() { return `${SERVER_URL}/api/auth/reauth-init`; },
+  get REAUTH_FINALIZE() { return `${SERVER_URL}/api/auth/reauth-finalize`; },
+  get PASSWORD_CHANGE_INIT() { return `${SERVER_URL}/api/auth/password/change-init`; },
+  get PASSWORD_CHANGE_FINALIZE() { return `${SERVER_URL}/api/auth/password/change-finalize`; }
 };
 
 export const ERROR_MESSAGES: Map<string, string> = new Map([
     ['ERR_SERVER_ERROR', '服务器内部错误'],
     ['ERR_LOGIN_FAILED', '账号或密码错误'],
-    ['ERR_USERNAME_CONFLICT', '用户名冲突']
+    ['ERR_USERNAME_CONFLICT', '用户名冲突'],
+    ['ERR_INVALID_USERNAME', '用户名只能包含字母、数字、_ 和 -，以字母或数字开头，长度 3~20'],
+    ['ERR_USERNAME_RESERVED', '该用户名不可用'],
+    ['ERR_REGISTRATION_EXPIRED', '注册超时，请重新注册'],
+    ['ERR_RATE_LIMITED', '尝试次数过多，请稍后再试'],
+    ['ERR_ACCOUNT_LOCKED', '登录失败次数过多，账号已临时锁定'],
+    ['ERR_ACCOUNT_SUSPENDED', '账号已被暂停使用'],
+    ['ERR_ACCOUNT_BANNED', '账号已被封禁'],
+    ['ERR_ACCOUNT_DISABLED', '账号不可用'],
+    ['ERR_RECOVERY_FAILED', '用户名或恢复码错误'],
+    ['ERR_2FA_INVALID_CODE', '验证码错误'],
+    ['ERR_2FA_SESSION_EXPIRED', '两步验证已超时，请重新登录'],
+    ['ERR_REAUTH_REQUIRED', '请重新验证密码'],
+    ['ERR_REAUTH_SESSION_EXPIRED', '验证已超时，请重试'],
+    ['ERR_PASSWORD_CHANGE_EXPIRED', '修改密码已超时，请重试']
 ]);
 
 export function setServerUrl(url: string) {
     SERVER_URL = url;
 }
 
-export async function apiRequest(url: string, data: any) {
+export async function apiRequest(url: string, data: any, accessToken?: string) {
 try {
     console.debug(`请求: ${url}`, 'info');
+    const headers: Record<string, string> = {
+        'Content-Type': 'application/json',
+    };
+    if (accessToken) {
+        headers['Authorization'] = `Bearer ${accessToken}`;
+    }
     const response = await fetch(url, {
         method: 'POST',
-        headers: {
-            'Content-Type': 'application/json',
-        },
+        headers: headers,
         body: JSON.stringify(data)
     });
 
@@ -8,6 +8,8 @@ let serverPublicKey: any = null;
 
 // 注册流程
 export async function handleRegister(username: string, password: string) {
+  // 服务端只接受 NFKC 规范形式的用户名，OPAQUE 的客户端标识也使用规范形式
+  username = username.normalize('NFKC');
   try {
     showLoading(elements.registerLoading!);
     disableButton(elements.registerBtn as HTMLButtonElement);
@@ -56,7 +58,7 @@ export async function handleRegister(username: string, password: string) {
 
     // 发送注册完成请求
     const finalizeResponse = await apiRequest(ENDPOINTS.REGISTER_FINALIZE, {
-        username: username,
+        registration_session_id: initResponse.data.registration_session_id,
         registration_record: Base64Converter.toStandard(registrationRecord.registrationRecord)
     });
 
@@ -67,14 +69,16 @@ export async function handleRegister(username: string, password: string) {
         throw new Error(finalizeResponse.error);
     }
 
-    showMessage(elements.registerMessage!, '注册成功！3秒后自动跳转登录页面', 'success');
+    // 恢复码只在注册时返回一次，忘记密码时凭恢复码找回账号
+    const recoveryCodes: string[] = finalizeResponse.data.recovery_codes ?? [];
+    showMessage(elements.registerMessage!, `注册成功！请妥善保存以下恢复码（每个只能使用一次）：${recoveryCodes.join('  ')}`, 'success');
     console.debug(`用户 ${username} 注册成功`, 'success');
 
-    // 自动切换到登录页
+    // 留出抄写恢复码的时间后切换到登录页
     setTimeout(() => {
         enableButton(elements.registerBtn as HTMLButtonElement, '注册');
         switchTab('login');
-    }, 3000);
+    }, 30000);
     disableButton(elements.registerBtn as HTMLButtonElement);
   } catch (error: any) {
     enableButton(elements.registerBtn as HTMLButtonElement, '注册');
@@ -84,6 +88,48 @@ export async function handleRegister(username: string, password: string) {
   }
 }
 
+// 把注册记录迁移到服务器当前的 OPAQUE 密钥集（密码不变），rekeyTicket 为登录响应中的一次性凭据
+async function rekeyPassword(username: string, password: string, accessToken: string, rekeyTicket: string) {
+    const registrationResult = opaque.client.startRegistration({
+        password: password
+    });
+    const initResponse = await apiRequest(ENDPOINTS.PASSWORD_CHANGE_INIT, {
+        rekey_ticket: rekeyTicket,
+        registration_request: Base64Converter.toStandard(registrationResult.registrationRequest)
+    }, accessToken);
+    if (!initResponse.success) {
+        console.warn(`密钥迁移失败: ${initResponse.error}`);
+        return;
+    }
+
+    const registrationRecord = opaque.client.finishRegistration({
+        password: password,
+        registrationResponse: Base64Converter.toUrlSafe(initResponse.data.registration_response),
+        clientRegistrationState: registrationResult.clientRegistrationState,
+        identifiers: {
+            client: username,
+            server: "quiver"
+        },
+        keyStretching: {
+            "argon2id-custom": {
+                "iterations": 3,
+                "memory": 64 * 1024,
+                "parallelism": 4
+            }
+        }
+    });
+
+    const finalizeResponse = await apiRequest(ENDPOINTS.PASSWORD_CHANGE_FINALIZE, {
+        change_session_id: initResponse.data.change_session_id,
+        registration_record: Base64Converter.toStandard(registrationRecord.registrationRecord)
+    }, accessToken);
+    if (!finalizeResponse.success) {
+        console.warn(`密钥迁移失败: ${finalizeResponse.error}`);
+        return;
+    }
+    console.info(`用户 ${username} 的注册记录已迁移到新的密钥集`);
+}
+
 // 登录流程
 export async function handleLogin(username: string, password: string) {
   try {
@@ -135,12 +181,27 @@ export async function handleLogin(username: string, password: string) {
     }
 
     // 发送登录完成请求
-    const finalizeResponse = await apiRequest(ENDPOINTS.LOGIN_FINALIZE, {
-        ke3: Base64Converter.toStandard(finishLoginResponse?.finishLoginRequest!),
-        mac: initResponse.data.mac,
-        username: username
+    let finalizeResponse = await apiRequest(ENDPOINTS.LOGIN_FINALIZE, {
+        login_session_id: initResponse.data.login_session_id,
+        ke3: Base64Converter.toStandard(finishLoginResponse?.finishLoginRequest!)
     });
 
+    // 账号启用了两步验证：提交验证器中的验证码或备用码，验证码错误时可以重试
+    if (finalizeResponse.success && finalizeResponse.data.mfa_required) {
+        const mfaSessionId = finalizeResponse.data.mfa_session_id;
+        do {
+            const code = window.prompt('请输入验证器中的 6 位验证码（或备用码）');
+            if (!code) {
+                showMessage(elements.loginMessage!, '登录已取消', 'error');
+                throw new Error("two-factor verification cancelled");
+            }
+            finalizeResponse = await apiRequest(ENDPOINTS.TWO_FACTOR_VERIFY, {
+                mfa_session_id: mfaSessionId,
+                code: code.trim()
+            });
+        } while (!finalizeResponse.success && finalizeResponse.status === 'ERR_2FA_INVALID_CODE');
+    }
+
     if (!finalizeResponse.success) {
         showMessage(elements.loginMessage!, `登录失败: ${
             (ERROR_MESSAGES.has(finalizeResponse.status)) ? ERROR_MESSAGES.get(finalizeResponse.status) : finalizeResponse.error
@@ -149,6 +210,11 @@ export async function handleLogin(username: string, password: string) {
     }
 
     const { uid, access_token, refresh_token, expire_at } = finalizeResponse.data;
+
+    // 服务器已轮换 OPAQUE 密钥，注册记录仍在旧密钥集上：用同一密码重新注册，失败不影响本次登录
+    if (finalizeResponse.data.rekey_ticket) {
+        await rekeyPassword(username, password, access_token, finalizeResponse.data.rekey_ticket);
+    }
     
     showMessage(elements.loginMessage!, `登录成功！UID: ${uid}`, 'success');
     send('login', {
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bytemare/opaque"
+)
+
+const manifestFile = "keyset.json"
+
+// keyFiles 一个密钥集的文件，bin 与可选的 b64
+var keyFiles = []string{"oprf_seed", "server_public", "server_secret"}
+
+// keySetManifest 密钥集目录的清单，与用户服务器读取的格式一致
+type keySetManifest struct {
+	Active  int           `json:"active"`
+	KeySets []keySetEntry `json:"keysets"`
+}
+
+type keySetEntry struct {
+	Version   int        `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+}
+
+func (m *keySetManifest) find(version int) *keySetEntry {
+	for i := range m.KeySets {
+		if m.KeySets[i].Version == version {
+			return &m.KeySets[i]
+		}
+	}
+	return nil
+}
+
+func keySetDir(dir string, version int) string {
+	return filepath.Join(dir, fmt.Sprintf("v%d", version))
+}
+
+// readManifest 读取清单，不存在时返回 nil
+func readManifest(dir string) (*keySetManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m keySetManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", manifestFile, err)
+	}
+	return &m, nil
+}
+
+// writeManifest 先写临时文件再重命名，避免用户服务器读到写了一半的清单
+func writeManifest(dir string, m *keySetManifest) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		fatalErr("序列化清单失败", err)
+	}
+	tmp := filepath.Join(dir, manifestFile+".tmp")
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		fatalErr("写入清单失败", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, manifestFile)); err != nil {
+		fatalErr("写入清单失败", err)
+	}
+}
+
+func loadManifest(dir string) *keySetManifest {
+	m, err := readManifest(dir)
+	if err != nil {
+		fatalErr("读取清单失败", err)
+	}
+	if m == nil {
+		fatalErr("读取清单失败", fmt.Errorf("%s 中没有 %s，请先使用 -new 创建密钥集", dir, manifestFile))
+	}
+	return m
+}
+
+// newKeySet 在密钥集目录中生成新版本
+// 目录中没有清单但有旧版的单个密钥文件时，先把它们复制为版本 1，已注册的用户仍可登录
+// 新版本不会自动启用（第一个版本除外）：所有用户服务器实例都加载新版本后再用 -activate 启用，
+// 否则在新版本上注册的用户无法在尚未更新的实例上登录
+func newKeySet(conf *opaque.Configuration, dir string, doKeyCheck bool) {
+	m, err := readManifest(dir)
+	if err != nil {
+		fatalErr("读取清单失败", err)
+	}
+	if m == nil {
+		m = &keySetManifest{}
+		if _, err := os.Stat(filepath.Join(dir, "oprf_seed.bin")); err == nil {
+			importLegacyKeys(dir, m)
+		}
+	}
+
+	version := 1
+	for _, entry := range m.KeySets {
+		version = max(version, entry.Version+1)
+	}
+	fmt.Printf("生成密钥集版本 %d...\n", version)
+	generateKeys(conf, "bin", keySetDir(dir, version), doKeyCheck)
+
+	m.KeySets = append(m.KeySets, keySetEntry{Version: version, CreatedAt: time.Now().UTC()})
+	if m.Active == 0 {
+		m.Active = version
+	}
+	writeManifest(dir, m)
+
+	if m.Active == version {
+		fmt.Printf("\n✓ 密钥集版本 %d 已创建并启用\n", version)
+	} else {
+		fmt.Printf("\n✓ 密钥集版本 %d 已创建，当前启用的仍是版本 %d\n", version, m.Active)
+		fmt.Printf("  所有用户服务器实例重启加载后执行: opaque_key_tool -dir %s -activate %d\n", dir, version)
+	}
+}
+
+// importLegacyKeys 把旧版的单个密钥文件复制为版本 1（保留原文件，未切换配置的实例仍可使用）
+func importLegacyKeys(dir string, m *keySetManifest) {
+	sub := keySetDir(dir, 1)
+	if err := os.MkdirAll(sub, 0700); err != nil {
+		fatalErr("创建目录失败", err)
+	}
+	for _, name := range keyFiles {
+		for _, ext := range []string{".bin", ".b64"} {
+			src := filepath.Join(dir, name+ext)
+			data, err := os.ReadFile(src)
+			if errors.Is(err, fs.ErrNotExist) && ext == ".b64" {
+				continue
+			}
+			if err != nil {
+				fatalErr(fmt.Sprintf("读取 %s 失败", src), err)
+			}
+			perm := os.FileMode(0600)
+			if name == "server_public" {
+				perm = 0644
+			}
+			if err := os.WriteFile(filepath.Join(sub, name+ext), data, perm); err != nil {
+				fatalErr(fmt.Sprintf("写入 %s 失败", filepath.Join(sub, name+ext)), err)
+			}
+		}
+	}
+	m.KeySets = append(m.KeySets, keySetEntry{Version: 1, CreatedAt: time.Now().UTC()})
+	m.Active = 1
+	fmt.Printf("✓ 已将现有密钥文件导入为版本 1: %s\n", sub)
+}
+
+func listKeySets(dir string) {
+	m := loadManifest(dir)
+	fmt.Printf("%-8s %-8s %-22s %s\n", "版本", "状态", "创建时间", "停用时间")
+	for _, entry := range m.KeySets {
+		status, retired := "可用", "-"
+		switch {
+		case entry.RetiredAt != nil:
+			status, retired = "已停用", entry.RetiredAt.Format(time.RFC3339)
+		case entry.Version == m.Active:
+			status = "启用"
+		}
+		fmt.Printf("%-8d %-8s %-22s %s\n", entry.Version, status, entry.CreatedAt.Format(time.RFC3339), retired)
+	}
+}
+
+// activateKeySet 启用密钥集，新注册与修改密码改用该版本，旧版本上的用户登录后迁移
+func activateKeySet(dir string, version int) {
+	m := loadManifest(dir)
+	entry := m.find(version)
+	if entry == nil {
+		fatalErr("启用失败", fmt.Errorf("密钥集版本 %d 不存在", version))
+	}
+	if entry.RetiredAt != nil {
+		fatalErr("启用失败", fmt.Errorf("密钥集版本 %d 已停用", version))
+	}
+	m.Active = version
+	writeManifest(dir, m)
+	fmt.Printf("✓ 已启用密钥集版本 %d，重启用户服务器后生效\n", version)
+}
+
+// retireKeySet 停用密钥集，用户服务器不再加载，仍在该版本上的用户只能凭恢复码找回账号
+// 停用前可通过用户服务器的 GET /admin/opaque-keys 确认该版本的用户数；密钥文件保留，可手动恢复
+func retireKeySet(dir string, version int) {
+	m := loadManifest(dir)
+	entry := m.find(version)
+	if entry == nil {
+		fatalErr("停用失败", fmt.Errorf("密钥集版本 %d 不存在", version))
+	}
+	if version == m.Active {
+		fatalErr("停用失败", fmt.Errorf("密钥集版本 %d 正在使用，请先启用其他版本", version))
+	}
+	if entry.RetiredAt != nil {
+		fmt.Printf("密钥集版本 %d 已于 %s 停用\n", version, entry.RetiredAt.Format(time.RFC3339))
+		return
+	}
+	now := time.Now().UTC()
+	entry.RetiredAt = &now
+	writeManifest(dir, m)
+	fmt.Printf("✓ 已停用密钥集版本 %d，重启用户服务器后生效\n", version)
+}
+
+// verifyKeySets 验证清单中所有未停用的密钥集
+func verifyKeySets(m *keySetManifest, dir string, doKeyCheck bool) {
+	if m.find(m.Active) == nil {
+		fmt.Printf("✗ 启用的密钥集版本 %d 不存在\n", m.Active)
+		os.Exit(1)
+	}
+	allValid := true
+	for _, entry := range m.KeySets {
+		if entry.RetiredAt != nil {
+			fmt.Printf("\n- 跳过已停用的密钥集版本 %d\n", entry.Version)
+			continue
+		}
+		fmt.Printf("\n=== 密钥集版本 %d ===\n", entry.Version)
+		if !verifyKeyDir(keySetDir(dir, entry.Version), doKeyCheck) {
+			allValid = false
+		}
+	}
+	if m.find(m.Active).RetiredAt != nil {
+		fmt.Printf("✗ 启用的密钥集版本 %d 已停用\n", m.Active)
+		allValid = false
+	}
+
+	if allValid {
+		fmt.Println("\n✓ 所有密钥集验证通过！")
+	} else {
+		fmt.Println("\n✗ 密钥集验证失败。")
+		os.Exit(1)
+	}
+}
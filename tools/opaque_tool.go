@@ -20,6 +20,10 @@ func main() {
 		outputFormat = flag.String("format", "bin", "输出格式: bin, base64")
 		outputDir    = flag.String("dir", "./secrets", "输出目录（bin格式使用）")
 		verifyOnly   = flag.Bool("verify", false, "验证现有密钥文件")
+		newSet       = flag.Bool("new", false, "在 -dir 中生成新版本的密钥集")
+		listSets     = flag.Bool("list", false, "列出 -dir 中的密钥集")
+		activate     = flag.Int("activate", 0, "启用指定版本的密钥集")
+		retire       = flag.Int("retire", 0, "停用指定版本的密钥集")
 		skipKeyCheck = flag.Bool("skip-check", false, "跳过公私钥校验（仅生成时有效）")
 		showHelp     = flag.Bool("h", false, "显示帮助信息")
 	)
@@ -33,9 +37,19 @@ func main() {
 	fmt.Println("OPAQUE RistrettoSha512 密钥工具")
 	fmt.Println("==================================")
 
-	if *verifyOnly {
+	switch {
+	case *verifyOnly:
 		verifyKeys(*outputDir, !*skipKeyCheck)
 		return
+	case *listSets:
+		listKeySets(*outputDir)
+		return
+	case *activate > 0:
+		activateKeySet(*outputDir, *activate)
+		return
+	case *retire > 0:
+		retireKeySet(*outputDir, *retire)
+		return
 	}
 
 	// 生成密钥
@@ -48,6 +62,10 @@ func main() {
 		AKE:     opaque.RistrettoSha512,
 		Context: nil,
 	}
+	if *newSet {
+		newKeySet(conf, *outputDir, !*skipKeyCheck)
+		return
+	}
 	generateKeys(conf, *outputFormat, *outputDir, !*skipKeyCheck)
 }
 
@@ -57,7 +75,11 @@ func printUsage() {
 选项:
   -format string     输出格式: bin, base64 (默认 "bin")
   -dir string        输出目录（bin格式使用） (默认 "./secrets")
-  -verify            验证现有密钥文件
+  -verify            验证现有密钥文件（-dir 为密钥集目录时验证所有未停用的版本）
+  -new               在 -dir 中生成新版本的密钥集（bin格式），首个版本自动启用
+  -list              列出 -dir 中的密钥集
+  -activate int      启用指定版本的密钥集
+  -retire int        停用指定版本的密钥集（不能停用启用中的版本）
   -skip-check        跳过公私钥校验（仅生成时有效）
   -h                 显示此帮助信息
 
@@ -75,7 +97,18 @@ func printUsage() {
   opaque_key_tool -verify -dir ./secrets
 
   # 验证密钥文件（仅检查文件存在和长度）
-  opaque_key_tool -verify -dir ./secrets -skip-check`)
+  opaque_key_tool -verify -dir ./secrets -skip-check
+
+密钥轮换:
+  # 生成新版本（目录中已有单个密钥文件时先导入为版本 1）
+  opaque_key_tool -new -dir ./secrets
+
+  # 所有用户服务器实例加载新版本后启用，旧版本上的用户登录时迁移到新版本
+  opaque_key_tool -activate 2 -dir ./secrets
+
+  # 确认旧版本已无用户（GET /admin/opaque-keys）后停用
+  opaque_key_tool -list -dir ./secrets
+  opaque_key_tool -retire 1 -dir ./secrets`)
 }
 
 func generateKeys(conf *opaque.Configuration, format, dir string, doKeyCheck bool) {
@@ -184,6 +217,24 @@ func printBase64(oprfSeed, serverPubKey, serverSecretKey []byte) {
 }
 
 func verifyKeys(dir string, doKeyCheck bool) {
+	m, err := readManifest(dir)
+	if err != nil {
+		fatalErr("读取清单失败", err)
+	}
+	if m != nil {
+		verifyKeySets(m, dir, doKeyCheck)
+		return
+	}
+	if verifyKeyDir(dir, doKeyCheck) {
+		fmt.Println("\n✓ 所有密钥文件验证通过！")
+	} else {
+		fmt.Println("\n✗ 密钥文件验证失败。")
+		os.Exit(1)
+	}
+}
+
+// verifyKeyDir 验证一个目录中的密钥文件
+func verifyKeyDir(dir string, doKeyCheck bool) bool {
 	fmt.Println("验证密钥文件...")
 
 	// 检查文件存在和长度
@@ -225,7 +276,7 @@ func verifyKeys(dir string, doKeyCheck bool) {
 
 	if !allValid {
 		fmt.Println("\n✗ 基础文件验证失败，跳过校验。")
-		os.Exit(1)
+		return false
 	}
 
 	// 验证Base64文件一致性
@@ -259,12 +310,7 @@ func verifyKeys(dir string, doKeyCheck bool) {
 		fmt.Println(" 跳过公私钥校验")
 	}
 
-	if allValid {
-		fmt.Println("\n✓ 所有密钥文件验证通过！")
-	} else {
-		fmt.Println("\n✗ 密钥文件验证失败。")
-		os.Exit(1)
-	}
+	return allValid
 }
 
 func verifyKeyMaterial(conf *opaque.Configuration, oprfSeed, serverPubKey, serverSecretKey []byte) error {